@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"deploytar/service"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo/v5"
+)
+
+// ArchiveHandler streams the directory named by the "d" query parameter,
+// resolved like ListDirectoryHandler, as an archive in the format given by
+// the "format" parameter: tar.gz (default), tar, tar.zst or zip.
+func ArchiveHandler(c *echo.Context) error {
+	format, err := service.ParseArchiveFormat(c.QueryParam("format"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	dir, displayPath, err := service.ResolveDirectory(c.QueryParam("d"), os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return c.JSON(downloadErrorStatus(err), map[string]string{"error": err.Error()})
+	}
+
+	name := filepath.Base(displayPath)
+	if displayPath == "/" {
+		name = "root"
+	}
+	c.Response().Header().Set(echo.HeaderContentType, service.ArchiveMediaType(format))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+"."+string(format)))
+	c.Response().WriteHeader(http.StatusOK)
+	// The archive is streamed, so a failure past this point can only cut
+	// the response short.
+	return service.WriteArchive(c.Response(), dir, format)
+}
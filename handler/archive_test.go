@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveHandler(t *testing.T) {
+	prefix := t.TempDir()
+	t.Setenv("PATH_PREFIX", prefix)
+	require.NoError(t, os.MkdirAll(filepath.Join(prefix, "site", "css"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "site", "index.html"), []byte("home"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "site", "css", "app.css"), []byte("body{}"), 0644))
+	require.NoError(t, os.Symlink(t.TempDir(), filepath.Join(prefix, "outside")))
+
+	e := echo.New()
+	e.GET("/archive", ArchiveHandler)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/archive?d=site")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/gzip", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `attachment; filename="site.tar.gz"`, rec.Header().Get(echo.HeaderContentDisposition))
+
+	gz, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"css/", "css/app.css", "index.html"}, names)
+
+	rec = get("/archive?d=site&format=zip")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/zip", rec.Header().Get(echo.HeaderContentType))
+
+	assert.Equal(t, http.StatusBadRequest, get("/archive?d=site&format=rar").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/archive?d=site/index.html").Code)
+	assert.Equal(t, http.StatusNotFound, get("/archive?d=missing").Code)
+	assert.Equal(t, http.StatusForbidden, get("/archive?d=../").Code)
+	assert.Equal(t, http.StatusForbidden, get("/archive?d=outside").Code, "Symlinks must not escape the prefix")
+}
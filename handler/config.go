@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"deploytar/service"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// modePolicyFromEnv reads the extraction mode policy from the environment:
+// EXTRACT_UMASK, EXTRACT_KEEP_SPECIAL_BITS, EXTRACT_FILE_MODE, EXTRACT_DIR_MODE
+// and EXTRACT_RESTORE_DIR_MTIMES.
+func modePolicyFromEnv() (*service.ModePolicy, error) {
+	policy := service.DefaultModePolicy()
+
+	modes := []struct {
+		name   string
+		target *os.FileMode
+	}{
+		{"EXTRACT_UMASK", &policy.Umask},
+		{"EXTRACT_FILE_MODE", &policy.FileMode},
+		{"EXTRACT_DIR_MODE", &policy.DirMode},
+	}
+	for _, m := range modes {
+		if value := os.Getenv(m.name); value != "" {
+			mode, err := service.ParseMode(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", m.name, err)
+			}
+			*m.target = mode
+		}
+	}
+
+	flags := []struct {
+		name   string
+		target *bool
+	}{
+		{"EXTRACT_KEEP_SPECIAL_BITS", &policy.KeepSpecialBits},
+		{"EXTRACT_RESTORE_DIR_MTIMES", &policy.RestoreDirModTimes},
+	}
+	for _, f := range flags {
+		if value := os.Getenv(f.name); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid boolean '%s'", f.name, value)
+			}
+			*f.target = enabled
+		}
+	}
+	return &policy, nil
+}
+
+// trustedKeysFromEnv reads the public keys allowed to sign uploads from
+// TRUSTED_SIGNING_KEYS and the file named by TRUSTED_SIGNING_KEYS_FILE.
+func trustedKeysFromEnv() ([]service.TrustedKey, error) {
+	keysText := os.Getenv("TRUSTED_SIGNING_KEYS")
+	if keysFile := os.Getenv("TRUSTED_SIGNING_KEYS_FILE"); keysFile != "" {
+		content, err := os.ReadFile(keysFile)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_SIGNING_KEYS_FILE: %w", err)
+		}
+		keysText += "\n" + string(content)
+	}
+	keys, err := service.ParseTrustedKeys(keysText)
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_SIGNING_KEYS: %w", err)
+	}
+	return keys, nil
+}
+
+// limitsFromEnv reads the upload limits from the environment: UPLOAD_MAX_BYTES,
+// EXTRACT_MAX_BYTES, EXTRACT_MAX_FILE_BYTES, EXTRACT_MAX_ENTRIES,
+// EXTRACT_MAX_PATH_DEPTH and EXTRACT_MAX_RATIO. Unset variables are unlimited.
+func limitsFromEnv() (*service.Limits, error) {
+	var limits service.Limits
+
+	sizes := []struct {
+		name   string
+		target *int64
+	}{
+		{"UPLOAD_MAX_BYTES", &limits.MaxUploadBytes},
+		{"EXTRACT_MAX_BYTES", &limits.MaxExtractedBytes},
+		{"EXTRACT_MAX_FILE_BYTES", &limits.MaxFileBytes},
+	}
+	for _, s := range sizes {
+		if value := os.Getenv(s.name); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%s: invalid byte count '%s'", s.name, value)
+			}
+			*s.target = size
+		}
+	}
+
+	counts := []struct {
+		name   string
+		target *int
+	}{
+		{"EXTRACT_MAX_ENTRIES", &limits.MaxEntries},
+		{"EXTRACT_MAX_PATH_DEPTH", &limits.MaxPathDepth},
+	}
+	for _, c := range counts {
+		if value := os.Getenv(c.name); value != "" {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("%s: invalid count '%s'", c.name, value)
+			}
+			*c.target = count
+		}
+	}
+
+	if value := os.Getenv("EXTRACT_MAX_RATIO"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 1 {
+			return nil, fmt.Errorf("EXTRACT_MAX_RATIO: invalid ratio '%s'", value)
+		}
+		limits.MaxCompressionRatio = ratio
+	}
+	return &limits, nil
+}
+
+// applyServerUploadOptions fills in the server-side upload settings.
+func applyServerUploadOptions(opts *service.UploadOptions) error {
+	modePolicy, err := modePolicyFromEnv()
+	if err != nil {
+		return fmt.Errorf("Invalid extraction mode policy: %w", err)
+	}
+	trustedKeys, err := trustedKeysFromEnv()
+	if err != nil {
+		return fmt.Errorf("Invalid signing key configuration: %w", err)
+	}
+	limits, err := limitsFromEnv()
+	if err != nil {
+		return fmt.Errorf("Invalid upload limits: %w", err)
+	}
+	quotas, err := quotasFromEnv()
+	if err != nil {
+		return fmt.Errorf("Invalid quota configuration: %w", err)
+	}
+	defaultExclude, err := defaultExcludeFromEnv()
+	if err != nil {
+		return fmt.Errorf("Invalid exclude patterns: %w", err)
+	}
+	protect, err := syncProtectFromEnv()
+	if err != nil {
+		return fmt.Errorf("Invalid sync protect patterns: %w", err)
+	}
+	opts.ModePolicy = modePolicy
+	opts.TrustedKeys = trustedKeys
+	opts.Limits = limits
+	opts.Quotas = quotas
+	opts.DefaultExclude = defaultExclude
+	opts.Protect = protect
+	opts.LockDir = os.Getenv("DEPLOY_LOCK_DIR")
+	return nil
+}
+
+// defaultExcludeFromEnv reads the glob patterns excluded from every upload
+// from EXTRACT_EXCLUDE, separated by commas or newlines.
+func defaultExcludeFromEnv() ([]string, error) {
+	patterns, err := service.ParsePatterns(os.Getenv("EXTRACT_EXCLUDE"))
+	if err != nil {
+		return nil, fmt.Errorf("EXTRACT_EXCLUDE: %w", err)
+	}
+	return patterns, nil
+}
+
+// quotasFromEnv reads the directory quotas from QUOTAS, see
+// service.ParseQuotas for the format.
+func quotasFromEnv() ([]service.Quota, error) {
+	quotas, err := service.ParseQuotas(os.Getenv("QUOTAS"))
+	if err != nil {
+		return nil, fmt.Errorf("QUOTAS: %w", err)
+	}
+	return quotas, nil
+}
+
+// syncProtectFromEnv reads the glob patterns that sync uploads never delete
+// from SYNC_PROTECT, separated by commas or newlines.
+func syncProtectFromEnv() ([]string, error) {
+	patterns, err := service.ParsePatterns(os.Getenv("SYNC_PROTECT"))
+	if err != nil {
+		return nil, fmt.Errorf("SYNC_PROTECT: %w", err)
+	}
+	return patterns, nil
+}
+
+// uploadSessionStore returns the store for resumable uploads, kept in
+// UPLOAD_SESSION_DIR or a directory below the system temporary directory.
+func uploadSessionStore() *service.UploadSessionStore {
+	dir := os.Getenv("UPLOAD_SESSION_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "deploytar-uploads")
+	}
+	return service.NewUploadSessionStore(dir)
+}
+
+// idempotencyStore returns the store remembering idempotent uploads, kept in
+// IDEMPOTENCY_DIR or a directory below the system temporary directory.
+func idempotencyStore() *service.IdempotencyStore {
+	dir := os.Getenv("IDEMPOTENCY_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "deploytar-idempotency")
+	}
+	return service.NewIdempotencyStore(dir)
+}
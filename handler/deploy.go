@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"deploytar/service"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+)
+
+// DeployHandler deploys the raw request body to the path following /deploy/.
+// The path is relative to PATH_PREFIX when it is set. Options are read from
+// the query string, and the format from the "format" parameter or from the
+// Content-Type and Content-Encoding headers.
+func DeployHandler(c *echo.Context) error {
+	pathPrefixEnv := os.Getenv("PATH_PREFIX")
+
+	targetPath := strings.Trim(c.Param("*"), "/")
+	if pathPrefixEnv == "" {
+		if targetPath == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Destination directory not specified"})
+		}
+		targetPath = "/" + targetPath
+	} else if targetPath == "" {
+		targetPath = "."
+	}
+
+	var serverOpts service.UploadOptions
+	if err := applyServerUploadOptions(&serverOpts); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	// The body is the upload itself, so options must not be read with
+	// FormValue, which would consume a form encoded body.
+	opts, err := parseUploadOptions(c.QueryParam, serverOpts)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if opts.Format == "" {
+		opts.Format, err = service.FormatForMediaType(c.Request().Header.Get(echo.HeaderContentType), c.Request().Header.Get(echo.HeaderContentEncoding))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	opts.IsPutRequest = c.Request().Method == http.MethodPut
+	opts.Sync = c.Request().Method == http.MethodPatch
+
+	fileName := c.QueryParam("filename")
+	if fileName == "" {
+		fileName = "upload"
+	}
+
+	result, err := idempotencyStore().UploadFile(c.Request().Header.Get(idempotencyKeyHeader), c.Request().Body, targetPath, fileName, pathPrefixEnv, opts)
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, newUploadResponse(result))
+}
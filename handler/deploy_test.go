@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployHandler(t *testing.T) {
+	e := echo.New()
+	e.PUT("/deploy/*", DeployHandler)
+	e.POST("/deploy/*", DeployHandler)
+
+	deploy := func(method, target string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	tarGz := createTestArchive(t, map[string]string{"index.html": "raw"}, nil, "site.tar.gz").Bytes()
+
+	t.Run("content type and encoding", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "site")
+		rec := deploy(http.MethodPut, "/deploy"+targetDir, tarGz, map[string]string{
+			echo.HeaderContentType:     "application/x-tar",
+			echo.HeaderContentEncoding: "gzip",
+		})
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "tar.gz", resp["format"])
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "raw", string(content))
+	})
+
+	t.Run("form encoded body is not parsed", func(t *testing.T) {
+		// curl --data-binary sends this content type by default.
+		targetDir := filepath.Join(t.TempDir(), "site")
+		rec := deploy(http.MethodPut, "/deploy"+targetDir, tarGz, map[string]string{
+			echo.HeaderContentType: echo.MIMEApplicationForm,
+		})
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		_, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("plain file with query options", func(t *testing.T) {
+		targetDir := t.TempDir()
+		rec := deploy(http.MethodPost, "/deploy"+targetDir+"?filename=notes.txt&format=plain", []byte("notes"), nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		content, err := os.ReadFile(filepath.Join(targetDir, "notes.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "notes", string(content))
+	})
+
+	t.Run("path relative to prefix", func(t *testing.T) {
+		prefix := t.TempDir()
+		t.Setenv("PATH_PREFIX", prefix)
+		rec := deploy(http.MethodPut, "/deploy/app", tarGz, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		_, err := os.Stat(filepath.Join(prefix, "app", "index.html"))
+		assert.NoError(t, err)
+
+		rec = deploy(http.MethodPut, "/deploy/../outside", tarGz, nil)
+		assert.NotEqual(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		rec := deploy(http.MethodPut, "/deploy"+t.TempDir(), tarGz, map[string]string{
+			echo.HeaderContentType:     "application/x-tar",
+			echo.HeaderContentEncoding: "br",
+		})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("idempotency key", func(t *testing.T) {
+		t.Setenv("IDEMPOTENCY_DIR", t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		headers := map[string]string{idempotencyKeyHeader: "build-42"}
+		rec := deploy(http.MethodPut, "/deploy"+targetDir+"?format=tar.gz", tarGz, headers)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		require.NoError(t, os.Remove(filepath.Join(targetDir, "index.html")))
+		retry := deploy(http.MethodPut, "/deploy"+targetDir+"?format=tar.gz", tarGz, headers)
+		require.Equal(t, http.StatusOK, retry.Code, retry.Body.String())
+		assert.JSONEq(t, rec.Body.String(), retry.Body.String())
+		_, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		assert.True(t, os.IsNotExist(err), "A retry must not redeploy")
+
+		other := createTestArchive(t, map[string]string{"index.html": "other"}, nil, "site.tar.gz").Bytes()
+		rec = deploy(http.MethodPut, "/deploy"+targetDir+"?format=tar.gz", other, headers)
+		assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	})
+
+	t.Run("locked target", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "site")
+		pr, pw := io.Pipe()
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			req := httptest.NewRequest(http.MethodPut, "/deploy"+targetDir+"/app?format=plain", pr)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			done <- rec
+		}()
+		_, err := pw.Write([]byte("slow"))
+		require.NoError(t, err)
+
+		rec := deploy(http.MethodPut, "/deploy"+targetDir, tarGz, nil)
+		assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+		rec = deploy(http.MethodPut, "/deploy"+targetDir+"?lock_timeout=soon", tarGz, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+		require.NoError(t, pw.Close())
+		first := <-done
+		assert.Equal(t, http.StatusOK, first.Code, first.Body.String())
+		rec = deploy(http.MethodPut, "/deploy"+targetDir+"?lock_timeout=5s", tarGz, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	})
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"deploytar/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+)
+
+// downloadLink returns the /files URL of a file, given by its slash
+// separated path below PATH_PREFIX, or the working directory without it.
+func downloadLink(filePath string) string {
+	return (&url.URL{Path: path.Join("/files", filePath)}).EscapedPath()
+}
+
+// downloadErrorStatus maps an error returned while resolving or opening a
+// download to an HTTP status code.
+func downloadErrorStatus(err error) int {
+	if errors.Is(err, os.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, service.ErrNotRegularFile) {
+		return http.StatusBadRequest
+	}
+	errMsg := err.Error()
+	if strings.Contains(errMsg, "not found") {
+		return http.StatusNotFound
+	}
+	if strings.Contains(errMsg, "is not a directory") {
+		return http.StatusBadRequest
+	}
+	if strings.Contains(errMsg, "forbidden") ||
+		strings.Contains(errMsg, "traversal") ||
+		strings.Contains(errMsg, "outside its allowed scope") ||
+		strings.Contains(errMsg, "outside CWD") ||
+		strings.Contains(errMsg, "outside prefix") {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// DownloadHandler serves the file at the path following /files/, which is
+// relative to PATH_PREFIX, or to the working directory without it. Range
+// requests and conditional requests on the ETag and modification time are
+// supported.
+func DownloadHandler(c *echo.Context) error {
+	f, info, err := service.OpenFile(strings.TrimLeft(c.Param("*"), "/"), os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return c.JSON(downloadErrorStatus(err), map[string]string{"error": err.Error()})
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	c.Response().Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), f)
+	return nil
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadHandler(t *testing.T) {
+	prefix := t.TempDir()
+	t.Setenv("PATH_PREFIX", prefix)
+	require.NoError(t, os.MkdirAll(filepath.Join(prefix, "site", "logs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "site", "index.html"), []byte("<html>home</html>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "site", "logs", "deploy 1.log"), []byte("0123456789"), 0644))
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(prefix, "site", "secret.txt")))
+	require.NoError(t, os.Symlink("index.html", filepath.Join(prefix, "site", "home.html")))
+
+	e := echo.New()
+	e.GET("/files/*", DownloadHandler)
+	e.GET("/list", ListDirectoryHandler)
+	get := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("file with content type and validators", func(t *testing.T) {
+		rec := get("/files/site/index.html", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "<html>home</html>", rec.Body.String())
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		assert.NotEmpty(t, rec.Header().Get(echo.HeaderLastModified))
+		etag := rec.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		rec = get("/files/site/index.html", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		rec = get("/files/site/index.html", map[string]string{echo.HeaderIfModifiedSince: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		rec := get("/files/site/logs/deploy%201.log", map[string]string{"Range": "bytes=2-5"})
+		require.Equal(t, http.StatusPartialContent, rec.Code, rec.Body.String())
+		assert.Equal(t, "2345", rec.Body.String())
+		assert.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+	})
+
+	t.Run("symlink inside the prefix", func(t *testing.T) {
+		rec := get("/files/site/home.html", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "<html>home</html>", rec.Body.String())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get("/files/site/secret.txt", nil).Code, "Symlinks must not escape the prefix")
+		assert.Equal(t, http.StatusForbidden, get("/files/site/../../etc/passwd", nil).Code)
+		assert.Equal(t, http.StatusNotFound, get("/files/site/missing.html", nil).Code)
+		assert.Equal(t, http.StatusBadRequest, get("/files/site/logs", nil).Code)
+	})
+
+	t.Run("download links in listings", func(t *testing.T) {
+		rec := get("/list?d=site/logs", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp DirectoryResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.Entries, 1)
+		assert.Equal(t, "/files/site/logs/deploy%201.log", resp.Entries[0].Download)
+
+		rec = get(resp.Entries[0].Download, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "0123456789", rec.Body.String())
+	})
+}
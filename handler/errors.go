@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"deploytar/service"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadErrorStatus maps an error returned by the upload and release services
+// to an HTTP status code.
+func uploadErrorStatus(err error) int {
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		return http.StatusInsufficientStorage
+	}
+	switch grpcCodeForUploadError(err) {
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.FailedPrecondition, codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// grpcCodeForUploadError maps an error returned by the upload and release
+// services to a gRPC status code.
+func grpcCodeForUploadError(err error) codes.Code {
+	if errors.Is(err, service.ErrIdempotencyKeyReused) {
+		return codes.AlreadyExists
+	}
+	if errors.Is(err, service.ErrTargetLocked) {
+		return codes.Aborted
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, service.ErrLimitExceeded) ||
+		errors.Is(err, service.ErrQuotaExceeded) ||
+		errors.As(err, &maxBytesErr) {
+		return codes.ResourceExhausted
+	}
+	if errors.Is(err, service.ErrReleaseNotFound) ||
+		errors.Is(err, service.ErrUploadSessionNotFound) {
+		return codes.NotFound
+	}
+	if errors.Is(err, service.ErrUploadOffsetMismatch) ||
+		errors.Is(err, service.ErrUploadIncomplete) ||
+		errors.Is(err, service.ErrProtectedEntry) {
+		return codes.FailedPrecondition
+	}
+	if errors.Is(err, service.ErrSignatureRequired) ||
+		errors.Is(err, service.ErrInvalidSignature) {
+		return codes.PermissionDenied
+	}
+	if errors.Is(err, service.ErrInvalidRelease) ||
+		errors.Is(err, service.ErrUnsupportedFormat) ||
+		errors.Is(err, service.ErrInvalidChecksum) ||
+		errors.Is(err, service.ErrChecksumMismatch) ||
+		errors.Is(err, service.ErrUploadTooLarge) ||
+		errors.Is(err, service.ErrInvalidUploadSession) ||
+		errors.Is(err, service.ErrNoUploadParts) ||
+		errors.Is(err, service.ErrInvalidEntryFilter) ||
+		errors.Is(err, service.ErrInvalidIdempotencyKey) {
+		return codes.InvalidArgument
+	}
+
+	errMsg := err.Error()
+	if strings.Contains(errMsg, "forbidden") ||
+		strings.Contains(errMsg, "traversal") ||
+		strings.Contains(errMsg, "outside the scope") ||
+		strings.Contains(errMsg, "unsafe path") ||
+		strings.Contains(errMsg, "cannot be a path traversal attempt") {
+		return codes.PermissionDenied
+	}
+	if strings.Contains(errMsg, "not found") ||
+		strings.Contains(errMsg, "does not exist") {
+		return codes.NotFound
+	}
+	if strings.Contains(errMsg, "archive") ||
+		strings.Contains(errMsg, "gzipped content") ||
+		strings.Contains(errMsg, "file content") ||
+		strings.Contains(errMsg, "reader for") ||
+		strings.Contains(errMsg, "is not a directory") {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+// grpcPathError maps an error resolving or reading a path below PATH_PREFIX
+// to a gRPC status for ListDirectory and the download handlers. Errors that
+// match no rule are internal and their message is prefixed with
+// internalContext.
+func grpcPathError(err error, internalContext string) error {
+	errMsg := err.Error()
+	if errors.Is(err, os.ErrNotExist) || strings.Contains(errMsg, "not found") {
+		return status.Error(codes.NotFound, errMsg)
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return status.Error(codes.PermissionDenied, errMsg)
+	}
+	if errors.Is(err, service.ErrNotRegularFile) ||
+		errors.Is(err, service.ErrUnsupportedFormat) ||
+		strings.Contains(errMsg, "is not a directory") {
+		return status.Error(codes.InvalidArgument, errMsg)
+	}
+	if strings.Contains(errMsg, "forbidden") ||
+		strings.Contains(errMsg, "traversal") ||
+		strings.Contains(errMsg, "outside its allowed scope") ||
+		strings.Contains(errMsg, "outside CWD") ||
+		strings.Contains(errMsg, "outside prefix") {
+		return status.Error(codes.PermissionDenied, errMsg)
+	}
+	return status.Error(codes.Internal, internalContext+": "+errMsg)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"deploytar/service"
+	"encoding/hex"
+	"io"
+	"os"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// downloadChunkSize is the size of the chunks downloads are streamed in.
+const downloadChunkSize = 64 * 1024
+
+// DownloadFile streams a file, starting with its metadata. offset and length
+// select a part of the file; the digest always covers the whole file.
+func (s *GRPCListDirectoryServer) DownloadFile(req *pb.DownloadFileRequest, stream pb.FileService_DownloadFileServer) error {
+	if req.GetPath() == "" {
+		return status.Error(codes.InvalidArgument, "Path is required")
+	}
+	if req.GetOffset() < 0 || req.GetLength() < 0 {
+		return status.Error(codes.InvalidArgument, "Offset and length must not be negative")
+	}
+
+	f, info, err := service.OpenFile(req.GetPath(), os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return grpcPathError(err, "Internal server error during path validation")
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	offset, length := req.GetOffset(), req.GetLength()
+	if offset > info.Size() {
+		return status.Errorf(codes.OutOfRange, "Offset %d is past the end of the file (%d bytes)", offset, info.Size())
+	}
+	if length == 0 || length > info.Size()-offset {
+		length = info.Size() - offset
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, info.Size())); err != nil {
+		return grpcPathError(err, "Failed to read file")
+	}
+	name := info.Name()
+	size := info.Size()
+	mode := uint32(info.Mode().Perm())
+	modTime := info.ModTime().Unix()
+	digest := hex.EncodeToString(h.Sum(nil))
+	metadata := &pb.FileMetadata{
+		Name:    &name,
+		Size:    &size,
+		Mode:    &mode,
+		ModTime: &modTime,
+		Sha256:  &digest,
+		Offset:  &offset,
+		Length:  &length,
+	}
+	if err := stream.Send(&pb.DownloadFileResponse{Data: &pb.DownloadFileResponse_Metadata{Metadata: metadata}}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, downloadChunkSize)
+	section := io.NewSectionReader(f, offset, length)
+	for {
+		n, err := section.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&pb.DownloadFileResponse{Data: &pb.DownloadFileResponse_ChunkData{ChunkData: buf[:n]}}); sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return grpcPathError(err, "Failed to read file")
+		}
+	}
+}
+
+// archiveChunkWriter sends the bytes written to it as archive chunks.
+type archiveChunkWriter struct {
+	stream pb.FileService_DownloadArchiveServer
+}
+
+func (w archiveChunkWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&pb.DownloadArchiveResponse{ChunkData: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// DownloadArchive streams a directory as an archive, like GET /archive.
+func (s *GRPCListDirectoryServer) DownloadArchive(req *pb.DownloadArchiveRequest, stream pb.FileService_DownloadArchiveServer) error {
+	format, err := service.ParseArchiveFormat(req.GetFormat())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	dir, _, err := service.ResolveDirectory(req.GetDirectory(), os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return grpcPathError(err, "Internal server error during path validation")
+	}
+
+	chunks := bufio.NewWriterSize(archiveChunkWriter{stream: stream}, downloadChunkSize)
+	if err := service.WriteArchive(chunks, dir, format); err != nil {
+		if stream.Context().Err() != nil {
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		return grpcPathError(err, "Failed to write archive")
+	}
+	if err := chunks.Flush(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCDownloadFile(t *testing.T) {
+	prefix := t.TempDir()
+	t.Setenv("PATH_PREFIX", prefix)
+	content := strings.Repeat("0123456789", 10000)
+	require.NoError(t, os.MkdirAll(filepath.Join(prefix, "logs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "logs", "deploy.log"), []byte(content), 0640))
+	require.NoError(t, os.Symlink(t.TempDir(), filepath.Join(prefix, "outside")))
+
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	download := func(path string, offset, length int64) (*pb.FileMetadata, string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stream, err := client.DownloadFile(ctx, &pb.DownloadFileRequest{Path: &path, Offset: &offset, Length: &length})
+		require.NoError(t, err)
+		var metadata *pb.FileMetadata
+		var data bytes.Buffer
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return metadata, data.String(), nil
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if resp.GetMetadata() != nil {
+				metadata = resp.GetMetadata()
+			}
+			data.Write(resp.GetChunkData())
+		}
+	}
+
+	metadata, data, err := download("logs/deploy.log", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+	require.NotNil(t, metadata)
+	sum := sha256.Sum256([]byte(content))
+	assert.Equal(t, "deploy.log", metadata.GetName())
+	assert.Equal(t, int64(len(content)), metadata.GetSize())
+	assert.Equal(t, uint32(0640), metadata.GetMode())
+	assert.NotZero(t, metadata.GetModTime())
+	assert.Equal(t, hex.EncodeToString(sum[:]), metadata.GetSha256())
+	assert.Equal(t, int64(len(content)), metadata.GetLength())
+
+	metadata, data, err = download("logs/deploy.log", 99995, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "56789", data, "The length should be clamped to the end of the file")
+	assert.Equal(t, int64(99995), metadata.GetOffset())
+	assert.Equal(t, int64(5), metadata.GetLength())
+	assert.Equal(t, hex.EncodeToString(sum[:]), metadata.GetSha256())
+
+	for _, tc := range []struct {
+		path   string
+		offset int64
+		code   codes.Code
+	}{
+		{"logs/missing.log", 0, codes.NotFound},
+		{"logs", 0, codes.InvalidArgument},
+		{"../etc/passwd", 0, codes.PermissionDenied},
+		{"outside", 0, codes.PermissionDenied},
+		{"logs/deploy.log", -1, codes.InvalidArgument},
+		{"logs/deploy.log", int64(len(content)) + 1, codes.OutOfRange},
+	} {
+		_, _, err := download(tc.path, tc.offset, 0)
+		require.Error(t, err, tc.path)
+		assert.Equal(t, tc.code, status.Code(err), tc.path)
+	}
+}
+
+func TestGRPCDownloadArchive(t *testing.T) {
+	prefix := t.TempDir()
+	t.Setenv("PATH_PREFIX", prefix)
+	require.NoError(t, os.MkdirAll(filepath.Join(prefix, "site", "css"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "site", "index.html"), []byte("home"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "site", "css", "app.css"), []byte("body{}"), 0644))
+
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	download := func(dir, format string) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stream, err := client.DownloadArchive(ctx, &pb.DownloadArchiveRequest{Directory: &dir, Format: &format})
+		require.NoError(t, err)
+		var data bytes.Buffer
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return data.Bytes(), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			data.Write(resp.GetChunkData())
+		}
+	}
+
+	data, err := download("site", "")
+	require.NoError(t, err)
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	contents := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		contents[header.Name] = string(content)
+	}
+	var names []string
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"css/", "css/app.css", "index.html"}, names)
+	assert.Equal(t, "home", contents["index.html"])
+
+	_, err = download("site", "rar")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = download("site/index.html", "tar")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = download("missing", "tar")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = download("../", "tar")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
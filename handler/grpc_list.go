@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strings"
 
 	pb "deploytar/proto/deploytar/proto/fileservice/v1"
 
@@ -31,21 +30,7 @@ func (s *GRPCListDirectoryServer) ListDirectory(ctx context.Context, req *pb.Lis
 
 	validatedAbsPath, displayPathFromService, err := service.ResolveAndValidatePath(rawQuerySubDir, pathPrefixEnv)
 	if err != nil {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "not found") {
-			return nil, status.Error(codes.NotFound, errMsg)
-		}
-		if strings.Contains(errMsg, "is not a directory") {
-			return nil, status.Error(codes.InvalidArgument, errMsg)
-		}
-		if strings.Contains(errMsg, "forbidden") ||
-			strings.Contains(errMsg, "traversal") ||
-			strings.Contains(errMsg, "outside its allowed scope") ||
-			strings.Contains(errMsg, "outside CWD") ||
-			strings.Contains(errMsg, "outside prefix") {
-			return nil, status.Error(codes.PermissionDenied, errMsg)
-		}
-		return nil, status.Error(codes.Internal, "Internal server error during path validation: "+errMsg)
+		return nil, grpcPathError(err, "Internal server error during path validation")
 	}
 
 	serviceEntries, serviceParentLink, err := service.ListDirectory(validatedAbsPath, rawQuerySubDir)
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"deploytar/service"
+	"os"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *GRPCListDirectoryServer) GetQuotaUsage(ctx context.Context, req *pb.GetQuotaUsageRequest) (*pb.GetQuotaUsageResponse, error) {
+	quotas, err := quotasFromEnv()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Invalid quota configuration: %v", err)
+	}
+
+	usages, err := service.QuotaUsages(quotas, os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to measure quota usage: %v", err)
+	}
+
+	response := &pb.GetQuotaUsageResponse{}
+	for _, u := range usages {
+		pattern := u.Pattern
+		usagePath := u.Path
+		bytesUsed := u.Bytes
+		inodesUsed := u.Inodes
+		maxBytes := u.MaxBytes
+		maxInodes := u.MaxInodes
+		response.Quotas = append(response.Quotas, &pb.QuotaUsage{
+			Pattern:   &pattern,
+			Path:      &usagePath,
+			Bytes:     &bytesUsed,
+			Inodes:    &inodesUsed,
+			MaxBytes:  &maxBytes,
+			MaxInodes: &maxInodes,
+		})
+	}
+	return response, nil
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCQuotas(t *testing.T) {
+	prefix := t.TempDir()
+	t.Setenv("PATH_PREFIX", prefix)
+	t.Setenv("QUOTAS", "* inodes=3")
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(prefix, "team-a")
+	fileName := "notes.txt"
+	_, err := sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName}, []byte("notes"))
+	require.NoError(t, err)
+
+	archivePath := createTestTarArchive(t, t.TempDir(), "many.tar", map[string]string{"a": "a", "b": "b", "c": "c"})
+	archiveBytes, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	_, err = sendFileAsStream(t, client, filepath.Join(targetDir, "many"), "many.tar", archiveBytes)
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "quota exceeded")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := client.GetQuotaUsage(ctx, &pb.GetQuotaUsageRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetQuotas(), 1)
+	assert.Equal(t, targetDir, resp.GetQuotas()[0].GetPath())
+	assert.Equal(t, int64(2), resp.GetQuotas()[0].GetInodes())
+	assert.Equal(t, int64(3), resp.GetQuotas()[0].GetMaxInodes())
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"deploytar/service"
+	"fmt"
+	"os"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func grpcReleaseError(err error) error {
+	code := grpcCodeForUploadError(err)
+	if code == codes.Internal {
+		return status.Error(codes.Internal, "Failed to process release request: "+err.Error())
+	}
+	return status.Error(code, err.Error())
+}
+
+func (s *GRPCListDirectoryServer) ListReleases(ctx context.Context, req *pb.ListReleasesRequest) (*pb.ListReleasesResponse, error) {
+	if req.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Target path is required")
+	}
+
+	releases, err := service.ListReleases(req.GetPath(), os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return nil, grpcReleaseError(err)
+	}
+
+	response := &pb.ListReleasesResponse{}
+	for _, r := range releases {
+		releaseID := r.ID
+		releasePath := r.Path
+		isCurrent := r.Current
+		response.Releases = append(response.Releases, &pb.Release{
+			Id:      &releaseID,
+			Path:    &releasePath,
+			Current: &isCurrent,
+		})
+		if r.Current {
+			response.Current = &releaseID
+		}
+	}
+	return response, nil
+}
+
+func (s *GRPCListDirectoryServer) RollbackRelease(ctx context.Context, req *pb.RollbackReleaseRequest) (*pb.RollbackReleaseResponse, error) {
+	if req.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Target path is required")
+	}
+	if req.GetReleaseId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Release ID is required")
+	}
+
+	lockOpts, err := releaseLockOptions(req.GetLockTimeout())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	release, err := service.RollbackRelease(req.GetPath(), os.Getenv("PATH_PREFIX"), req.GetReleaseId(), lockOpts)
+	if err != nil {
+		return nil, grpcReleaseError(err)
+	}
+
+	msg := fmt.Sprintf("Rolled back to release %s", release.ID)
+	return &pb.RollbackReleaseResponse{
+		Message: &msg,
+		Current: &release.ID,
+	}, nil
+}
+
+func (s *GRPCListDirectoryServer) PruneReleases(ctx context.Context, req *pb.PruneReleasesRequest) (*pb.PruneReleasesResponse, error) {
+	if req.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Target path is required")
+	}
+
+	lockOpts, err := releaseLockOptions(req.GetLockTimeout())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	removed, err := service.PruneReleases(req.GetPath(), os.Getenv("PATH_PREFIX"), int(req.GetKeep()), lockOpts)
+	if err != nil {
+		return nil, grpcReleaseError(err)
+	}
+	return &pb.PruneReleasesResponse{Removed: removed}, nil
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCReleases(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "app")
+	sourceDir := t.TempDir()
+	upload := func(content string) string {
+		archivePath := createTestTarArchive(t, sourceDir, "site.tar", map[string]string{"index.html": content})
+		archiveBytes, err := os.ReadFile(archivePath)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stream, err := client.UploadFile(ctx)
+		require.NoError(t, err)
+		fileName := "site.tar"
+		release := true
+		require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_Info{Info: &pb.FileInfo{Path: &targetDir, Filename: &fileName, Release: &release}}}))
+		require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_ChunkData{ChunkData: archiveBytes}}))
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.GetReleaseId())
+		return resp.GetReleaseId()
+	}
+
+	firstID := upload("v1")
+	secondID := upload("v2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	listResp, err := client.ListReleases(ctx, &pb.ListReleasesRequest{Path: &targetDir})
+	require.NoError(t, err)
+	require.Len(t, listResp.GetReleases(), 2)
+	assert.Equal(t, secondID, listResp.GetCurrent())
+
+	rollbackResp, err := client.RollbackRelease(ctx, &pb.RollbackReleaseRequest{Path: &targetDir, ReleaseId: &firstID})
+	require.NoError(t, err)
+	assert.Equal(t, firstID, rollbackResp.GetCurrent())
+	content, err := os.ReadFile(filepath.Join(targetDir, "current", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	unknownID := "19700101000000"
+	_, err = client.RollbackRelease(ctx, &pb.RollbackReleaseRequest{Path: &targetDir, ReleaseId: &unknownID})
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+
+	thirdID := upload("v3")
+	_, err = client.RollbackRelease(ctx, &pb.RollbackReleaseRequest{Path: &targetDir, ReleaseId: &firstID})
+	require.NoError(t, err)
+
+	keep := int32(1)
+	pruneResp, err := client.PruneReleases(ctx, &pb.PruneReleasesRequest{Path: &targetDir, Keep: &keep})
+	require.NoError(t, err)
+	assert.Equal(t, []string{secondID}, pruneResp.GetRemoved())
+
+	listResp, err = client.ListReleases(ctx, &pb.ListReleasesRequest{Path: &targetDir})
+	require.NoError(t, err)
+	require.Len(t, listResp.GetReleases(), 2)
+	assert.Equal(t, thirdID, listResp.GetReleases()[1].GetId())
+}
@@ -1,15 +1,16 @@
 package handler
 
 import (
+	"context"
 	"deploytar/service"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	pb "deploytar/proto/deploytar/proto/fileservice/v1"
 
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -36,95 +37,177 @@ func (s *GRPCListDirectoryServer) UploadFile(stream pb.FileService_UploadFileSer
 	targetDirUserPath := fileInfo.GetPath()
 	fileName := fileInfo.GetFilename()
 	pathPrefixEnv := os.Getenv("PATH_PREFIX")
-
-	tempFile, err := os.CreateTemp("", "grpc-upload-*.tmp")
+	opts, err := uploadOptionsFromFileInfo(fileInfo)
 	if err != nil {
-		return status.Errorf(codes.Internal, "Failed to create temporary file: %v", err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := applyServerUploadOptions(&opts); err != nil {
+		return status.Error(codes.Internal, err.Error())
 	}
 
-	defer func() {
-		if err := os.Remove(tempFile.Name()); err != nil {
-			_ = err
+	// Chunks are piped straight into the extractor, so extraction starts with
+	// the first chunk and nothing is spooled to a temporary file, unless an
+	// idempotency key requires the upload to be fingerprinted first.
+	pr, pw := io.Pipe()
+	recvErr := make(chan error, 1)
+	go receiveUploadChunks(stream, pw, recvErr)
+
+	result, serviceErr := idempotencyStore().UploadFile(idempotencyKeyFromContext(stream.Context()), pr, targetDirUserPath, fileName, pathPrefixEnv, opts)
+	// Unblocks the receiver when the upload failed before reading the whole
+	// stream.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if serviceErr != nil {
+		// A failed receive, such as a cancelled client, explains why the
+		// upload failed better than the resulting read error does.
+		select {
+		case err := <-recvErr:
+			if err != nil {
+				return err
+			}
+		default:
 		}
-	}()
+		return grpcUploadError(serviceErr)
+	}
+	if err := <-recvErr; err != nil {
+		return err
+	}
+	return stream.SendAndClose(newUploadFileResponse(fileName, result))
+}
+
+// idempotencyKeyFromContext returns the idempotency key sent in the
+// "idempotency-key" request metadata, the gRPC counterpart of the
+// Idempotency-Key header.
+func idempotencyKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get("idempotency-key"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
 
+// uploadOptionsFromFileInfo returns the client supplied upload options of
+// fileInfo, shared by streamed and resumable uploads.
+func uploadOptionsFromFileInfo(fileInfo *pb.FileInfo) (service.UploadOptions, error) {
+	format, err := service.ParseFormat(fileInfo.GetFormat())
+	if err != nil {
+		return service.UploadOptions{}, err
+	}
+	lockTimeout, err := parseLockTimeout(fileInfo.GetLockTimeout())
+	if err != nil {
+		return service.UploadOptions{}, err
+	}
+	return service.UploadOptions{
+		IsPutRequest:    true,
+		Sync:            fileInfo.GetSync(),
+		DryRun:          fileInfo.GetDryRun(),
+		Release:         fileInfo.GetRelease(),
+		Format:          format,
+		StripComponents: int(fileInfo.GetStripComponents()),
+		Subpath:         fileInfo.GetSubpath(),
+		Include:         fileInfo.GetInclude(),
+		Exclude:         fileInfo.GetExclude(),
+		SHA256:          fileInfo.GetSha256(),
+		SHA512:          fileInfo.GetSha512(),
+		Signature:       fileInfo.GetSignature(),
+		LockTimeout:     lockTimeout,
+	}, nil
+}
+
+// receiveUploadChunks writes the chunks of an upload stream to pw. The
+// outcome is sent on done before pw is closed, so that it is available by the
+// time the reader observes the end of the stream.
+func receiveUploadChunks(stream pb.FileService_UploadFileServer, pw *io.PipeWriter, done chan<- error) {
+	fail := func(err error) {
+		done <- err
+		pw.CloseWithError(err)
+	}
 	for {
 		chunkReq, err := stream.Recv()
 		if err == io.EOF {
-			break
+			done <- nil
+			if cerr := pw.Close(); cerr != nil {
+				_ = cerr
+			}
+			return
 		}
 		if err != nil {
-			if cerr := tempFile.Close(); cerr != nil {
-				_ = cerr
+			if ctxErr := stream.Context().Err(); ctxErr != nil {
+				fail(status.FromContextError(ctxErr).Err())
+				return
 			}
-			return status.Errorf(codes.Internal, "Failed to receive file chunk: %v", err)
+			fail(status.Errorf(codes.Internal, "Failed to receive file chunk: %v", err))
+			return
 		}
 
 		if chunkReq.GetInfo() != nil {
-			if cerr := tempFile.Close(); cerr != nil {
-				_ = cerr
-			}
-			return status.Error(codes.InvalidArgument, "Received FileInfo message after the first one")
+			fail(status.Error(codes.InvalidArgument, "Received FileInfo message after the first one"))
+			return
 		}
 
-		chunkData := chunkReq.GetChunkData()
-		if _, err := tempFile.Write(chunkData); err != nil {
-			if cerr := tempFile.Close(); cerr != nil {
-				_ = cerr
-			}
-			return status.Errorf(codes.Internal, "Failed to write to temporary file: %v", err)
+		if _, err := pw.Write(chunkReq.GetChunkData()); err != nil {
+			// The reader stopped early and reports its own error.
+			done <- nil
+			return
 		}
 	}
+}
+func grpcUploadError(err error) error {
+	code := grpcCodeForUploadError(err)
+	if code == codes.Internal {
+		return status.Error(codes.Internal, "Failed to process file upload: "+err.Error())
+	}
+	return status.Error(code, err.Error())
+}
 
-	if err := tempFile.Sync(); err != nil {
-		if cerr := tempFile.Close(); cerr != nil {
-			_ = cerr
-		}
-		return status.Errorf(codes.Internal, "Failed to sync temporary file: %v", err)
+func newUploadFileResponse(fileName string, result *service.UploadResult) *pb.UploadFileResponse {
+	msg := fmt.Sprintf("File '%s' processed successfully, final path: %s", fileName, result.Path)
+	finalPathProto := result.Path
+	formatProto := string(result.Format)
+
+	response := &pb.UploadFileResponse{
+		Message:  &msg,
+		FilePath: &finalPathProto,
+		Format:   &formatProto,
+		Sha256:   &result.SHA256,
+		Sha512:   &result.SHA512,
 	}
-	if err := tempFile.Close(); err != nil {
-		return status.Errorf(codes.Internal, "Failed to close temporary file before processing: %v", err)
+	if result.ReleaseID != "" {
+		response.ReleaseId = &result.ReleaseID
 	}
-
-	readOnlyTempFile, err := os.Open(tempFile.Name())
-	if err != nil {
-		return status.Errorf(codes.Internal, "Failed to re-open temporary file for reading: %v", err)
+	for _, entry := range result.Skipped {
+		response.Skipped = append(response.Skipped, &pb.SkippedEntry{
+			Name:   &entry.Name,
+			Reason: &entry.Reason,
+		})
 	}
-	defer func() {
-		if err := readOnlyTempFile.Close(); err != nil {
-			_ = err
-		}
-	}()
+	if result.Diff != nil {
+		msg = fmt.Sprintf("Dry run of '%s': %d added, %d modified, %d deleted, %d unchanged", fileName, len(result.Diff.Added), len(result.Diff.Modified), len(result.Diff.Deleted), len(result.Diff.Unchanged))
+		response.Diff = newUploadDiffProto(result.Diff)
+	}
+	return response
+}
 
-	finalPath, serviceErr := service.UploadFile(readOnlyTempFile, targetDirUserPath, fileName, pathPrefixEnv, true)
-	if serviceErr != nil {
-		errMsg := serviceErr.Error()
-		if strings.Contains(errMsg, "forbidden") ||
-			strings.Contains(errMsg, "traversal") ||
-			strings.Contains(errMsg, "outside the scope") ||
-			strings.Contains(errMsg, "unsafe path") ||
-			strings.Contains(errMsg, "cannot be a path traversal attempt") {
-			return status.Error(codes.PermissionDenied, errMsg)
-		}
-		if strings.Contains(errMsg, "not found") ||
-			strings.Contains(errMsg, "does not exist") {
-			return status.Error(codes.NotFound, errMsg)
-		}
-		if strings.Contains(errMsg, "archive") ||
-			strings.Contains(errMsg, "gzipped content") ||
-			strings.Contains(errMsg, "file content") ||
-			strings.Contains(errMsg, "Failed to create gzip reader") ||
-			strings.Contains(errMsg, "is not a directory") {
-			return status.Error(codes.InvalidArgument, errMsg)
+func newUploadDiffProto(diff *service.UploadDiff) *pb.UploadDiff {
+	convert := func(entries []service.DiffEntry) []*pb.DiffEntry {
+		var converted []*pb.DiffEntry
+		for _, entry := range entries {
+			converted = append(converted, &pb.DiffEntry{
+				Path:           &entry.Path,
+				Size:           &entry.Size,
+				Sha256:         &entry.SHA256,
+				PreviousSize:   &entry.PreviousSize,
+				PreviousSha256: &entry.PreviousSHA256,
+			})
 		}
-		return status.Error(codes.Internal, "Failed to process file upload: "+errMsg)
+		return converted
+	}
+	return &pb.UploadDiff{
+		Added:     convert(diff.Added),
+		Modified:  convert(diff.Modified),
+		Deleted:   convert(diff.Deleted),
+		Unchanged: convert(diff.Unchanged),
 	}
-
-	msg := fmt.Sprintf("File '%s' processed successfully, final path: %s", fileName, finalPath)
-	finalPathProto := finalPath
-
-	return stream.SendAndClose(&pb.UploadFileResponse{
-		Message:  &msg,
-		FilePath: &finalPathProto,
-	})
 }
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"deploytar/service"
+	"io"
+	"os"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newUploadSessionResponse(id string, offset, length int64) *pb.UploadSessionResponse {
+	return &pb.UploadSessionResponse{
+		SessionId: &id,
+		Offset:    &offset,
+		Length:    &length,
+	}
+}
+
+func (s *GRPCListDirectoryServer) CreateUploadSession(ctx context.Context, req *pb.CreateUploadSessionRequest) (*pb.UploadSessionResponse, error) {
+	fileInfo := req.GetInfo()
+	if fileInfo == nil {
+		return nil, status.Error(codes.InvalidArgument, "FileInfo is required")
+	}
+	if fileInfo.GetFilename() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Filename is required in FileInfo")
+	}
+	if fileInfo.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Target path is required in FileInfo")
+	}
+	opts, err := uploadOptionsFromFileInfo(fileInfo)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	length := int64(-1)
+	if req.Length != nil {
+		length = req.GetLength()
+	}
+	if err := applyServerUploadOptions(&opts); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	session, err := uploadSessionStore().Create(fileInfo.GetPath(), fileInfo.GetFilename(), os.Getenv("PATH_PREFIX"), length, opts)
+	if err != nil {
+		return nil, grpcUploadError(err)
+	}
+	return newUploadSessionResponse(session.ID, session.Offset, session.Length), nil
+}
+
+func (s *GRPCListDirectoryServer) GetUploadSession(ctx context.Context, req *pb.GetUploadSessionRequest) (*pb.UploadSessionResponse, error) {
+	session, err := uploadSessionStore().Get(req.GetSessionId())
+	if err != nil {
+		return nil, grpcUploadError(err)
+	}
+	return newUploadSessionResponse(session.ID, session.Offset, session.Length), nil
+}
+
+// ResumeUpload appends the streamed chunks to a session, starting at the
+// offset named in the first message. The whole stream is written as one
+// append, so the session file is opened and synced once rather than for
+// every chunk. Chunks received before the stream breaks are kept;
+// GetUploadSession reports where to continue.
+func (s *GRPCListDirectoryServer) ResumeUpload(stream pb.FileService_ResumeUploadServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return status.Error(codes.InvalidArgument, "No ResumeInfo received")
+		}
+		return status.Errorf(codes.Internal, "Failed to receive initial request: %v", err)
+	}
+	resumeInfo := req.GetInfo()
+	if resumeInfo == nil {
+		return status.Error(codes.InvalidArgument, "Missing ResumeInfo in the first message")
+	}
+
+	limits, err := limitsFromEnv()
+	if err != nil {
+		return status.Errorf(codes.Internal, "Invalid upload limits: %v", err)
+	}
+
+	store := uploadSessionStore()
+	session, err := store.Get(resumeInfo.GetSessionId())
+	if err != nil {
+		return grpcUploadError(err)
+	}
+
+	chunks := &resumeChunkReader{stream: stream}
+	offset, err := store.Append(session.ID, resumeInfo.GetOffset(), chunks, limits.MaxUploadBytes)
+	if err != nil {
+		// A failed receive explains why the append failed better than the
+		// resulting read error does.
+		if chunks.err != nil {
+			return chunks.err
+		}
+		return grpcUploadError(err)
+	}
+	return stream.SendAndClose(newUploadSessionResponse(session.ID, offset, session.Length))
+}
+
+// resumeChunkReader reads the chunk data of a ResumeUpload stream. err holds
+// the gRPC error of a receive that failed.
+type resumeChunkReader struct {
+	stream pb.FileService_ResumeUploadServer
+	chunk  []byte
+	err    error
+}
+
+func (r *resumeChunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		chunkReq, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			if ctxErr := r.stream.Context().Err(); ctxErr != nil {
+				r.err = status.FromContextError(ctxErr).Err()
+			} else {
+				r.err = status.Errorf(codes.Internal, "Failed to receive file chunk: %v", err)
+			}
+			return 0, r.err
+		}
+		if chunkReq.GetInfo() != nil {
+			r.err = status.Error(codes.InvalidArgument, "Received ResumeInfo message after the first one")
+			return 0, r.err
+		}
+		r.chunk = chunkReq.GetChunkData()
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (s *GRPCListDirectoryServer) FinalizeUploadSession(ctx context.Context, req *pb.FinalizeUploadSessionRequest) (*pb.UploadFileResponse, error) {
+	store := uploadSessionStore()
+	session, err := store.Get(req.GetSessionId())
+	if err != nil {
+		return nil, grpcUploadError(err)
+	}
+
+	var serverOpts service.UploadOptions
+	if err := applyServerUploadOptions(&serverOpts); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	result, err := store.Finalize(session.ID, os.Getenv("PATH_PREFIX"), serverOpts, idempotencyStore(), idempotencyKeyFromContext(ctx))
+	if err != nil {
+		return nil, grpcUploadError(err)
+	}
+	return newUploadFileResponse(session.FileName, result), nil
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "deploytar/proto/deploytar/proto/fileservice/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCUploadSessions(t *testing.T) {
+	t.Setenv("UPLOAD_SESSION_DIR", t.TempDir())
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	archivePath := createTestTgzArchive(t, t.TempDir(), "site.tgz", map[string]string{"index.html": "resumed"})
+	archiveBytes, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	half := int64(len(archiveBytes) / 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	targetDir := filepath.Join(t.TempDir(), "site")
+	fileName := "site.tgz"
+	length := int64(len(archiveBytes))
+	session, err := client.CreateUploadSession(ctx, &pb.CreateUploadSessionRequest{
+		Info:   &pb.FileInfo{Path: &targetDir, Filename: &fileName},
+		Length: &length,
+	})
+	require.NoError(t, err)
+	sessionID := session.GetSessionId()
+	require.NotEmpty(t, sessionID)
+
+	// resume sends data in several small chunks, which are appended as one.
+	resume := func(offset int64, data []byte) (*pb.UploadSessionResponse, error) {
+		stream, err := client.ResumeUpload(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&pb.ResumeUploadRequest{Data: &pb.ResumeUploadRequest_Info{Info: &pb.ResumeInfo{SessionId: &sessionID, Offset: &offset}}}))
+		for len(data) > 0 {
+			chunk := data[:min(16, len(data))]
+			data = data[len(chunk):]
+			// Sending fails once the server rejected the stream, whose
+			// status CloseAndRecv reports.
+			if err := stream.Send(&pb.ResumeUploadRequest{Data: &pb.ResumeUploadRequest_ChunkData{ChunkData: chunk}}); err != nil {
+				break
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+
+	resp, err := resume(0, archiveBytes[:half])
+	require.NoError(t, err)
+	assert.Equal(t, half, resp.GetOffset())
+
+	_, err = resume(0, archiveBytes)
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	getResp, err := client.GetUploadSession(ctx, &pb.GetUploadSessionRequest{SessionId: &sessionID})
+	require.NoError(t, err)
+	assert.Equal(t, half, getResp.GetOffset())
+	assert.Equal(t, length, getResp.GetLength())
+
+	_, err = resume(getResp.GetOffset(), archiveBytes[half:])
+	require.NoError(t, err)
+
+	finalResp, err := client.FinalizeUploadSession(ctx, &pb.FinalizeUploadSessionRequest{SessionId: &sessionID})
+	require.NoError(t, err)
+	assert.Equal(t, "tar.gz", finalResp.GetFormat())
+	content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "resumed", string(content))
+
+	_, err = client.GetUploadSession(ctx, &pb.GetUploadSessionRequest{SessionId: &sessionID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
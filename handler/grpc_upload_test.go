@@ -2,9 +2,12 @@ package handler
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"net"
 	"os"
@@ -20,6 +23,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -884,3 +888,227 @@ func TestUploadFile_TgzFile_CorruptTarData(t *testing.T) {
 	items, _ := os.ReadDir(targetDir)
 	assert.Len(t, items, 0, "Target directory should be empty after failed corrupt tgz processing.")
 }
+
+func TestUploadFile_ZipArchive(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "zip_dest")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("dir_in_zip/file.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("Zip content"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	resp, err := sendFileAsStream(t, client, targetDir, "bundle.zip", buf.Bytes())
+	require.NoError(t, err)
+	require.NotNil(t, resp.FilePath)
+	assert.Equal(t, filepath.Clean(targetDir), filepath.Clean(*resp.FilePath))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "dir_in_zip", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Zip content", string(content))
+}
+
+func sendFileInfoAndContent(t *testing.T, client pb.FileServiceClient, info *pb.FileInfo, content []byte) (*pb.UploadFileResponse, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.UploadFile(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_Info{Info: info}}))
+	require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_ChunkData{ChunkData: content}}))
+	return stream.CloseAndRecv()
+}
+
+func TestUploadFile_Checksums(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "checksum_dest")
+	fileName := "notes.txt"
+	content := []byte("checksummed content")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	resp, err := sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName, Sha256: &digest}, content)
+	require.NoError(t, err)
+	assert.Equal(t, digest, resp.GetSha256())
+	assert.Len(t, resp.GetSha512(), 128)
+
+	wrongDigest := strings.Repeat("ab", 32)
+	otherName := "other.txt"
+	_, err = sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &otherName, Sha256: &wrongDigest}, content)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, statErr := os.Stat(filepath.Join(targetDir, otherName))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestUploadFile_UploadLimit(t *testing.T) {
+	t.Setenv("UPLOAD_MAX_BYTES", "10")
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "limit_dest")
+	fileName := "notes.txt"
+	_, err := sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName}, []byte("more than ten bytes"))
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, statErr := os.Stat(targetDir)
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestUploadFile_ClientAbortMidStream(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	parentDir := t.TempDir()
+	targetDir := filepath.Join(parentDir, "abort_dest")
+	archivePath := createTestTarArchive(t, t.TempDir(), "site.tar", map[string]string{"index.html": strings.Repeat("x", 64<<10)})
+	archiveBytes, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.UploadFile(ctx)
+	require.NoError(t, err)
+	fileName := "site.tar"
+	require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_Info{Info: &pb.FileInfo{Path: &targetDir, Filename: &fileName}}}))
+	require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_ChunkData{ChunkData: archiveBytes[:len(archiveBytes)/2]}}))
+
+	// Extraction starts with the first chunk, before the stream is complete.
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(parentDir)
+		return err == nil && len(entries) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	_, err = stream.CloseAndRecv()
+	require.Error(t, err)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(parentDir)
+		return err == nil && len(entries) == 0
+	}, 5*time.Second, 10*time.Millisecond, "The partial upload should be cleaned up")
+}
+
+func TestUploadFile_StripComponentsAndSubpath(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	archivePath := createTestTarArchive(t, t.TempDir(), "site.tar", map[string]string{
+		"project-1.2.3/dist/index.html": "home",
+		"project-1.2.3/src/main.go":     "package main",
+	})
+	content, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	targetDir := filepath.Join(t.TempDir(), "site")
+	fileName := "site.tar"
+	strip := int32(1)
+	subpath := "dist"
+	_, err = sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName, StripComponents: &strip, Subpath: &subpath}, content)
+	require.NoError(t, err)
+
+	indexContent, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "home", string(indexContent))
+	_, err = os.Stat(filepath.Join(targetDir, "src"))
+	assert.True(t, os.IsNotExist(err))
+
+	invalid := "../dist"
+	_, err = sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName, Subpath: &invalid}, content)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUploadFile_Sync(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "stale.html"), []byte("stale"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "index.html"), []byte("old"), 0644))
+
+	archivePath := createTestTarArchive(t, t.TempDir(), "site.tar", map[string]string{"index.html": "home"})
+	content, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	fileName := "site.tar"
+	sync := true
+	_, err = sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName, Sync: &sync}, content)
+	require.NoError(t, err)
+
+	indexContent, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "home", string(indexContent))
+	_, err = os.Stat(filepath.Join(targetDir, "stale.html"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploadFile_DryRun(t *testing.T) {
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "index.html"), []byte("old"), 0644))
+
+	archivePath := createTestTarArchive(t, t.TempDir(), "site.tar", map[string]string{"index.html": "home"})
+	content, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	fileName := "site.tar"
+	dryRun := true
+	resp, err := sendFileInfoAndContent(t, client, &pb.FileInfo{Path: &targetDir, Filename: &fileName, DryRun: &dryRun}, content)
+	require.NoError(t, err)
+	require.Len(t, resp.GetDiff().GetModified(), 1)
+	modified := resp.GetDiff().GetModified()[0]
+	assert.Equal(t, "index.html", modified.GetPath())
+	assert.Equal(t, int64(4), modified.GetSize())
+	assert.Equal(t, int64(3), modified.GetPreviousSize())
+
+	indexContent, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(indexContent))
+}
+
+func TestUploadFile_IdempotencyKey(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_DIR", t.TempDir())
+	client, cleanup := setupTestGRPCServer(t)
+	defer cleanup()
+
+	targetDir := filepath.Join(t.TempDir(), "site")
+	fileName := "notes.txt"
+	upload := func(content string) (*pb.UploadFileResponse, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", "build-42")
+
+		stream, err := client.UploadFile(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_Info{Info: &pb.FileInfo{Path: &targetDir, Filename: &fileName}}}))
+		require.NoError(t, stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_ChunkData{ChunkData: []byte(content)}}))
+		return stream.CloseAndRecv()
+	}
+
+	first, err := upload("notes")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(targetDir, fileName)))
+	second, err := upload("notes")
+	require.NoError(t, err)
+	assert.Equal(t, first.GetFilePath(), second.GetFilePath())
+	_, err = os.Stat(filepath.Join(targetDir, fileName))
+	assert.True(t, os.IsNotExist(err), "A retry must not redeploy")
+
+	_, err = upload("other notes")
+	require.Error(t, err)
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.AlreadyExists, st.Code())
+}
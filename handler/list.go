@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/labstack/echo/v5"
@@ -17,6 +18,8 @@ type DirectoryEntry struct {
 	Type string  `json:"type"`
 	Size *string `json:"size,omitempty"`
 	Link string  `json:"link"`
+	// Download is the /files URL of a file.
+	Download string `json:"download,omitempty"`
 }
 
 type DirectoryResponse struct {
@@ -76,6 +79,9 @@ func ListDirectoryHandler(c *echo.Context) error {
 		if se.Size != "" {
 			entry.Size = &se.Size
 		}
+		if se.Type == "file" {
+			entry.Download = downloadLink(path.Join(displayPathFromService, se.Name))
+		}
 		entries = append(entries, entry)
 	}
 
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"deploytar/service"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v5"
+)
+
+type QuotaEntry struct {
+	Pattern   string `json:"pattern"`
+	Path      string `json:"path"`
+	Bytes     int64  `json:"bytes"`
+	Inodes    int64  `json:"inodes"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	MaxInodes int64  `json:"max_inodes,omitempty"`
+}
+
+type QuotaResponse struct {
+	Quotas []QuotaEntry `json:"quotas"`
+}
+
+func QuotaHandler(c *echo.Context) error {
+	quotas, err := quotasFromEnv()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Invalid quota configuration: " + err.Error()})
+	}
+
+	usages, err := service.QuotaUsages(quotas, os.Getenv("PATH_PREFIX"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to measure quota usage"})
+	}
+
+	response := QuotaResponse{Quotas: []QuotaEntry{}}
+	for _, u := range usages {
+		response.Quotas = append(response.Quotas, QuotaEntry{
+			Pattern:   u.Pattern,
+			Path:      u.Path,
+			Bytes:     u.Bytes,
+			Inodes:    u.Inodes,
+			MaxBytes:  u.MaxBytes,
+			MaxInodes: u.MaxInodes,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
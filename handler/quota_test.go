@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaHandler(t *testing.T) {
+	prefix := t.TempDir()
+	t.Setenv("PATH_PREFIX", prefix)
+	t.Setenv("QUOTAS", "* bytes=100")
+	e := echo.New()
+
+	upload := func(t *testing.T, target, content string) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("tarfile", "data.txt")
+		require.NoError(t, err)
+		_, err = io.WriteString(part, content)
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteField("path", target))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, UploadHandler(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := upload(t, filepath.Join(prefix, "team-a"), strings.Repeat("a", 60))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = upload(t, filepath.Join(prefix, "team-a", "more"), strings.Repeat("a", 60))
+	assert.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	assert.Contains(t, rec.Body.String(), "quota exceeded")
+
+	req := httptest.NewRequest(http.MethodGet, "/quota", nil)
+	rec = httptest.NewRecorder()
+	require.NoError(t, QuotaHandler(e.NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp QuotaResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Quotas, 1)
+	assert.Equal(t, QuotaEntry{Pattern: "*", Path: filepath.Join(prefix, "team-a"), Bytes: 60, Inodes: 2, MaxBytes: 100}, resp.Quotas[0])
+}
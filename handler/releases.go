@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"deploytar/service"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/labstack/echo/v5"
+)
+
+type ReleaseEntry struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Current bool   `json:"current"`
+}
+
+type ReleasesResponse struct {
+	Releases []ReleaseEntry `json:"releases"`
+	Current  string         `json:"current,omitempty"`
+}
+
+// releaseTargetPath returns the deployment target named by the "path" form
+// value, following the same defaulting rules as UploadHandler.
+func releaseTargetPath(c *echo.Context, pathPrefixEnv string) (string, bool) {
+	targetPath := c.FormValue("path")
+	if targetPath == "" {
+		if pathPrefixEnv == "" {
+			return "", false
+		}
+		targetPath = "."
+	}
+	return targetPath, true
+}
+
+// releaseLockOptions returns the target lock settings of a rollback or
+// prune, which waits for conflicting deployments like an upload does.
+func releaseLockOptions(lockTimeout string) (service.UploadOptions, error) {
+	timeout, err := parseLockTimeout(lockTimeout)
+	if err != nil {
+		return service.UploadOptions{}, err
+	}
+	return service.UploadOptions{LockTimeout: timeout, LockDir: os.Getenv("DEPLOY_LOCK_DIR")}, nil
+}
+
+func releaseErrorResponse(c *echo.Context, err error) error {
+	statusCode := uploadErrorStatus(err)
+	if statusCode == http.StatusInternalServerError {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process release request"})
+	}
+	return c.JSON(statusCode, map[string]string{"error": err.Error()})
+}
+
+func ListReleasesHandler(c *echo.Context) error {
+	pathPrefixEnv := os.Getenv("PATH_PREFIX")
+	targetPath, ok := releaseTargetPath(c, pathPrefixEnv)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Destination directory not specified"})
+	}
+
+	releases, err := service.ListReleases(targetPath, pathPrefixEnv)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+
+	response := ReleasesResponse{Releases: []ReleaseEntry{}}
+	for _, r := range releases {
+		response.Releases = append(response.Releases, ReleaseEntry{ID: r.ID, Path: r.Path, Current: r.Current})
+		if r.Current {
+			response.Current = r.ID
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func RollbackReleaseHandler(c *echo.Context) error {
+	pathPrefixEnv := os.Getenv("PATH_PREFIX")
+	targetPath, ok := releaseTargetPath(c, pathPrefixEnv)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Destination directory not specified"})
+	}
+	releaseID := c.FormValue("id")
+	if releaseID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Release ID not specified"})
+	}
+
+	lockOpts, err := releaseLockOptions(c.FormValue("lock_timeout"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	release, err := service.RollbackRelease(targetPath, pathPrefixEnv, releaseID, lockOpts)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": fmt.Sprintf("Rolled back to release %s", release.ID),
+		"current": release.ID,
+	})
+}
+
+func PruneReleasesHandler(c *echo.Context) error {
+	pathPrefixEnv := os.Getenv("PATH_PREFIX")
+	targetPath, ok := releaseTargetPath(c, pathPrefixEnv)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Destination directory not specified"})
+	}
+	keep, err := strconv.Atoi(c.FormValue("keep"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid keep value: " + c.FormValue("keep")})
+	}
+
+	lockOpts, err := releaseLockOptions(c.FormValue("lock_timeout"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	removed, err := service.PruneReleases(targetPath, pathPrefixEnv, keep, lockOpts)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	if removed == nil {
+		removed = []string{}
+	}
+	return c.JSON(http.StatusOK, map[string][]string{"removed": removed})
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uploadRelease(t *testing.T, e *echo.Echo, targetDir, content string) string {
+	t.Helper()
+	archive := createTestArchive(t, map[string]string{"index.html": content}, nil, "site.tar")
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(part, archive)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", targetDir))
+	require.NoError(t, writer.WriteField("release", "true"))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	require.NoError(t, UploadHandler(e.NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp["release_id"])
+	return resp["release_id"]
+}
+
+func TestReleaseHandlers(t *testing.T) {
+	e := echo.New()
+	targetDir := filepath.Join(t.TempDir(), "app")
+
+	firstID := uploadRelease(t, e, targetDir, "v1")
+	secondID := uploadRelease(t, e, targetDir, "v2")
+
+	t.Run("list releases", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/releases?path="+url.QueryEscape(targetDir), nil)
+		rec := httptest.NewRecorder()
+		require.NoError(t, ListReleasesHandler(e.NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp ReleasesResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.Releases, 2)
+		assert.Equal(t, secondID, resp.Current)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		form := url.Values{"path": {targetDir}, "id": {firstID}}
+		req := httptest.NewRequest(http.MethodPost, "/releases/rollback", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, RollbackReleaseHandler(e.NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "current", "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(content))
+	})
+
+	t.Run("rollback to unknown release", func(t *testing.T) {
+		form := url.Values{"path": {targetDir}, "id": {"19700101000000"}}
+		req := httptest.NewRequest(http.MethodPost, "/releases/rollback", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, RollbackReleaseHandler(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		thirdID := uploadRelease(t, e, targetDir, "v3")
+		require.NoError(t, RollbackReleaseHandler(e.NewContext(
+			httptest.NewRequest(http.MethodPost, "/releases/rollback?path="+url.QueryEscape(targetDir)+"&id="+firstID, nil),
+			httptest.NewRecorder(),
+		)))
+
+		form := url.Values{"path": {targetDir}, "keep": {"1"}}
+		req := httptest.NewRequest(http.MethodPost, "/releases/prune", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, PruneReleasesHandler(e.NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp map[string][]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, []string{secondID}, resp["removed"], "Current release must survive pruning")
+		_, err := os.Stat(filepath.Join(targetDir, "releases", thirdID))
+		assert.NoError(t, err, "Newest release should be kept")
+	})
+
+	t.Run("prune with invalid keep", func(t *testing.T) {
+		form := url.Values{"path": {targetDir}, "keep": {"0"}}
+		req := httptest.NewRequest(http.MethodPost, "/releases/prune", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, PruneReleasesHandler(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -2,38 +2,81 @@ package handler
 
 import (
 	"deploytar/service"
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v5"
 )
 
+type SkippedEntry struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type UploadResponse struct {
+	Message   string         `json:"message"`
+	Path      string         `json:"path"`
+	Format    string         `json:"format"`
+	ReleaseID string         `json:"release_id,omitempty"`
+	SHA256    string         `json:"sha256"`
+	SHA512    string         `json:"sha512"`
+	Skipped   []SkippedEntry `json:"skipped,omitempty"`
+	Diff      *DiffResponse  `json:"diff,omitempty"`
+}
+
+type DiffEntry struct {
+	Path           string `json:"path"`
+	Size           int64  `json:"size"`
+	SHA256         string `json:"sha256"`
+	PreviousSize   int64  `json:"previous_size,omitempty"`
+	PreviousSHA256 string `json:"previous_sha256,omitempty"`
+}
+
+// DiffResponse is the change a dry-run upload would make.
+type DiffResponse struct {
+	Added     []DiffEntry `json:"added"`
+	Modified  []DiffEntry `json:"modified"`
+	Deleted   []DiffEntry `json:"deleted"`
+	Unchanged []DiffEntry `json:"unchanged"`
+}
+
+// MultiUploadResponse reports an upload of several files deployed together.
+type MultiUploadResponse struct {
+	Message   string           `json:"message"`
+	ReleaseID string           `json:"release_id,omitempty"`
+	Files     []UploadResponse `json:"files"`
+	Diff      *DiffResponse    `json:"diff,omitempty"`
+}
+
 func UploadHandler(c *echo.Context) error {
 	pathPrefixEnv := os.Getenv("PATH_PREFIX")
-	baseDirPath := c.FormValue("path")
 
+	var serverOpts service.UploadOptions
+	if err := applyServerUploadOptions(&serverOpts); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if err := limitRequestBody(c, serverOpts.Limits.MaxUploadBytes); err != nil {
+		return uploadErrorResponse(c, err)
+	}
+
+	baseDirPath := c.FormValue("path")
 	if baseDirPath == "" && pathPrefixEnv == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Destination directory not specified"})
 	}
 
-	fileHeader, err := c.FormFile("tarfile")
+	form, err := c.MultipartForm()
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "File not found in request: " + err.Error()})
 	}
-
-	src, err := fileHeader.Open()
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open uploaded file"})
+	fileHeaders := form.File["tarfile"]
+	if len(fileHeaders) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "File not found in request: " + http.ErrMissingFile.Error()})
 	}
-	defer func() {
-		if err := src.Close(); err != nil {
-			_ = err
-		}
-	}()
-
-	isPutRequest := c.Request().Method == http.MethodPut
 
 	// PATH_PREFIXが設定されている場合、空文字列はプレフィックス直下を意味する
 	targetPath := baseDirPath
@@ -41,39 +84,245 @@ func UploadHandler(c *echo.Context) error {
 		targetPath = "."
 	}
 
-	finalPath, err := service.UploadFile(src, targetPath, fileHeader.Filename, pathPrefixEnv, isPutRequest)
+	opts, err := uploadOptionsFromForm(c, serverOpts)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	opts.IsPutRequest = c.Request().Method == http.MethodPut
+	opts.Sync = c.Request().Method == http.MethodPatch
+
+	parts, err := uploadPartsFromForm(form, fileHeaders)
 	if err != nil {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "forbidden") ||
-			strings.Contains(errMsg, "traversal") ||
-			strings.Contains(errMsg, "outside the scope") ||
-			strings.Contains(errMsg, "unsafe path") ||
-			strings.Contains(errMsg, "cannot be a path traversal attempt") {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": errMsg})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	for i, fileHeader := range fileHeaders {
+		src, err := fileHeader.Open()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open uploaded file"})
 		}
-		if strings.Contains(errMsg, "not found") ||
-			strings.Contains(errMsg, "does not exist") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": errMsg})
+		defer func() {
+			if err := src.Close(); err != nil {
+				_ = err
+			}
+		}()
+		parts[i].Reader = src
+	}
+
+	results, err := idempotencyStore().Upload(c.Request().Header.Get(idempotencyKeyHeader), parts, targetPath, pathPrefixEnv, opts)
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	// A single file keeps the response of the original one-file endpoint;
+	// several files are reported as one deployment.
+	if len(results) == 1 {
+		return c.JSON(http.StatusOK, newUploadResponse(results[0]))
+	}
+	return c.JSON(http.StatusOK, newMultiUploadResponse(results))
+}
+
+// idempotencyKeyHeader carries the key that makes retried uploads safe, see
+// service.IdempotencyStore.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// multipartOverhead is the room left for the multipart envelope and form
+// fields on top of the upload size limit.
+const multipartOverhead = 1 << 20
+
+// limitRequestBody caps the request body so that an oversized upload is
+// rejected while it is received rather than after it has been spooled.
+func limitRequestBody(c *echo.Context, maxUploadBytes int64) error {
+	if maxUploadBytes <= 0 {
+		return nil
+	}
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxUploadBytes+multipartOverhead)
+	if _, err := c.FormValues(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return err
 		}
-		if strings.Contains(errMsg, "archive") ||
-			strings.Contains(errMsg, "gzipped content") ||
-			strings.Contains(errMsg, "file content") ||
-			strings.Contains(errMsg, "is not a directory") {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": errMsg})
+	}
+	return nil
+}
+
+// uploadOptionsFromForm adds the client supplied upload options shared by
+// direct and resumable uploads to opts.
+func uploadOptionsFromForm(c *echo.Context, opts service.UploadOptions) (service.UploadOptions, error) {
+	return parseUploadOptions(c.FormValue, opts)
+}
+
+// parseUploadOptions adds the client supplied upload options read through
+// value to opts.
+func parseUploadOptions(value func(name string) string, opts service.UploadOptions) (service.UploadOptions, error) {
+	if releaseValue := value("release"); releaseValue != "" {
+		isRelease, err := strconv.ParseBool(releaseValue)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid release value: %s", releaseValue)
 		}
+		opts.Release = isRelease
+	}
 
+	format, err := service.ParseFormat(value("format"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Format = format
+	if stripValue := value("strip_components"); stripValue != "" {
+		strip, err := strconv.Atoi(stripValue)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid strip_components value: %s", stripValue)
+		}
+		opts.StripComponents = strip
+	}
+	opts.Subpath = value("subpath")
+	if dryRunValue := value("dry_run"); dryRunValue != "" {
+		dryRun, err := strconv.ParseBool(dryRunValue)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid dry_run value: %s", dryRunValue)
+		}
+		opts.DryRun = dryRun
+	}
+	if opts.Include, err = service.ParsePatterns(value("include")); err != nil {
+		return opts, err
+	}
+	if opts.Exclude, err = service.ParsePatterns(value("exclude")); err != nil {
+		return opts, err
+	}
+	if opts.LockTimeout, err = parseLockTimeout(value("lock_timeout")); err != nil {
+		return opts, err
+	}
+	opts.SHA256 = value("sha256")
+	opts.SHA512 = value("sha512")
+	opts.Signature = value("signature")
+	return opts, nil
+}
+
+// parseLockTimeout reads a lock timeout given as a duration such as "30s" or
+// as a number of seconds. An empty value fails fast.
+func parseLockTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, atoiErr := strconv.Atoi(value)
+		if atoiErr != nil {
+			return 0, fmt.Errorf("Invalid lock_timeout value: %s", value)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("Invalid lock_timeout value: %s", value)
+	}
+	return timeout, nil
+}
+
+// partFields are the form fields given once per file when several files are
+// uploaded together.
+var partFields = []string{"relpath", "format", "sha256", "sha512", "signature"}
+
+// uploadPartsFromForm builds one part per uploaded file. Per-file fields are
+// matched to the files by position and must be given for every file or for
+// none of them.
+func uploadPartsFromForm(form *multipart.Form, fileHeaders []*multipart.FileHeader) ([]service.UploadPart, error) {
+	for _, name := range partFields {
+		if n := len(form.Value[name]); n != 0 && n != len(fileHeaders) {
+			return nil, fmt.Errorf("Expected one %s value per file, got %d for %d files", name, n, len(fileHeaders))
+		}
+	}
+	value := func(name string, i int) string {
+		if values := form.Value[name]; len(values) > 0 {
+			return values[i]
+		}
+		return ""
+	}
+
+	parts := make([]service.UploadPart, len(fileHeaders))
+	for i, fileHeader := range fileHeaders {
+		format, err := service.ParseFormat(value("format", i))
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = service.UploadPart{
+			FileName:  fileHeader.Filename,
+			RelPath:   value("relpath", i),
+			Format:    format,
+			SHA256:    value("sha256", i),
+			SHA512:    value("sha512", i),
+			Signature: value("signature", i),
+		}
+	}
+	return parts, nil
+}
+
+func uploadErrorResponse(c *echo.Context, err error) error {
+	statusCode := uploadErrorStatus(err)
+	if statusCode == http.StatusInternalServerError {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process file upload"})
 	}
+	return c.JSON(statusCode, map[string]string{"error": err.Error()})
+}
+
+func newUploadResponse(result *service.UploadResult) UploadResponse {
+	finalPath := result.Path
 
 	var message string
-	fileNameLower := strings.ToLower(fileHeader.Filename)
-	if strings.HasSuffix(fileNameLower, ".tar") || strings.HasSuffix(fileNameLower, ".tgz") || strings.HasSuffix(fileNameLower, ".tar.gz") {
+	if result.Diff != nil {
+		message = fmt.Sprintf("Dry run: %d added, %d modified, %d deleted, %d unchanged", len(result.Diff.Added), len(result.Diff.Modified), len(result.Diff.Deleted), len(result.Diff.Unchanged))
+	} else if result.Format.IsArchive() {
 		message = fmt.Sprintf("Archive extracted successfully to %s", finalPath)
-	} else if strings.HasSuffix(fileNameLower, ".gz") {
+	} else if result.Format.IsCompressedFile() {
 		message = fmt.Sprintf("File decompressed and saved to %s", finalPath)
 	} else {
 		message = fmt.Sprintf("File uploaded successfully to %s", finalPath)
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": message, "path": finalPath})
+	response := UploadResponse{
+		Message:   message,
+		Path:      finalPath,
+		Format:    string(result.Format),
+		ReleaseID: result.ReleaseID,
+		SHA256:    result.SHA256,
+		SHA512:    result.SHA512,
+	}
+	for _, entry := range result.Skipped {
+		response.Skipped = append(response.Skipped, SkippedEntry{Name: entry.Name, Reason: entry.Reason})
+	}
+	if result.Diff != nil {
+		response.Diff = newDiffResponse(result.Diff)
+	}
+	return response
+}
+
+func newDiffResponse(diff *service.UploadDiff) *DiffResponse {
+	convert := func(entries []service.DiffEntry) []DiffEntry {
+		converted := make([]DiffEntry, 0, len(entries))
+		for _, entry := range entries {
+			converted = append(converted, DiffEntry(entry))
+		}
+		return converted
+	}
+	return &DiffResponse{
+		Added:     convert(diff.Added),
+		Modified:  convert(diff.Modified),
+		Deleted:   convert(diff.Deleted),
+		Unchanged: convert(diff.Unchanged),
+	}
+}
+
+func newMultiUploadResponse(results []*service.UploadResult) MultiUploadResponse {
+	response := MultiUploadResponse{
+		Message:   fmt.Sprintf("%d files deployed successfully", len(results)),
+		ReleaseID: results[0].ReleaseID,
+	}
+	if results[0].Diff != nil {
+		response.Message = fmt.Sprintf("Dry run of %d files", len(results))
+		response.Diff = newDiffResponse(results[0].Diff)
+	}
+	for _, result := range results {
+		file := newUploadResponse(result)
+		file.ReleaseID = ""
+		file.Diff = nil
+		response.Files = append(response.Files, file)
+	}
+	return response
 }
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"deploytar/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	uploadOffsetHeader = "Upload-Offset"
+	uploadLengthHeader = "Upload-Length"
+)
+
+type UploadSessionResponse struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+func uploadSessionErrorResponse(c *echo.Context, err error) error {
+	statusCode := uploadErrorStatus(err)
+	if statusCode == http.StatusInternalServerError {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process upload session"})
+	}
+	return c.JSON(statusCode, map[string]string{"error": err.Error()})
+}
+
+// CreateUploadSessionHandler starts a resumable upload. It accepts the same
+// form values as UploadHandler, plus "filename", "length" (the total size,
+// omitted when unknown) and "method" (PUT, POST or PATCH semantics, default PUT).
+func CreateUploadSessionHandler(c *echo.Context) error {
+	pathPrefixEnv := os.Getenv("PATH_PREFIX")
+	var serverOpts service.UploadOptions
+	if err := applyServerUploadOptions(&serverOpts); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	targetPath, ok := releaseTargetPath(c, pathPrefixEnv)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Destination directory not specified"})
+	}
+
+	fileName := c.FormValue("filename")
+	if fileName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "filename is required"})
+	}
+
+	length := int64(-1)
+	if lengthValue := c.FormValue("length"); lengthValue != "" {
+		parsed, err := strconv.ParseInt(lengthValue, 10, 64)
+		if err != nil || parsed < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid length value: %s", lengthValue)})
+		}
+		length = parsed
+	}
+
+	opts, err := uploadOptionsFromForm(c, serverOpts)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	switch method := strings.ToUpper(c.FormValue("method")); method {
+	case "", http.MethodPut:
+		opts.IsPutRequest = true
+	case http.MethodPost:
+		opts.IsPutRequest = false
+	case http.MethodPatch:
+		opts.Sync = true
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid method value: %s", method)})
+	}
+
+	session, err := uploadSessionStore().Create(targetPath, fileName, pathPrefixEnv, length, opts)
+	if err != nil {
+		return uploadSessionErrorResponse(c, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/uploads/"+session.ID)
+	return c.JSON(http.StatusCreated, UploadSessionResponse{ID: session.ID, Offset: session.Offset, Length: session.Length})
+}
+
+// GetUploadSessionHandler reports how many bytes of a session have been
+// received, so that an interrupted client knows where to resume.
+func GetUploadSessionHandler(c *echo.Context) error {
+	session, err := uploadSessionStore().Get(c.Param("id"))
+	if err != nil {
+		return uploadSessionErrorResponse(c, err)
+	}
+
+	c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	if session.Length >= 0 {
+		c.Response().Header().Set(uploadLengthHeader, strconv.FormatInt(session.Length, 10))
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.JSON(http.StatusOK, UploadSessionResponse{ID: session.ID, Offset: session.Offset, Length: session.Length})
+}
+
+// AppendUploadSessionHandler writes the request body to a session at the
+// offset given in the Upload-Offset header.
+func AppendUploadSessionHandler(c *echo.Context) error {
+	offsetValue := c.Request().Header.Get(uploadOffsetHeader)
+	offset, err := strconv.ParseInt(offsetValue, 10, 64)
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid %s header: '%s'", uploadOffsetHeader, offsetValue)})
+	}
+
+	limits, err := limitsFromEnv()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Invalid upload limits: %v", err)})
+	}
+
+	newOffset, err := uploadSessionStore().Append(c.Param("id"), offset, c.Request().Body, limits.MaxUploadBytes)
+	if !errors.Is(err, service.ErrUploadSessionNotFound) {
+		c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(newOffset, 10))
+	}
+	if err != nil {
+		return uploadSessionErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// FinalizeUploadSessionHandler deploys a completed session exactly as
+// UploadHandler would have deployed the same content.
+func FinalizeUploadSessionHandler(c *echo.Context) error {
+	var serverOpts service.UploadOptions
+	if err := applyServerUploadOptions(&serverOpts); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	result, err := uploadSessionStore().Finalize(c.Param("id"), os.Getenv("PATH_PREFIX"), serverOpts, idempotencyStore(), c.Request().Header.Get(idempotencyKeyHeader))
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, newUploadResponse(result))
+}
+
+func DeleteUploadSessionHandler(c *echo.Context) error {
+	if err := uploadSessionStore().Delete(c.Param("id")); err != nil {
+		return uploadSessionErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
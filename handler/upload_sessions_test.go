@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadSessionHandlers(t *testing.T) {
+	t.Setenv("UPLOAD_SESSION_DIR", t.TempDir())
+
+	e := echo.New()
+	e.POST("/uploads", CreateUploadSessionHandler)
+	e.HEAD("/uploads/:id", GetUploadSessionHandler)
+	e.PATCH("/uploads/:id", AppendUploadSessionHandler)
+	e.POST("/uploads/:id/finalize", FinalizeUploadSessionHandler)
+	e.DELETE("/uploads/:id", DeleteUploadSessionHandler)
+
+	archive := createTestArchive(t, map[string]string{"index.html": "chunked"}, nil, "site.tar.gz").Bytes()
+	half := len(archive) / 2
+	targetDir := filepath.Join(t.TempDir(), "site")
+
+	createSession := func(t *testing.T) UploadSessionResponse {
+		form := url.Values{"path": {targetDir}, "filename": {"site.tar.gz"}, "length": {strconv.Itoa(len(archive))}}
+		req := httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+		var resp UploadSessionResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "/uploads/"+resp.ID, rec.Header().Get(echo.HeaderLocation))
+		return resp
+	}
+	appendChunk := func(id string, offset int, chunk []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/uploads/"+id, bytes.NewReader(chunk))
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("resume and finalize", func(t *testing.T) {
+		session := createSession(t)
+
+		rec := appendChunk(session.ID, 0, archive[:half])
+		require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+		rec = appendChunk(session.ID, 0, archive)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, strconv.Itoa(half), rec.Header().Get("Upload-Offset"))
+
+		req := httptest.NewRequest(http.MethodHead, "/uploads/"+session.ID, nil)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, strconv.Itoa(half), rec.Header().Get("Upload-Offset"))
+		assert.Equal(t, strconv.Itoa(len(archive)), rec.Header().Get("Upload-Length"))
+
+		req = httptest.NewRequest(http.MethodPost, "/uploads/"+session.ID+"/finalize", nil)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusConflict, rec.Code, "Incomplete sessions must not be deployed")
+
+		rec = appendChunk(session.ID, half, archive[half:])
+		require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+		req = httptest.NewRequest(http.MethodPost, "/uploads/"+session.ID+"/finalize", nil)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "tar.gz", resp["format"])
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "chunked", string(content))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		session := createSession(t)
+
+		req := httptest.NewRequest(http.MethodDelete, "/uploads/"+session.ID, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = appendChunk(session.ID, 0, archive)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		form := url.Values{"path": {targetDir}}
+		req := httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "filename is required")
+
+		session := createSession(t)
+		req = httptest.NewRequest(http.MethodPatch, "/uploads/"+session.ID, bytes.NewReader(archive))
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Upload-Offset header is required")
+	})
+}
@@ -2,8 +2,14 @@ package handler
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"mime/multipart"
@@ -739,3 +745,582 @@ func TestUploadHandler_Success_Put_NonArchiveFile_Overwrites(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, newFileContent, string(content))
 }
+
+func TestUploadHandler_Success_Zip(t *testing.T) {
+	e := echo.New()
+	tempDir := t.TempDir()
+
+	zipBuf := new(bytes.Buffer)
+	zw := zip.NewWriter(zipBuf)
+	w, err := zw.Create("subdir/file.txt")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "zip content")
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.zip")
+	require.NoError(t, err)
+	_, err = io.Copy(part, zipBuf)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", tempDir))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, UploadHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Contains(t, resp["message"], "Archive extracted successfully")
+	}
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "subdir", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "zip content", string(content))
+}
+
+func TestUploadHandler_DetectsFormatFromContent(t *testing.T) {
+	e := echo.New()
+	tempDir := t.TempDir()
+
+	archive := createTestArchive(t, map[string]string{"file1.txt": "content1"}, nil, "archive.tar.gz")
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "bundle.bin")
+	require.NoError(t, err)
+	_, err = io.Copy(part, archive)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", tempDir))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, UploadHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Contains(t, resp["message"], "Archive extracted successfully")
+		assert.Equal(t, "tar.gz", resp["format"])
+	}
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "file1.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "content1", string(content))
+}
+
+func TestUploadHandler_InvalidFormat(t *testing.T) {
+	e := echo.New()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "file.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", t.TempDir()))
+	require.NoError(t, writer.WriteField("format", "rar"))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, UploadHandler(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestUploadHandler_ReportsSkippedEntries(t *testing.T) {
+	e := echo.New()
+	tempDir := t.TempDir()
+
+	tarBuf := new(bytes.Buffer)
+	tw := tar.NewWriter(tarBuf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "index.html", Typeflag: tar.TypeReg, Mode: 0644, Size: 5}))
+	_, err := tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "index.html"}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "pipe", Typeflag: tar.TypeFifo, Mode: 0644}))
+	require.NoError(t, tw.Close())
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(part, tarBuf)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", tempDir))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, UploadHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp UploadResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, []SkippedEntry{{Name: "pipe", Reason: "fifo"}}, resp.Skipped)
+	}
+
+	linkTarget, err := os.Readlink(filepath.Join(tempDir, "current"))
+	require.NoError(t, err)
+	assert.Equal(t, "index.html", linkTarget)
+}
+
+func TestUploadHandler_ModePolicyFromEnv(t *testing.T) {
+	newRequest := func(t *testing.T, targetDir string) *http.Request {
+		archive := createTestArchive(t, map[string]string{"run.sh": "#!/bin/sh"}, nil, "archive.tar")
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("tarfile", "archive.tar")
+		require.NoError(t, err)
+		_, err = io.Copy(part, archive)
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteField("path", targetDir))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		return req
+	}
+
+	t.Run("forced file mode", func(t *testing.T) {
+		t.Setenv("EXTRACT_FILE_MODE", "0600")
+		e := echo.New()
+		tempDir := t.TempDir()
+		rec := httptest.NewRecorder()
+
+		c := e.NewContext(newRequest(t, tempDir), rec)
+		if assert.NoError(t, UploadHandler(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+
+		info, err := os.Stat(filepath.Join(tempDir, "run.sh"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("invalid umask", func(t *testing.T) {
+		t.Setenv("EXTRACT_UMASK", "not-octal")
+		e := echo.New()
+		rec := httptest.NewRecorder()
+
+		c := e.NewContext(newRequest(t, t.TempDir()), rec)
+		if assert.NoError(t, UploadHandler(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.Contains(t, rec.Body.String(), "EXTRACT_UMASK")
+		}
+	})
+}
+
+func TestUploadHandler_Checksum(t *testing.T) {
+	content := "checksummed content"
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+
+	newRequest := func(t *testing.T, targetDir, checksum string) *http.Request {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("tarfile", "notes.txt")
+		require.NoError(t, err)
+		_, err = io.WriteString(part, content)
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteField("path", targetDir))
+		require.NoError(t, writer.WriteField("sha256", checksum))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		return req
+	}
+
+	t.Run("match", func(t *testing.T) {
+		e := echo.New()
+		tempDir := t.TempDir()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(newRequest(t, tempDir, digest), rec)
+		if assert.NoError(t, UploadHandler(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var resp map[string]string
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, digest, resp["sha256"])
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		e := echo.New()
+		tempDir := t.TempDir()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(newRequest(t, tempDir, strings.Repeat("0", 64)), rec)
+		if assert.NoError(t, UploadHandler(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "checksum mismatch")
+		}
+		_, err := os.Stat(filepath.Join(tempDir, "notes.txt"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestUploadHandler_SignatureRequired(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	minisignKey := append(append([]byte("Ed"), bytes.Repeat([]byte{1}, 8)...), publicKey...)
+	t.Setenv("TRUSTED_SIGNING_KEYS", base64.StdEncoding.EncodeToString(minisignKey))
+
+	e := echo.New()
+	tempDir := t.TempDir()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "notes.txt")
+	require.NoError(t, err)
+	_, err = io.WriteString(part, "unsigned")
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", tempDir))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, UploadHandler(c)) {
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "signature required")
+	}
+	_, err = os.Stat(filepath.Join(tempDir, "notes.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploadHandler_Limits(t *testing.T) {
+	newRequest := func(t *testing.T, targetDir string) *http.Request {
+		archive := createTestArchive(t, map[string]string{"a.txt": "aaaa", "b.txt": "bbbb"}, nil, "site.tar")
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("tarfile", "site.tar")
+		require.NoError(t, err)
+		_, err = io.Copy(part, archive)
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteField("path", targetDir))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPut, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		return req
+	}
+
+	testCases := map[string]string{
+		"EXTRACT_MAX_ENTRIES": "1",
+		"UPLOAD_MAX_BYTES":    "100",
+	}
+	for name, value := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			e := echo.New()
+			targetDir := filepath.Join(t.TempDir(), "site")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(newRequest(t, targetDir), rec)
+			if assert.NoError(t, UploadHandler(c)) {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+			}
+			_, err := os.Stat(targetDir)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		t.Setenv("EXTRACT_MAX_RATIO", "0.5")
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(newRequest(t, t.TempDir()), rec)
+		if assert.NoError(t, UploadHandler(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.Contains(t, rec.Body.String(), "EXTRACT_MAX_RATIO")
+		}
+	})
+}
+
+func TestUploadHandler_MultipleFiles(t *testing.T) {
+	newRequest := func(t *testing.T, targetDir string, files map[string]string, relPaths []string) *http.Request {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		for _, name := range []string{"site.tar", "app.conf"} {
+			part, err := writer.CreateFormFile("tarfile", name)
+			require.NoError(t, err)
+			_, err = io.WriteString(part, files[name])
+			require.NoError(t, err)
+		}
+		for _, relPath := range relPaths {
+			require.NoError(t, writer.WriteField("relpath", relPath))
+		}
+		require.NoError(t, writer.WriteField("path", targetDir))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPut, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		return req
+	}
+	archive := createTestArchive(t, map[string]string{"index.html": "home"}, nil, "site.tar").String()
+
+	t.Run("success", func(t *testing.T) {
+		e := echo.New()
+		targetDir := filepath.Join(t.TempDir(), "site")
+		rec := httptest.NewRecorder()
+		req := newRequest(t, targetDir, map[string]string{"site.tar": archive, "app.conf": "config"}, []string{"", "etc"})
+		c := e.NewContext(req, rec)
+		require.NoError(t, UploadHandler(c))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp MultiUploadResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.Files, 2)
+		assert.Equal(t, targetDir, resp.Files[0].Path)
+		assert.Equal(t, "tar", resp.Files[0].Format)
+		assert.Equal(t, filepath.Join(targetDir, "etc", "app.conf"), resp.Files[1].Path)
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "etc", "app.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "config", string(content))
+		_, err = os.Stat(filepath.Join(targetDir, "index.html"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("response shape depends on the number of files", func(t *testing.T) {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(newRequest(t, filepath.Join(t.TempDir(), "site"), map[string]string{"site.tar": archive, "app.conf": "config"}, nil), rec)
+		require.NoError(t, UploadHandler(c))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var multi map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &multi))
+		assert.Contains(t, multi, "files")
+		assert.NotContains(t, multi, "path")
+
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("tarfile", "site.tar")
+		require.NoError(t, err)
+		_, err = io.WriteString(part, archive)
+		require.NoError(t, err)
+		targetDir := filepath.Join(t.TempDir(), "site")
+		require.NoError(t, writer.WriteField("path", targetDir))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPut, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec = httptest.NewRecorder()
+		require.NoError(t, UploadHandler(e.NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var single map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &single))
+		assert.Equal(t, targetDir, single["path"])
+		assert.Equal(t, "tar", single["format"])
+		assert.NotContains(t, single, "files")
+	})
+
+	t.Run("invalid relative path", func(t *testing.T) {
+		e := echo.New()
+		targetDir := filepath.Join(t.TempDir(), "site")
+		rec := httptest.NewRecorder()
+		req := newRequest(t, targetDir, map[string]string{"site.tar": archive, "app.conf": "config"}, []string{"", "../etc"})
+		c := e.NewContext(req, rec)
+		require.NoError(t, UploadHandler(c))
+		assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+		_, err := os.Stat(targetDir)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("mismatched per-file fields", func(t *testing.T) {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		req := newRequest(t, t.TempDir(), map[string]string{"site.tar": archive, "app.conf": "config"}, []string{"etc"})
+		c := e.NewContext(req, rec)
+		require.NoError(t, UploadHandler(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "relpath")
+	})
+}
+
+func TestUploadHandler_StripComponentsAndSubpath(t *testing.T) {
+	archive := createTestArchive(t, map[string]string{
+		"dist/index.html":    "home",
+		"dist/assets/app.js": "app",
+		"README.md":          "readme",
+	}, nil, "site.tar")
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(part, archive)
+	require.NoError(t, err)
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, writer.WriteField("path", targetDir))
+	require.NoError(t, writer.WriteField("subpath", "dist"))
+	require.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	require.NoError(t, UploadHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "assets", "app.js"))
+	require.NoError(t, err)
+	assert.Equal(t, "app", string(content))
+	_, err = os.Stat(filepath.Join(targetDir, "README.md"))
+	assert.True(t, os.IsNotExist(err))
+
+	t.Run("invalid strip_components", func(t *testing.T) {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		_, err := writer.CreateFormFile("tarfile", "site.tar")
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteField("path", t.TempDir()))
+		require.NoError(t, writer.WriteField("strip_components", "one"))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		require.NoError(t, UploadHandler(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestUploadHandler_ExcludePatterns(t *testing.T) {
+	t.Setenv("EXTRACT_EXCLUDE", ".git/**")
+	archive := createTestArchive(t, map[string]string{
+		"index.html":    "home",
+		"app.js.map":    "map",
+		".git/config":   "git",
+		"assets/app.js": "app",
+	}, nil, "site.tar")
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(part, archive)
+	require.NoError(t, err)
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, writer.WriteField("path", targetDir))
+	require.NoError(t, writer.WriteField("exclude", "*.map"))
+	require.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	require.NoError(t, UploadHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp UploadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	var skipped []string
+	for _, entry := range resp.Skipped {
+		skipped = append(skipped, entry.Name)
+	}
+	assert.ElementsMatch(t, []string{"app.js.map", ".git/config"}, skipped)
+	_, err = os.Stat(filepath.Join(targetDir, "assets", "app.js"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(targetDir, ".git"))
+	assert.True(t, os.IsNotExist(err))
+
+	t.Run("invalid server patterns", func(t *testing.T) {
+		t.Setenv("EXTRACT_EXCLUDE", "[")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		require.NoError(t, UploadHandler(c))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "EXTRACT_EXCLUDE")
+	})
+}
+
+func TestUploadHandler_PatchSyncs(t *testing.T) {
+	t.Setenv("SYNC_PROTECT", "uploads")
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(targetDir, "uploads"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "stale.html"), []byte("stale"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "uploads", "avatar.png"), []byte("user content"), 0644))
+
+	archive := createTestArchive(t, map[string]string{"index.html": "home"}, nil, "site.tar")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(part, archive)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", targetDir))
+	require.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPatch, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	require.NoError(t, UploadHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	_, err = os.Stat(filepath.Join(targetDir, "index.html"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(targetDir, "uploads", "avatar.png"))
+	assert.NoError(t, err, "Protected files should be kept")
+	_, err = os.Stat(filepath.Join(targetDir, "stale.html"))
+	assert.True(t, os.IsNotExist(err), "Files missing from the archive should be deleted")
+}
+
+func TestUploadHandler_DryRun(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "stale.html"), []byte("stale"), 0644))
+
+	archive := createTestArchive(t, map[string]string{"index.html": "home"}, nil, "site.tar")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("tarfile", "site.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(part, archive)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("path", targetDir))
+	require.NoError(t, writer.WriteField("dry_run", "true"))
+	require.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	require.NoError(t, UploadHandler(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp UploadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Diff)
+	require.Len(t, resp.Diff.Added, 1)
+	assert.Equal(t, "index.html", resp.Diff.Added[0].Path)
+	assert.Equal(t, int64(4), resp.Diff.Added[0].Size)
+	require.Len(t, resp.Diff.Deleted, 1)
+	assert.Equal(t, "stale.html", resp.Diff.Deleted[0].Path)
+	assert.Empty(t, resp.Diff.Modified)
+	assert.Contains(t, resp.Message, "Dry run")
+
+	_, err = os.Stat(filepath.Join(targetDir, "index.html"))
+	assert.True(t, os.IsNotExist(err), "A dry run must not write to the target")
+	_, err = os.Stat(filepath.Join(targetDir, "stale.html"))
+	assert.NoError(t, err)
+}
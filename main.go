@@ -57,8 +57,28 @@ func main() {
 
 	e.POST("/", handler.UploadHandler)
 	e.PUT("/", handler.UploadHandler)
+	e.PATCH("/", handler.UploadHandler)
+	e.POST("/deploy/*", handler.DeployHandler)
+	e.PUT("/deploy/*", handler.DeployHandler)
+	e.PATCH("/deploy/*", handler.DeployHandler)
+
+	e.POST("/uploads", handler.CreateUploadSessionHandler)
+	e.HEAD("/uploads/:id", handler.GetUploadSessionHandler)
+	e.GET("/uploads/:id", handler.GetUploadSessionHandler)
+	e.PATCH("/uploads/:id", handler.AppendUploadSessionHandler)
+	e.POST("/uploads/:id/finalize", handler.FinalizeUploadSessionHandler)
+	e.DELETE("/uploads/:id", handler.DeleteUploadSessionHandler)
 
 	e.GET("/list", handler.ListDirectoryHandler)
+	e.HEAD("/files/*", handler.DownloadHandler)
+	e.GET("/files/*", handler.DownloadHandler)
+	e.GET("/archive", handler.ArchiveHandler)
+
+	e.GET("/quota", handler.QuotaHandler)
+
+	e.GET("/releases", handler.ListReleasesHandler)
+	e.POST("/releases/rollback", handler.RollbackReleaseHandler)
+	e.POST("/releases/prune", handler.PruneReleasesHandler)
 
 	e.GET("/healthz", handler.Healthz)
 
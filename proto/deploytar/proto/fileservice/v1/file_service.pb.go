@@ -276,28 +276,1323 @@ func (*UploadFileRequest_Info) isUploadFileRequest_Data() {}
 func (*UploadFileRequest_ChunkData) isUploadFileRequest_Data() {}
 
 type FileInfo struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Path     *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Filename *string                `protobuf:"bytes,2,opt,name=filename" json:"filename,omitempty"`
+	Release  *bool                  `protobuf:"varint,3,opt,name=release" json:"release,omitempty"`
+	// Overrides content detection, e.g. "tar.gz", "zip" or "plain".
+	Format *string `protobuf:"bytes,4,opt,name=format" json:"format,omitempty"`
+	// Optional hex encoded digests of the upload. The deployment is not
+	// committed when a digest does not match.
+	Sha256 *string `protobuf:"bytes,5,opt,name=sha256" json:"sha256,omitempty"`
+	Sha512 *string `protobuf:"bytes,6,opt,name=sha512" json:"sha512,omitempty"`
+	// Detached minisign or SSH signature over the upload. Required when the
+	// server is configured with trusted signing keys.
+	Signature *string `protobuf:"bytes,7,opt,name=signature" json:"signature,omitempty"`
+	// Number of leading path components removed from archive entries.
+	StripComponents *int32 `protobuf:"varint,8,opt,name=strip_components,json=stripComponents" json:"strip_components,omitempty"`
+	// Extracts only the archive entries below this directory, relative to it.
+	Subpath *string `protobuf:"bytes,9,opt,name=subpath" json:"subpath,omitempty"`
+	// Glob patterns selecting the archive entries, or the single file, that
+	// are written. "**" matches any number of path segments.
+	Include []string `protobuf:"bytes,10,rep,name=include" json:"include,omitempty"`
+	Exclude []string `protobuf:"bytes,11,rep,name=exclude" json:"exclude,omitempty"`
+	// Deletes the files and empty directories missing from the upload instead
+	// of replacing the whole target directory.
+	Sync *bool `protobuf:"varint,12,opt,name=sync" json:"sync,omitempty"`
+	// Runs every check and returns the diff against the target in
+	// UploadFileResponse.diff without writing anything.
+	DryRun *bool `protobuf:"varint,13,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	// How long to wait for a conflicting deployment to the target, a parent or
+	// a child, as a duration such as "30s" or a number of seconds. The upload
+	// fails with ABORTED right away when empty.
+	LockTimeout   *string `protobuf:"bytes,14,opt,name=lock_timeout,json=lockTimeout" json:"lock_timeout,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FileInfo) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *FileInfo) GetFilename() string {
+	if x != nil && x.Filename != nil {
+		return *x.Filename
+	}
+	return ""
+}
+
+func (x *FileInfo) GetRelease() bool {
+	if x != nil && x.Release != nil {
+		return *x.Release
+	}
+	return false
+}
+
+func (x *FileInfo) GetFormat() string {
+	if x != nil && x.Format != nil {
+		return *x.Format
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSha256() string {
+	if x != nil && x.Sha256 != nil {
+		return *x.Sha256
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSha512() string {
+	if x != nil && x.Sha512 != nil {
+		return *x.Sha512
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSignature() string {
+	if x != nil && x.Signature != nil {
+		return *x.Signature
+	}
+	return ""
+}
+
+func (x *FileInfo) GetStripComponents() int32 {
+	if x != nil && x.StripComponents != nil {
+		return *x.StripComponents
+	}
+	return 0
+}
+
+func (x *FileInfo) GetSubpath() string {
+	if x != nil && x.Subpath != nil {
+		return *x.Subpath
+	}
+	return ""
+}
+
+func (x *FileInfo) GetInclude() []string {
+	if x != nil {
+		return x.Include
+	}
+	return nil
+}
+
+func (x *FileInfo) GetExclude() []string {
+	if x != nil {
+		return x.Exclude
+	}
+	return nil
+}
+
+func (x *FileInfo) GetSync() bool {
+	if x != nil && x.Sync != nil {
+		return *x.Sync
+	}
+	return false
+}
+
+func (x *FileInfo) GetDryRun() bool {
+	if x != nil && x.DryRun != nil {
+		return *x.DryRun
+	}
+	return false
+}
+
+func (x *FileInfo) GetLockTimeout() string {
+	if x != nil && x.LockTimeout != nil {
+		return *x.LockTimeout
+	}
+	return ""
+}
+
+type UploadFileResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Message   *string                `protobuf:"bytes,1,opt,name=message" json:"message,omitempty"`
+	FilePath  *string                `protobuf:"bytes,2,opt,name=file_path,json=filePath" json:"file_path,omitempty"`
+	ReleaseId *string                `protobuf:"bytes,3,opt,name=release_id,json=releaseId" json:"release_id,omitempty"`
+	Format    *string                `protobuf:"bytes,4,opt,name=format" json:"format,omitempty"`
+	// Archive entries that were not extracted, such as device nodes.
+	Skipped []*SkippedEntry `protobuf:"bytes,5,rep,name=skipped" json:"skipped,omitempty"`
+	Sha256  *string         `protobuf:"bytes,6,opt,name=sha256" json:"sha256,omitempty"`
+	Sha512  *string         `protobuf:"bytes,7,opt,name=sha512" json:"sha512,omitempty"`
+	// Set for dry runs.
+	Diff          *UploadDiff `protobuf:"bytes,8,opt,name=diff" json:"diff,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadFileResponse) Reset() {
+	*x = UploadFileResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadFileResponse) ProtoMessage() {}
+
+func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadFileResponse.ProtoReflect.Descriptor instead.
+func (*UploadFileResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UploadFileResponse) GetMessage() string {
+	if x != nil && x.Message != nil {
+		return *x.Message
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetFilePath() string {
+	if x != nil && x.FilePath != nil {
+		return *x.FilePath
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetReleaseId() string {
+	if x != nil && x.ReleaseId != nil {
+		return *x.ReleaseId
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetFormat() string {
+	if x != nil && x.Format != nil {
+		return *x.Format
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetSkipped() []*SkippedEntry {
+	if x != nil {
+		return x.Skipped
+	}
+	return nil
+}
+
+func (x *UploadFileResponse) GetSha256() string {
+	if x != nil && x.Sha256 != nil {
+		return *x.Sha256
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetSha512() string {
+	if x != nil && x.Sha512 != nil {
+		return *x.Sha512
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetDiff() *UploadDiff {
+	if x != nil {
+		return x.Diff
+	}
+	return nil
+}
+
+type DiffEntry struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Path   *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Size   *int64                 `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	Sha256 *string                `protobuf:"bytes,3,opt,name=sha256" json:"sha256,omitempty"`
+	// Size and digest of the file currently in place, for modified files.
+	PreviousSize   *int64  `protobuf:"varint,4,opt,name=previous_size,json=previousSize" json:"previous_size,omitempty"`
+	PreviousSha256 *string `protobuf:"bytes,5,opt,name=previous_sha256,json=previousSha256" json:"previous_sha256,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DiffEntry) Reset() {
+	*x = DiffEntry{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiffEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiffEntry) ProtoMessage() {}
+
+func (x *DiffEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiffEntry.ProtoReflect.Descriptor instead.
+func (*DiffEntry) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DiffEntry) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *DiffEntry) GetSize() int64 {
+	if x != nil && x.Size != nil {
+		return *x.Size
+	}
+	return 0
+}
+
+func (x *DiffEntry) GetSha256() string {
+	if x != nil && x.Sha256 != nil {
+		return *x.Sha256
+	}
+	return ""
+}
+
+func (x *DiffEntry) GetPreviousSize() int64 {
+	if x != nil && x.PreviousSize != nil {
+		return *x.PreviousSize
+	}
+	return 0
+}
+
+func (x *DiffEntry) GetPreviousSha256() string {
+	if x != nil && x.PreviousSha256 != nil {
+		return *x.PreviousSha256
+	}
+	return ""
+}
+
+type UploadDiff struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Added         []*DiffEntry           `protobuf:"bytes,1,rep,name=added" json:"added,omitempty"`
+	Modified      []*DiffEntry           `protobuf:"bytes,2,rep,name=modified" json:"modified,omitempty"`
+	Deleted       []*DiffEntry           `protobuf:"bytes,3,rep,name=deleted" json:"deleted,omitempty"`
+	Unchanged     []*DiffEntry           `protobuf:"bytes,4,rep,name=unchanged" json:"unchanged,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadDiff) Reset() {
+	*x = UploadDiff{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadDiff) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadDiff) ProtoMessage() {}
+
+func (x *UploadDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadDiff.ProtoReflect.Descriptor instead.
+func (*UploadDiff) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *UploadDiff) GetAdded() []*DiffEntry {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *UploadDiff) GetModified() []*DiffEntry {
+	if x != nil {
+		return x.Modified
+	}
+	return nil
+}
+
+func (x *UploadDiff) GetDeleted() []*DiffEntry {
+	if x != nil {
+		return x.Deleted
+	}
+	return nil
+}
+
+func (x *UploadDiff) GetUnchanged() []*DiffEntry {
+	if x != nil {
+		return x.Unchanged
+	}
+	return nil
+}
+
+type SkippedEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          *string                `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Reason        *string                `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SkippedEntry) Reset() {
+	*x = SkippedEntry{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SkippedEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SkippedEntry) ProtoMessage() {}
+
+func (x *SkippedEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SkippedEntry.ProtoReflect.Descriptor instead.
+func (*SkippedEntry) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SkippedEntry) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+func (x *SkippedEntry) GetReason() string {
+	if x != nil && x.Reason != nil {
+		return *x.Reason
+	}
+	return ""
+}
+
+type CreateUploadSessionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Info  *FileInfo              `protobuf:"bytes,1,opt,name=info" json:"info,omitempty"`
+	// Total size of the upload, or -1 when it is not known up front.
+	Length        *int64 `protobuf:"varint,2,opt,name=length" json:"length,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateUploadSessionRequest) Reset() {
+	*x = CreateUploadSessionRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateUploadSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateUploadSessionRequest) ProtoMessage() {}
+
+func (x *CreateUploadSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateUploadSessionRequest.ProtoReflect.Descriptor instead.
+func (*CreateUploadSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CreateUploadSessionRequest) GetInfo() *FileInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *CreateUploadSessionRequest) GetLength() int64 {
+	if x != nil && x.Length != nil {
+		return *x.Length
+	}
+	return 0
+}
+
+type GetUploadSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     *string                `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUploadSessionRequest) Reset() {
+	*x = GetUploadSessionRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUploadSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUploadSessionRequest) ProtoMessage() {}
+
+func (x *GetUploadSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUploadSessionRequest.ProtoReflect.Descriptor instead.
+func (*GetUploadSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetUploadSessionRequest) GetSessionId() string {
+	if x != nil && x.SessionId != nil {
+		return *x.SessionId
+	}
+	return ""
+}
+
+type UploadSessionResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	SessionId *string                `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
+	// Number of bytes received so far; the next chunk must start here.
+	Offset        *int64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Length        *int64 `protobuf:"varint,3,opt,name=length" json:"length,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadSessionResponse) Reset() {
+	*x = UploadSessionResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadSessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadSessionResponse) ProtoMessage() {}
+
+func (x *UploadSessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadSessionResponse.ProtoReflect.Descriptor instead.
+func (*UploadSessionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UploadSessionResponse) GetSessionId() string {
+	if x != nil && x.SessionId != nil {
+		return *x.SessionId
+	}
+	return ""
+}
+
+func (x *UploadSessionResponse) GetOffset() int64 {
+	if x != nil && x.Offset != nil {
+		return *x.Offset
+	}
+	return 0
+}
+
+func (x *UploadSessionResponse) GetLength() int64 {
+	if x != nil && x.Length != nil {
+		return *x.Length
+	}
+	return 0
+}
+
+type ResumeUploadRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Data:
+	//
+	//	*ResumeUploadRequest_Info
+	//	*ResumeUploadRequest_ChunkData
+	Data          isResumeUploadRequest_Data `protobuf_oneof:"data"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeUploadRequest) Reset() {
+	*x = ResumeUploadRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeUploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeUploadRequest) ProtoMessage() {}
+
+func (x *ResumeUploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeUploadRequest.ProtoReflect.Descriptor instead.
+func (*ResumeUploadRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ResumeUploadRequest) GetData() isResumeUploadRequest_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ResumeUploadRequest) GetInfo() *ResumeInfo {
+	if x != nil {
+		if x, ok := x.Data.(*ResumeUploadRequest_Info); ok {
+			return x.Info
+		}
+	}
+	return nil
+}
+
+func (x *ResumeUploadRequest) GetChunkData() []byte {
+	if x != nil {
+		if x, ok := x.Data.(*ResumeUploadRequest_ChunkData); ok {
+			return x.ChunkData
+		}
+	}
+	return nil
+}
+
+type isResumeUploadRequest_Data interface {
+	isResumeUploadRequest_Data()
+}
+
+type ResumeUploadRequest_Info struct {
+	Info *ResumeInfo `protobuf:"bytes,1,opt,name=info,oneof"`
+}
+
+type ResumeUploadRequest_ChunkData struct {
+	ChunkData []byte `protobuf:"bytes,2,opt,name=chunk_data,json=chunkData,oneof"`
+}
+
+func (*ResumeUploadRequest_Info) isResumeUploadRequest_Data() {}
+
+func (*ResumeUploadRequest_ChunkData) isResumeUploadRequest_Data() {}
+
+type ResumeInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     *string                `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
+	Offset        *int64                 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeInfo) Reset() {
+	*x = ResumeInfo{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeInfo) ProtoMessage() {}
+
+func (x *ResumeInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeInfo.ProtoReflect.Descriptor instead.
+func (*ResumeInfo) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ResumeInfo) GetSessionId() string {
+	if x != nil && x.SessionId != nil {
+		return *x.SessionId
+	}
+	return ""
+}
+
+func (x *ResumeInfo) GetOffset() int64 {
+	if x != nil && x.Offset != nil {
+		return *x.Offset
+	}
+	return 0
+}
+
+type FinalizeUploadSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     *string                `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FinalizeUploadSessionRequest) Reset() {
+	*x = FinalizeUploadSessionRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FinalizeUploadSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FinalizeUploadSessionRequest) ProtoMessage() {}
+
+func (x *FinalizeUploadSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FinalizeUploadSessionRequest.ProtoReflect.Descriptor instead.
+func (*FinalizeUploadSessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *FinalizeUploadSessionRequest) GetSessionId() string {
+	if x != nil && x.SessionId != nil {
+		return *x.SessionId
+	}
+	return ""
+}
+
+type Release struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            *string                `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Path          *string                `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+	Current       *bool                  `protobuf:"varint,3,opt,name=current" json:"current,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Release) Reset() {
+	*x = Release{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Release) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Release) ProtoMessage() {}
+
+func (x *Release) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Release.ProtoReflect.Descriptor instead.
+func (*Release) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Release) GetId() string {
+	if x != nil && x.Id != nil {
+		return *x.Id
+	}
+	return ""
+}
+
+func (x *Release) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *Release) GetCurrent() bool {
+	if x != nil && x.Current != nil {
+		return *x.Current
+	}
+	return false
+}
+
+type ListReleasesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReleasesRequest) Reset() {
+	*x = ListReleasesRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReleasesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReleasesRequest) ProtoMessage() {}
+
+func (x *ListReleasesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReleasesRequest.ProtoReflect.Descriptor instead.
+func (*ListReleasesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListReleasesRequest) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+type ListReleasesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Releases      []*Release             `protobuf:"bytes,1,rep,name=releases" json:"releases,omitempty"`
+	Current       *string                `protobuf:"bytes,2,opt,name=current" json:"current,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReleasesResponse) Reset() {
+	*x = ListReleasesResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReleasesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReleasesResponse) ProtoMessage() {}
+
+func (x *ListReleasesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReleasesResponse.ProtoReflect.Descriptor instead.
+func (*ListReleasesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ListReleasesResponse) GetReleases() []*Release {
+	if x != nil {
+		return x.Releases
+	}
+	return nil
+}
+
+func (x *ListReleasesResponse) GetCurrent() string {
+	if x != nil && x.Current != nil {
+		return *x.Current
+	}
+	return ""
+}
+
+type RollbackReleaseRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Path      *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	ReleaseId *string                `protobuf:"bytes,2,opt,name=release_id,json=releaseId" json:"release_id,omitempty"`
+	// How long to wait for a conflicting deployment, as for
+	// FileInfo.lock_timeout.
+	LockTimeout   *string `protobuf:"bytes,3,opt,name=lock_timeout,json=lockTimeout" json:"lock_timeout,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RollbackReleaseRequest) Reset() {
+	*x = RollbackReleaseRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RollbackReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RollbackReleaseRequest) ProtoMessage() {}
+
+func (x *RollbackReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RollbackReleaseRequest.ProtoReflect.Descriptor instead.
+func (*RollbackReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RollbackReleaseRequest) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *RollbackReleaseRequest) GetReleaseId() string {
+	if x != nil && x.ReleaseId != nil {
+		return *x.ReleaseId
+	}
+	return ""
+}
+
+func (x *RollbackReleaseRequest) GetLockTimeout() string {
+	if x != nil && x.LockTimeout != nil {
+		return *x.LockTimeout
+	}
+	return ""
+}
+
+type RollbackReleaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       *string                `protobuf:"bytes,1,opt,name=message" json:"message,omitempty"`
+	Current       *string                `protobuf:"bytes,2,opt,name=current" json:"current,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RollbackReleaseResponse) Reset() {
+	*x = RollbackReleaseResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RollbackReleaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RollbackReleaseResponse) ProtoMessage() {}
+
+func (x *RollbackReleaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RollbackReleaseResponse.ProtoReflect.Descriptor instead.
+func (*RollbackReleaseResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RollbackReleaseResponse) GetMessage() string {
+	if x != nil && x.Message != nil {
+		return *x.Message
+	}
+	return ""
+}
+
+func (x *RollbackReleaseResponse) GetCurrent() string {
+	if x != nil && x.Current != nil {
+		return *x.Current
+	}
+	return ""
+}
+
+type PruneReleasesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Path  *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Keep  *int32                 `protobuf:"varint,2,opt,name=keep" json:"keep,omitempty"`
+	// How long to wait for a conflicting deployment, as for
+	// FileInfo.lock_timeout.
+	LockTimeout   *string `protobuf:"bytes,3,opt,name=lock_timeout,json=lockTimeout" json:"lock_timeout,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PruneReleasesRequest) Reset() {
+	*x = PruneReleasesRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PruneReleasesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PruneReleasesRequest) ProtoMessage() {}
+
+func (x *PruneReleasesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PruneReleasesRequest.ProtoReflect.Descriptor instead.
+func (*PruneReleasesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *PruneReleasesRequest) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *PruneReleasesRequest) GetKeep() int32 {
+	if x != nil && x.Keep != nil {
+		return *x.Keep
+	}
+	return 0
+}
+
+func (x *PruneReleasesRequest) GetLockTimeout() string {
+	if x != nil && x.LockTimeout != nil {
+		return *x.LockTimeout
+	}
+	return ""
+}
+
+type PruneReleasesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Removed       []string               `protobuf:"bytes,1,rep,name=removed" json:"removed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PruneReleasesResponse) Reset() {
+	*x = PruneReleasesResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PruneReleasesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PruneReleasesResponse) ProtoMessage() {}
+
+func (x *PruneReleasesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PruneReleasesResponse.ProtoReflect.Descriptor instead.
+func (*PruneReleasesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *PruneReleasesResponse) GetRemoved() []string {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+type GetQuotaUsageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetQuotaUsageRequest) Reset() {
+	*x = GetQuotaUsageRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetQuotaUsageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetQuotaUsageRequest) ProtoMessage() {}
+
+func (x *GetQuotaUsageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetQuotaUsageRequest.ProtoReflect.Descriptor instead.
+func (*GetQuotaUsageRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{22}
+}
+
+type QuotaUsage struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Pattern *string                `protobuf:"bytes,1,opt,name=pattern" json:"pattern,omitempty"`
+	Path    *string                `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+	Bytes   *int64                 `protobuf:"varint,3,opt,name=bytes" json:"bytes,omitempty"`
+	Inodes  *int64                 `protobuf:"varint,4,opt,name=inodes" json:"inodes,omitempty"`
+	// Zero when the quota does not limit bytes or inodes.
+	MaxBytes      *int64 `protobuf:"varint,5,opt,name=max_bytes,json=maxBytes" json:"max_bytes,omitempty"`
+	MaxInodes     *int64 `protobuf:"varint,6,opt,name=max_inodes,json=maxInodes" json:"max_inodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QuotaUsage) Reset() {
+	*x = QuotaUsage{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuotaUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuotaUsage) ProtoMessage() {}
+
+func (x *QuotaUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuotaUsage.ProtoReflect.Descriptor instead.
+func (*QuotaUsage) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *QuotaUsage) GetPattern() string {
+	if x != nil && x.Pattern != nil {
+		return *x.Pattern
+	}
+	return ""
+}
+
+func (x *QuotaUsage) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *QuotaUsage) GetBytes() int64 {
+	if x != nil && x.Bytes != nil {
+		return *x.Bytes
+	}
+	return 0
+}
+
+func (x *QuotaUsage) GetInodes() int64 {
+	if x != nil && x.Inodes != nil {
+		return *x.Inodes
+	}
+	return 0
+}
+
+func (x *QuotaUsage) GetMaxBytes() int64 {
+	if x != nil && x.MaxBytes != nil {
+		return *x.MaxBytes
+	}
+	return 0
+}
+
+func (x *QuotaUsage) GetMaxInodes() int64 {
+	if x != nil && x.MaxInodes != nil {
+		return *x.MaxInodes
+	}
+	return 0
+}
+
+type GetQuotaUsageResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Path          *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
-	Filename      *string                `protobuf:"bytes,2,opt,name=filename" json:"filename,omitempty"`
+	Quotas        []*QuotaUsage          `protobuf:"bytes,1,rep,name=quotas" json:"quotas,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *FileInfo) Reset() {
-	*x = FileInfo{}
-	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[4]
+func (x *GetQuotaUsageResponse) Reset() {
+	*x = GetQuotaUsageResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FileInfo) String() string {
+func (x *GetQuotaUsageResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FileInfo) ProtoMessage() {}
+func (*GetQuotaUsageResponse) ProtoMessage() {}
 
-func (x *FileInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[4]
+func (x *GetQuotaUsageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -308,48 +1603,203 @@ func (x *FileInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
-func (*FileInfo) Descriptor() ([]byte, []int) {
-	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use GetQuotaUsageResponse.ProtoReflect.Descriptor instead.
+func (*GetQuotaUsageResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{24}
 }
 
-func (x *FileInfo) GetPath() string {
+func (x *GetQuotaUsageResponse) GetQuotas() []*QuotaUsage {
+	if x != nil {
+		return x.Quotas
+	}
+	return nil
+}
+
+type DownloadFileRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// File path, resolved like ListDirectoryRequest.directory.
+	Path *string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// Reads length bytes starting at offset; the rest of the file when length
+	// is zero.
+	Offset        *int64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Length        *int64 `protobuf:"varint,3,opt,name=length" json:"length,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadFileRequest) Reset() {
+	*x = DownloadFileRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadFileRequest) ProtoMessage() {}
+
+func (x *DownloadFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadFileRequest.ProtoReflect.Descriptor instead.
+func (*DownloadFileRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *DownloadFileRequest) GetPath() string {
 	if x != nil && x.Path != nil {
 		return *x.Path
 	}
 	return ""
 }
 
-func (x *FileInfo) GetFilename() string {
-	if x != nil && x.Filename != nil {
-		return *x.Filename
+func (x *DownloadFileRequest) GetOffset() int64 {
+	if x != nil && x.Offset != nil {
+		return *x.Offset
+	}
+	return 0
+}
+
+func (x *DownloadFileRequest) GetLength() int64 {
+	if x != nil && x.Length != nil {
+		return *x.Length
+	}
+	return 0
+}
+
+type FileMetadata struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  *string                `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Size  *int64                 `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	Mode  *uint32                `protobuf:"varint,3,opt,name=mode" json:"mode,omitempty"`
+	// Modification time in seconds since the Unix epoch.
+	ModTime *int64 `protobuf:"varint,4,opt,name=mod_time,json=modTime" json:"mod_time,omitempty"`
+	// Digest of the whole file, also for partial reads.
+	Sha256 *string `protobuf:"bytes,5,opt,name=sha256" json:"sha256,omitempty"`
+	// The range that is sent.
+	Offset        *int64 `protobuf:"varint,6,opt,name=offset" json:"offset,omitempty"`
+	Length        *int64 `protobuf:"varint,7,opt,name=length" json:"length,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileMetadata) Reset() {
+	*x = FileMetadata{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMetadata) ProtoMessage() {}
+
+func (x *FileMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMetadata.ProtoReflect.Descriptor instead.
+func (*FileMetadata) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *FileMetadata) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
 	}
 	return ""
 }
 
-type UploadFileResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Message       *string                `protobuf:"bytes,1,opt,name=message" json:"message,omitempty"`
-	FilePath      *string                `protobuf:"bytes,2,opt,name=file_path,json=filePath" json:"file_path,omitempty"`
+func (x *FileMetadata) GetSize() int64 {
+	if x != nil && x.Size != nil {
+		return *x.Size
+	}
+	return 0
+}
+
+func (x *FileMetadata) GetMode() uint32 {
+	if x != nil && x.Mode != nil {
+		return *x.Mode
+	}
+	return 0
+}
+
+func (x *FileMetadata) GetModTime() int64 {
+	if x != nil && x.ModTime != nil {
+		return *x.ModTime
+	}
+	return 0
+}
+
+func (x *FileMetadata) GetSha256() string {
+	if x != nil && x.Sha256 != nil {
+		return *x.Sha256
+	}
+	return ""
+}
+
+func (x *FileMetadata) GetOffset() int64 {
+	if x != nil && x.Offset != nil {
+		return *x.Offset
+	}
+	return 0
+}
+
+func (x *FileMetadata) GetLength() int64 {
+	if x != nil && x.Length != nil {
+		return *x.Length
+	}
+	return 0
+}
+
+// The first message holds the metadata, followed by the chunks of the file.
+type DownloadFileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Data:
+	//
+	//	*DownloadFileResponse_Metadata
+	//	*DownloadFileResponse_ChunkData
+	Data          isDownloadFileResponse_Data `protobuf_oneof:"data"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *UploadFileResponse) Reset() {
-	*x = UploadFileResponse{}
-	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[5]
+func (x *DownloadFileResponse) Reset() {
+	*x = DownloadFileResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[27]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *UploadFileResponse) String() string {
+func (x *DownloadFileResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*UploadFileResponse) ProtoMessage() {}
+func (*DownloadFileResponse) ProtoMessage() {}
 
-func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[5]
+func (x *DownloadFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[27]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -360,25 +1810,150 @@ func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use UploadFileResponse.ProtoReflect.Descriptor instead.
-func (*UploadFileResponse) Descriptor() ([]byte, []int) {
-	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use DownloadFileResponse.ProtoReflect.Descriptor instead.
+func (*DownloadFileResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{27}
 }
 
-func (x *UploadFileResponse) GetMessage() string {
-	if x != nil && x.Message != nil {
-		return *x.Message
+func (x *DownloadFileResponse) GetData() isDownloadFileResponse_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *DownloadFileResponse) GetMetadata() *FileMetadata {
+	if x != nil {
+		if x, ok := x.Data.(*DownloadFileResponse_Metadata); ok {
+			return x.Metadata
+		}
+	}
+	return nil
+}
+
+func (x *DownloadFileResponse) GetChunkData() []byte {
+	if x != nil {
+		if x, ok := x.Data.(*DownloadFileResponse_ChunkData); ok {
+			return x.ChunkData
+		}
+	}
+	return nil
+}
+
+type isDownloadFileResponse_Data interface {
+	isDownloadFileResponse_Data()
+}
+
+type DownloadFileResponse_Metadata struct {
+	Metadata *FileMetadata `protobuf:"bytes,1,opt,name=metadata,oneof"`
+}
+
+type DownloadFileResponse_ChunkData struct {
+	ChunkData []byte `protobuf:"bytes,2,opt,name=chunk_data,json=chunkData,oneof"`
+}
+
+func (*DownloadFileResponse_Metadata) isDownloadFileResponse_Data() {}
+
+func (*DownloadFileResponse_ChunkData) isDownloadFileResponse_Data() {}
+
+type DownloadArchiveRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Directory, resolved like ListDirectoryRequest.directory.
+	Directory *string `protobuf:"bytes,1,opt,name=directory" json:"directory,omitempty"`
+	// tar.gz (default), tar, tar.zst or zip, as for GET /archive.
+	Format        *string `protobuf:"bytes,2,opt,name=format" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadArchiveRequest) Reset() {
+	*x = DownloadArchiveRequest{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadArchiveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadArchiveRequest) ProtoMessage() {}
+
+func (x *DownloadArchiveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadArchiveRequest.ProtoReflect.Descriptor instead.
+func (*DownloadArchiveRequest) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *DownloadArchiveRequest) GetDirectory() string {
+	if x != nil && x.Directory != nil {
+		return *x.Directory
 	}
 	return ""
 }
 
-func (x *UploadFileResponse) GetFilePath() string {
-	if x != nil && x.FilePath != nil {
-		return *x.FilePath
+func (x *DownloadArchiveRequest) GetFormat() string {
+	if x != nil && x.Format != nil {
+		return *x.Format
 	}
 	return ""
 }
 
+type DownloadArchiveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChunkData     []byte                 `protobuf:"bytes,1,opt,name=chunk_data,json=chunkData" json:"chunk_data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadArchiveResponse) Reset() {
+	*x = DownloadArchiveResponse{}
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadArchiveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadArchiveResponse) ProtoMessage() {}
+
+func (x *DownloadArchiveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_fileservice_v1_file_service_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadArchiveResponse.ProtoReflect.Descriptor instead.
+func (*DownloadArchiveResponse) Descriptor() ([]byte, []int) {
+	return file_proto_fileservice_v1_file_service_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *DownloadArchiveResponse) GetChunkData() []byte {
+	if x != nil {
+		return x.ChunkData
+	}
+	return nil
+}
+
 var File_proto_fileservice_v1_file_service_proto protoreflect.FileDescriptor
 
 const file_proto_fileservice_v1_file_service_proto_rawDesc = "" +
@@ -400,17 +1975,144 @@ const file_proto_fileservice_v1_file_service_proto_rawDesc = "" +
 	"\x04info\x18\x01 \x01(\v2\x18.fileservice.v1.FileInfoH\x00R\x04info\x12\x1f\n" +
 	"\n" +
 	"chunk_data\x18\x02 \x01(\fH\x00R\tchunkDataB\x06\n" +
-	"\x04data\":\n" +
+	"\x04data\"\x83\x03\n" +
 	"\bFileInfo\x12\x12\n" +
 	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1a\n" +
-	"\bfilename\x18\x02 \x01(\tR\bfilename\"K\n" +
+	"\bfilename\x18\x02 \x01(\tR\bfilename\x12\x18\n" +
+	"\arelease\x18\x03 \x01(\bR\arelease\x12\x16\n" +
+	"\x06format\x18\x04 \x01(\tR\x06format\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12\x16\n" +
+	"\x06sha512\x18\x06 \x01(\tR\x06sha512\x12\x1c\n" +
+	"\tsignature\x18\a \x01(\tR\tsignature\x12)\n" +
+	"\x10strip_components\x18\b \x01(\x05R\x0fstripComponents\x12\x18\n" +
+	"\asubpath\x18\t \x01(\tR\asubpath\x12\x18\n" +
+	"\ainclude\x18\n" +
+	" \x03(\tR\ainclude\x12\x18\n" +
+	"\aexclude\x18\v \x03(\tR\aexclude\x12\x12\n" +
+	"\x04sync\x18\f \x01(\bR\x04sync\x12\x17\n" +
+	"\adry_run\x18\r \x01(\bR\x06dryRun\x12!\n" +
+	"\flock_timeout\x18\x0e \x01(\tR\vlockTimeout\"\x9a\x02\n" +
 	"\x12UploadFileResponse\x12\x18\n" +
 	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1b\n" +
-	"\tfile_path\x18\x02 \x01(\tR\bfilePath2\xc2\x01\n" +
+	"\tfile_path\x18\x02 \x01(\tR\bfilePath\x12\x1d\n" +
+	"\n" +
+	"release_id\x18\x03 \x01(\tR\treleaseId\x12\x16\n" +
+	"\x06format\x18\x04 \x01(\tR\x06format\x126\n" +
+	"\askipped\x18\x05 \x03(\v2\x1c.fileservice.v1.SkippedEntryR\askipped\x12\x16\n" +
+	"\x06sha256\x18\x06 \x01(\tR\x06sha256\x12\x16\n" +
+	"\x06sha512\x18\a \x01(\tR\x06sha512\x12.\n" +
+	"\x04diff\x18\b \x01(\v2\x1a.fileservice.v1.UploadDiffR\x04diff\"\x99\x01\n" +
+	"\tDiffEntry\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\x12#\n" +
+	"\rprevious_size\x18\x04 \x01(\x03R\fpreviousSize\x12'\n" +
+	"\x0fprevious_sha256\x18\x05 \x01(\tR\x0epreviousSha256\"\xe2\x01\n" +
+	"\n" +
+	"UploadDiff\x12/\n" +
+	"\x05added\x18\x01 \x03(\v2\x19.fileservice.v1.DiffEntryR\x05added\x125\n" +
+	"\bmodified\x18\x02 \x03(\v2\x19.fileservice.v1.DiffEntryR\bmodified\x123\n" +
+	"\adeleted\x18\x03 \x03(\v2\x19.fileservice.v1.DiffEntryR\adeleted\x127\n" +
+	"\tunchanged\x18\x04 \x03(\v2\x19.fileservice.v1.DiffEntryR\tunchanged\":\n" +
+	"\fSkippedEntry\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\"b\n" +
+	"\x1aCreateUploadSessionRequest\x12,\n" +
+	"\x04info\x18\x01 \x01(\v2\x18.fileservice.v1.FileInfoR\x04info\x12\x16\n" +
+	"\x06length\x18\x02 \x01(\x03R\x06length\"8\n" +
+	"\x17GetUploadSessionRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\"f\n" +
+	"\x15UploadSessionResponse\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x03R\x06length\"p\n" +
+	"\x13ResumeUploadRequest\x120\n" +
+	"\x04info\x18\x01 \x01(\v2\x1a.fileservice.v1.ResumeInfoH\x00R\x04info\x12\x1f\n" +
+	"\n" +
+	"chunk_data\x18\x02 \x01(\fH\x00R\tchunkDataB\x06\n" +
+	"\x04data\"C\n" +
+	"\n" +
+	"ResumeInfo\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\"=\n" +
+	"\x1cFinalizeUploadSessionRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\"G\n" +
+	"\aRelease\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x18\n" +
+	"\acurrent\x18\x03 \x01(\bR\acurrent\")\n" +
+	"\x13ListReleasesRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\"e\n" +
+	"\x14ListReleasesResponse\x123\n" +
+	"\breleases\x18\x01 \x03(\v2\x17.fileservice.v1.ReleaseR\breleases\x12\x18\n" +
+	"\acurrent\x18\x02 \x01(\tR\acurrent\"n\n" +
+	"\x16RollbackReleaseRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1d\n" +
+	"\n" +
+	"release_id\x18\x02 \x01(\tR\treleaseId\x12!\n" +
+	"\flock_timeout\x18\x03 \x01(\tR\vlockTimeout\"M\n" +
+	"\x17RollbackReleaseResponse\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x18\n" +
+	"\acurrent\x18\x02 \x01(\tR\acurrent\"a\n" +
+	"\x14PruneReleasesRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
+	"\x04keep\x18\x02 \x01(\x05R\x04keep\x12!\n" +
+	"\flock_timeout\x18\x03 \x01(\tR\vlockTimeout\"1\n" +
+	"\x15PruneReleasesResponse\x12\x18\n" +
+	"\aremoved\x18\x01 \x03(\tR\aremoved\"\x16\n" +
+	"\x14GetQuotaUsageRequest\"\xa4\x01\n" +
+	"\n" +
+	"QuotaUsage\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x14\n" +
+	"\x05bytes\x18\x03 \x01(\x03R\x05bytes\x12\x16\n" +
+	"\x06inodes\x18\x04 \x01(\x03R\x06inodes\x12\x1b\n" +
+	"\tmax_bytes\x18\x05 \x01(\x03R\bmaxBytes\x12\x1d\n" +
+	"\n" +
+	"max_inodes\x18\x06 \x01(\x03R\tmaxInodes\"K\n" +
+	"\x15GetQuotaUsageResponse\x122\n" +
+	"\x06quotas\x18\x01 \x03(\v2\x1a.fileservice.v1.QuotaUsageR\x06quotas\"Y\n" +
+	"\x13DownloadFileRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x03R\x06length\"\xad\x01\n" +
+	"\fFileMetadata\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\rR\x04mode\x12\x19\n" +
+	"\bmod_time\x18\x04 \x01(\x03R\amodTime\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12\x16\n" +
+	"\x06offset\x18\x06 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\a \x01(\x03R\x06length\"{\n" +
+	"\x14DownloadFileResponse\x12:\n" +
+	"\bmetadata\x18\x01 \x01(\v2\x1c.fileservice.v1.FileMetadataH\x00R\bmetadata\x12\x1f\n" +
+	"\n" +
+	"chunk_data\x18\x02 \x01(\fH\x00R\tchunkDataB\x06\n" +
+	"\x04data\"N\n" +
+	"\x16DownloadArchiveRequest\x12\x1c\n" +
+	"\tdirectory\x18\x01 \x01(\tR\tdirectory\x12\x16\n" +
+	"\x06format\x18\x02 \x01(\tR\x06format\"8\n" +
+	"\x17DownloadArchiveResponse\x12\x1d\n" +
+	"\n" +
+	"chunk_data\x18\x01 \x01(\fR\tchunkData2\x97\t\n" +
 	"\vFileService\x12\\\n" +
 	"\rListDirectory\x12$.fileservice.v1.ListDirectoryRequest\x1a%.fileservice.v1.ListDirectoryResponse\x12U\n" +
 	"\n" +
-	"UploadFile\x12!.fileservice.v1.UploadFileRequest\x1a\".fileservice.v1.UploadFileResponse(\x01B Z\x1edeploytar/proto/fileservice/v1b\beditionsp\xe8\a"
+	"UploadFile\x12!.fileservice.v1.UploadFileRequest\x1a\".fileservice.v1.UploadFileResponse(\x01\x12Y\n" +
+	"\fListReleases\x12#.fileservice.v1.ListReleasesRequest\x1a$.fileservice.v1.ListReleasesResponse\x12b\n" +
+	"\x0fRollbackRelease\x12&.fileservice.v1.RollbackReleaseRequest\x1a'.fileservice.v1.RollbackReleaseResponse\x12\\\n" +
+	"\rPruneReleases\x12$.fileservice.v1.PruneReleasesRequest\x1a%.fileservice.v1.PruneReleasesResponse\x12h\n" +
+	"\x13CreateUploadSession\x12*.fileservice.v1.CreateUploadSessionRequest\x1a%.fileservice.v1.UploadSessionResponse\x12b\n" +
+	"\x10GetUploadSession\x12'.fileservice.v1.GetUploadSessionRequest\x1a%.fileservice.v1.UploadSessionResponse\x12\\\n" +
+	"\fResumeUpload\x12#.fileservice.v1.ResumeUploadRequest\x1a%.fileservice.v1.UploadSessionResponse(\x01\x12i\n" +
+	"\x15FinalizeUploadSession\x12,.fileservice.v1.FinalizeUploadSessionRequest\x1a\".fileservice.v1.UploadFileResponse\x12\\\n" +
+	"\rGetQuotaUsage\x12$.fileservice.v1.GetQuotaUsageRequest\x1a%.fileservice.v1.GetQuotaUsageResponse\x12[\n" +
+	"\fDownloadFile\x12#.fileservice.v1.DownloadFileRequest\x1a$.fileservice.v1.DownloadFileResponse0\x01\x12d\n" +
+	"\x0fDownloadArchive\x12&.fileservice.v1.DownloadArchiveRequest\x1a'.fileservice.v1.DownloadArchiveResponse0\x01B Z\x1edeploytar/proto/fileservice/v1b\beditionsp\xe8\a"
 
 var (
 	file_proto_fileservice_v1_file_service_proto_rawDescOnce sync.Once
@@ -424,27 +2126,82 @@ func file_proto_fileservice_v1_file_service_proto_rawDescGZIP() []byte {
 	return file_proto_fileservice_v1_file_service_proto_rawDescData
 }
 
-var file_proto_fileservice_v1_file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_proto_fileservice_v1_file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 30)
 var file_proto_fileservice_v1_file_service_proto_goTypes = []any{
-	(*ListDirectoryRequest)(nil),  // 0: fileservice.v1.ListDirectoryRequest
-	(*DirectoryEntry)(nil),        // 1: fileservice.v1.DirectoryEntry
-	(*ListDirectoryResponse)(nil), // 2: fileservice.v1.ListDirectoryResponse
-	(*UploadFileRequest)(nil),     // 3: fileservice.v1.UploadFileRequest
-	(*FileInfo)(nil),              // 4: fileservice.v1.FileInfo
-	(*UploadFileResponse)(nil),    // 5: fileservice.v1.UploadFileResponse
+	(*ListDirectoryRequest)(nil),         // 0: fileservice.v1.ListDirectoryRequest
+	(*DirectoryEntry)(nil),               // 1: fileservice.v1.DirectoryEntry
+	(*ListDirectoryResponse)(nil),        // 2: fileservice.v1.ListDirectoryResponse
+	(*UploadFileRequest)(nil),            // 3: fileservice.v1.UploadFileRequest
+	(*FileInfo)(nil),                     // 4: fileservice.v1.FileInfo
+	(*UploadFileResponse)(nil),           // 5: fileservice.v1.UploadFileResponse
+	(*DiffEntry)(nil),                    // 6: fileservice.v1.DiffEntry
+	(*UploadDiff)(nil),                   // 7: fileservice.v1.UploadDiff
+	(*SkippedEntry)(nil),                 // 8: fileservice.v1.SkippedEntry
+	(*CreateUploadSessionRequest)(nil),   // 9: fileservice.v1.CreateUploadSessionRequest
+	(*GetUploadSessionRequest)(nil),      // 10: fileservice.v1.GetUploadSessionRequest
+	(*UploadSessionResponse)(nil),        // 11: fileservice.v1.UploadSessionResponse
+	(*ResumeUploadRequest)(nil),          // 12: fileservice.v1.ResumeUploadRequest
+	(*ResumeInfo)(nil),                   // 13: fileservice.v1.ResumeInfo
+	(*FinalizeUploadSessionRequest)(nil), // 14: fileservice.v1.FinalizeUploadSessionRequest
+	(*Release)(nil),                      // 15: fileservice.v1.Release
+	(*ListReleasesRequest)(nil),          // 16: fileservice.v1.ListReleasesRequest
+	(*ListReleasesResponse)(nil),         // 17: fileservice.v1.ListReleasesResponse
+	(*RollbackReleaseRequest)(nil),       // 18: fileservice.v1.RollbackReleaseRequest
+	(*RollbackReleaseResponse)(nil),      // 19: fileservice.v1.RollbackReleaseResponse
+	(*PruneReleasesRequest)(nil),         // 20: fileservice.v1.PruneReleasesRequest
+	(*PruneReleasesResponse)(nil),        // 21: fileservice.v1.PruneReleasesResponse
+	(*GetQuotaUsageRequest)(nil),         // 22: fileservice.v1.GetQuotaUsageRequest
+	(*QuotaUsage)(nil),                   // 23: fileservice.v1.QuotaUsage
+	(*GetQuotaUsageResponse)(nil),        // 24: fileservice.v1.GetQuotaUsageResponse
+	(*DownloadFileRequest)(nil),          // 25: fileservice.v1.DownloadFileRequest
+	(*FileMetadata)(nil),                 // 26: fileservice.v1.FileMetadata
+	(*DownloadFileResponse)(nil),         // 27: fileservice.v1.DownloadFileResponse
+	(*DownloadArchiveRequest)(nil),       // 28: fileservice.v1.DownloadArchiveRequest
+	(*DownloadArchiveResponse)(nil),      // 29: fileservice.v1.DownloadArchiveResponse
 }
 var file_proto_fileservice_v1_file_service_proto_depIdxs = []int32{
-	1, // 0: fileservice.v1.ListDirectoryResponse.entries:type_name -> fileservice.v1.DirectoryEntry
-	4, // 1: fileservice.v1.UploadFileRequest.info:type_name -> fileservice.v1.FileInfo
-	0, // 2: fileservice.v1.FileService.ListDirectory:input_type -> fileservice.v1.ListDirectoryRequest
-	3, // 3: fileservice.v1.FileService.UploadFile:input_type -> fileservice.v1.UploadFileRequest
-	2, // 4: fileservice.v1.FileService.ListDirectory:output_type -> fileservice.v1.ListDirectoryResponse
-	5, // 5: fileservice.v1.FileService.UploadFile:output_type -> fileservice.v1.UploadFileResponse
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	1,  // 0: fileservice.v1.ListDirectoryResponse.entries:type_name -> fileservice.v1.DirectoryEntry
+	4,  // 1: fileservice.v1.UploadFileRequest.info:type_name -> fileservice.v1.FileInfo
+	8,  // 2: fileservice.v1.UploadFileResponse.skipped:type_name -> fileservice.v1.SkippedEntry
+	7,  // 3: fileservice.v1.UploadFileResponse.diff:type_name -> fileservice.v1.UploadDiff
+	6,  // 4: fileservice.v1.UploadDiff.added:type_name -> fileservice.v1.DiffEntry
+	6,  // 5: fileservice.v1.UploadDiff.modified:type_name -> fileservice.v1.DiffEntry
+	6,  // 6: fileservice.v1.UploadDiff.deleted:type_name -> fileservice.v1.DiffEntry
+	6,  // 7: fileservice.v1.UploadDiff.unchanged:type_name -> fileservice.v1.DiffEntry
+	4,  // 8: fileservice.v1.CreateUploadSessionRequest.info:type_name -> fileservice.v1.FileInfo
+	13, // 9: fileservice.v1.ResumeUploadRequest.info:type_name -> fileservice.v1.ResumeInfo
+	15, // 10: fileservice.v1.ListReleasesResponse.releases:type_name -> fileservice.v1.Release
+	23, // 11: fileservice.v1.GetQuotaUsageResponse.quotas:type_name -> fileservice.v1.QuotaUsage
+	26, // 12: fileservice.v1.DownloadFileResponse.metadata:type_name -> fileservice.v1.FileMetadata
+	0,  // 13: fileservice.v1.FileService.ListDirectory:input_type -> fileservice.v1.ListDirectoryRequest
+	3,  // 14: fileservice.v1.FileService.UploadFile:input_type -> fileservice.v1.UploadFileRequest
+	16, // 15: fileservice.v1.FileService.ListReleases:input_type -> fileservice.v1.ListReleasesRequest
+	18, // 16: fileservice.v1.FileService.RollbackRelease:input_type -> fileservice.v1.RollbackReleaseRequest
+	20, // 17: fileservice.v1.FileService.PruneReleases:input_type -> fileservice.v1.PruneReleasesRequest
+	9,  // 18: fileservice.v1.FileService.CreateUploadSession:input_type -> fileservice.v1.CreateUploadSessionRequest
+	10, // 19: fileservice.v1.FileService.GetUploadSession:input_type -> fileservice.v1.GetUploadSessionRequest
+	12, // 20: fileservice.v1.FileService.ResumeUpload:input_type -> fileservice.v1.ResumeUploadRequest
+	14, // 21: fileservice.v1.FileService.FinalizeUploadSession:input_type -> fileservice.v1.FinalizeUploadSessionRequest
+	22, // 22: fileservice.v1.FileService.GetQuotaUsage:input_type -> fileservice.v1.GetQuotaUsageRequest
+	25, // 23: fileservice.v1.FileService.DownloadFile:input_type -> fileservice.v1.DownloadFileRequest
+	28, // 24: fileservice.v1.FileService.DownloadArchive:input_type -> fileservice.v1.DownloadArchiveRequest
+	2,  // 25: fileservice.v1.FileService.ListDirectory:output_type -> fileservice.v1.ListDirectoryResponse
+	5,  // 26: fileservice.v1.FileService.UploadFile:output_type -> fileservice.v1.UploadFileResponse
+	17, // 27: fileservice.v1.FileService.ListReleases:output_type -> fileservice.v1.ListReleasesResponse
+	19, // 28: fileservice.v1.FileService.RollbackRelease:output_type -> fileservice.v1.RollbackReleaseResponse
+	21, // 29: fileservice.v1.FileService.PruneReleases:output_type -> fileservice.v1.PruneReleasesResponse
+	11, // 30: fileservice.v1.FileService.CreateUploadSession:output_type -> fileservice.v1.UploadSessionResponse
+	11, // 31: fileservice.v1.FileService.GetUploadSession:output_type -> fileservice.v1.UploadSessionResponse
+	11, // 32: fileservice.v1.FileService.ResumeUpload:output_type -> fileservice.v1.UploadSessionResponse
+	5,  // 33: fileservice.v1.FileService.FinalizeUploadSession:output_type -> fileservice.v1.UploadFileResponse
+	24, // 34: fileservice.v1.FileService.GetQuotaUsage:output_type -> fileservice.v1.GetQuotaUsageResponse
+	27, // 35: fileservice.v1.FileService.DownloadFile:output_type -> fileservice.v1.DownloadFileResponse
+	29, // 36: fileservice.v1.FileService.DownloadArchive:output_type -> fileservice.v1.DownloadArchiveResponse
+	25, // [25:37] is the sub-list for method output_type
+	13, // [13:25] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_proto_fileservice_v1_file_service_proto_init() }
@@ -456,13 +2213,21 @@ func file_proto_fileservice_v1_file_service_proto_init() {
 		(*UploadFileRequest_Info)(nil),
 		(*UploadFileRequest_ChunkData)(nil),
 	}
+	file_proto_fileservice_v1_file_service_proto_msgTypes[12].OneofWrappers = []any{
+		(*ResumeUploadRequest_Info)(nil),
+		(*ResumeUploadRequest_ChunkData)(nil),
+	}
+	file_proto_fileservice_v1_file_service_proto_msgTypes[27].OneofWrappers = []any{
+		(*DownloadFileResponse_Metadata)(nil),
+		(*DownloadFileResponse_ChunkData)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_fileservice_v1_file_service_proto_rawDesc), len(file_proto_fileservice_v1_file_service_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   30,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
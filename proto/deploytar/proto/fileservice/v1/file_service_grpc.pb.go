@@ -19,8 +19,18 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	FileService_ListDirectory_FullMethodName = "/fileservice.v1.FileService/ListDirectory"
-	FileService_UploadFile_FullMethodName    = "/fileservice.v1.FileService/UploadFile"
+	FileService_ListDirectory_FullMethodName         = "/fileservice.v1.FileService/ListDirectory"
+	FileService_UploadFile_FullMethodName            = "/fileservice.v1.FileService/UploadFile"
+	FileService_ListReleases_FullMethodName          = "/fileservice.v1.FileService/ListReleases"
+	FileService_RollbackRelease_FullMethodName       = "/fileservice.v1.FileService/RollbackRelease"
+	FileService_PruneReleases_FullMethodName         = "/fileservice.v1.FileService/PruneReleases"
+	FileService_CreateUploadSession_FullMethodName   = "/fileservice.v1.FileService/CreateUploadSession"
+	FileService_GetUploadSession_FullMethodName      = "/fileservice.v1.FileService/GetUploadSession"
+	FileService_ResumeUpload_FullMethodName          = "/fileservice.v1.FileService/ResumeUpload"
+	FileService_FinalizeUploadSession_FullMethodName = "/fileservice.v1.FileService/FinalizeUploadSession"
+	FileService_GetQuotaUsage_FullMethodName         = "/fileservice.v1.FileService/GetQuotaUsage"
+	FileService_DownloadFile_FullMethodName          = "/fileservice.v1.FileService/DownloadFile"
+	FileService_DownloadArchive_FullMethodName       = "/fileservice.v1.FileService/DownloadArchive"
 )
 
 // FileServiceClient is the client API for FileService service.
@@ -29,6 +39,16 @@ const (
 type FileServiceClient interface {
 	ListDirectory(ctx context.Context, in *ListDirectoryRequest, opts ...grpc.CallOption) (*ListDirectoryResponse, error)
 	UploadFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadFileRequest, UploadFileResponse], error)
+	ListReleases(ctx context.Context, in *ListReleasesRequest, opts ...grpc.CallOption) (*ListReleasesResponse, error)
+	RollbackRelease(ctx context.Context, in *RollbackReleaseRequest, opts ...grpc.CallOption) (*RollbackReleaseResponse, error)
+	PruneReleases(ctx context.Context, in *PruneReleasesRequest, opts ...grpc.CallOption) (*PruneReleasesResponse, error)
+	CreateUploadSession(ctx context.Context, in *CreateUploadSessionRequest, opts ...grpc.CallOption) (*UploadSessionResponse, error)
+	GetUploadSession(ctx context.Context, in *GetUploadSessionRequest, opts ...grpc.CallOption) (*UploadSessionResponse, error)
+	ResumeUpload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ResumeUploadRequest, UploadSessionResponse], error)
+	FinalizeUploadSession(ctx context.Context, in *FinalizeUploadSessionRequest, opts ...grpc.CallOption) (*UploadFileResponse, error)
+	GetQuotaUsage(ctx context.Context, in *GetQuotaUsageRequest, opts ...grpc.CallOption) (*GetQuotaUsageResponse, error)
+	DownloadFile(ctx context.Context, in *DownloadFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadFileResponse], error)
+	DownloadArchive(ctx context.Context, in *DownloadArchiveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadArchiveResponse], error)
 }
 
 type fileServiceClient struct {
@@ -62,12 +82,143 @@ func (c *fileServiceClient) UploadFile(ctx context.Context, opts ...grpc.CallOpt
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileService_UploadFileClient = grpc.ClientStreamingClient[UploadFileRequest, UploadFileResponse]
 
+func (c *fileServiceClient) ListReleases(ctx context.Context, in *ListReleasesRequest, opts ...grpc.CallOption) (*ListReleasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListReleasesResponse)
+	err := c.cc.Invoke(ctx, FileService_ListReleases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) RollbackRelease(ctx context.Context, in *RollbackReleaseRequest, opts ...grpc.CallOption) (*RollbackReleaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RollbackReleaseResponse)
+	err := c.cc.Invoke(ctx, FileService_RollbackRelease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) PruneReleases(ctx context.Context, in *PruneReleasesRequest, opts ...grpc.CallOption) (*PruneReleasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PruneReleasesResponse)
+	err := c.cc.Invoke(ctx, FileService_PruneReleases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) CreateUploadSession(ctx context.Context, in *CreateUploadSessionRequest, opts ...grpc.CallOption) (*UploadSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadSessionResponse)
+	err := c.cc.Invoke(ctx, FileService_CreateUploadSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) GetUploadSession(ctx context.Context, in *GetUploadSessionRequest, opts ...grpc.CallOption) (*UploadSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadSessionResponse)
+	err := c.cc.Invoke(ctx, FileService_GetUploadSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) ResumeUpload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ResumeUploadRequest, UploadSessionResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[1], FileService_ResumeUpload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ResumeUploadRequest, UploadSessionResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_ResumeUploadClient = grpc.ClientStreamingClient[ResumeUploadRequest, UploadSessionResponse]
+
+func (c *fileServiceClient) FinalizeUploadSession(ctx context.Context, in *FinalizeUploadSessionRequest, opts ...grpc.CallOption) (*UploadFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadFileResponse)
+	err := c.cc.Invoke(ctx, FileService_FinalizeUploadSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) GetQuotaUsage(ctx context.Context, in *GetQuotaUsageRequest, opts ...grpc.CallOption) (*GetQuotaUsageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetQuotaUsageResponse)
+	err := c.cc.Invoke(ctx, FileService_GetQuotaUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) DownloadFile(ctx context.Context, in *DownloadFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadFileResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[2], FileService_DownloadFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadFileRequest, DownloadFileResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_DownloadFileClient = grpc.ServerStreamingClient[DownloadFileResponse]
+
+func (c *fileServiceClient) DownloadArchive(ctx context.Context, in *DownloadArchiveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadArchiveResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[3], FileService_DownloadArchive_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadArchiveRequest, DownloadArchiveResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_DownloadArchiveClient = grpc.ServerStreamingClient[DownloadArchiveResponse]
+
 // FileServiceServer is the server API for FileService service.
 // All implementations must embed UnimplementedFileServiceServer
 // for forward compatibility.
 type FileServiceServer interface {
 	ListDirectory(context.Context, *ListDirectoryRequest) (*ListDirectoryResponse, error)
 	UploadFile(grpc.ClientStreamingServer[UploadFileRequest, UploadFileResponse]) error
+	ListReleases(context.Context, *ListReleasesRequest) (*ListReleasesResponse, error)
+	RollbackRelease(context.Context, *RollbackReleaseRequest) (*RollbackReleaseResponse, error)
+	PruneReleases(context.Context, *PruneReleasesRequest) (*PruneReleasesResponse, error)
+	CreateUploadSession(context.Context, *CreateUploadSessionRequest) (*UploadSessionResponse, error)
+	GetUploadSession(context.Context, *GetUploadSessionRequest) (*UploadSessionResponse, error)
+	ResumeUpload(grpc.ClientStreamingServer[ResumeUploadRequest, UploadSessionResponse]) error
+	FinalizeUploadSession(context.Context, *FinalizeUploadSessionRequest) (*UploadFileResponse, error)
+	GetQuotaUsage(context.Context, *GetQuotaUsageRequest) (*GetQuotaUsageResponse, error)
+	DownloadFile(*DownloadFileRequest, grpc.ServerStreamingServer[DownloadFileResponse]) error
+	DownloadArchive(*DownloadArchiveRequest, grpc.ServerStreamingServer[DownloadArchiveResponse]) error
 	mustEmbedUnimplementedFileServiceServer()
 }
 
@@ -84,6 +235,36 @@ func (UnimplementedFileServiceServer) ListDirectory(context.Context, *ListDirect
 func (UnimplementedFileServiceServer) UploadFile(grpc.ClientStreamingServer[UploadFileRequest, UploadFileResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
 }
+func (UnimplementedFileServiceServer) ListReleases(context.Context, *ListReleasesRequest) (*ListReleasesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListReleases not implemented")
+}
+func (UnimplementedFileServiceServer) RollbackRelease(context.Context, *RollbackReleaseRequest) (*RollbackReleaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackRelease not implemented")
+}
+func (UnimplementedFileServiceServer) PruneReleases(context.Context, *PruneReleasesRequest) (*PruneReleasesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PruneReleases not implemented")
+}
+func (UnimplementedFileServiceServer) CreateUploadSession(context.Context, *CreateUploadSessionRequest) (*UploadSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUploadSession not implemented")
+}
+func (UnimplementedFileServiceServer) GetUploadSession(context.Context, *GetUploadSessionRequest) (*UploadSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUploadSession not implemented")
+}
+func (UnimplementedFileServiceServer) ResumeUpload(grpc.ClientStreamingServer[ResumeUploadRequest, UploadSessionResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ResumeUpload not implemented")
+}
+func (UnimplementedFileServiceServer) FinalizeUploadSession(context.Context, *FinalizeUploadSessionRequest) (*UploadFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinalizeUploadSession not implemented")
+}
+func (UnimplementedFileServiceServer) GetQuotaUsage(context.Context, *GetQuotaUsageRequest) (*GetQuotaUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQuotaUsage not implemented")
+}
+func (UnimplementedFileServiceServer) DownloadFile(*DownloadFileRequest, grpc.ServerStreamingServer[DownloadFileResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
+}
+func (UnimplementedFileServiceServer) DownloadArchive(*DownloadArchiveRequest, grpc.ServerStreamingServer[DownloadArchiveResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadArchive not implemented")
+}
 func (UnimplementedFileServiceServer) mustEmbedUnimplementedFileServiceServer() {}
 func (UnimplementedFileServiceServer) testEmbeddedByValue()                     {}
 
@@ -130,6 +311,161 @@ func _FileService_UploadFile_Handler(srv interface{}, stream grpc.ServerStream)
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileService_UploadFileServer = grpc.ClientStreamingServer[UploadFileRequest, UploadFileResponse]
 
+func _FileService_ListReleases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReleasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).ListReleases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_ListReleases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).ListReleases(ctx, req.(*ListReleasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_RollbackRelease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).RollbackRelease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_RollbackRelease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).RollbackRelease(ctx, req.(*RollbackReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_PruneReleases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PruneReleasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).PruneReleases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_PruneReleases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).PruneReleases(ctx, req.(*PruneReleasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_CreateUploadSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUploadSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).CreateUploadSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_CreateUploadSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).CreateUploadSession(ctx, req.(*CreateUploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_GetUploadSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUploadSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetUploadSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetUploadSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetUploadSession(ctx, req.(*GetUploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_ResumeUpload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileServiceServer).ResumeUpload(&grpc.GenericServerStream[ResumeUploadRequest, UploadSessionResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_ResumeUploadServer = grpc.ClientStreamingServer[ResumeUploadRequest, UploadSessionResponse]
+
+func _FileService_FinalizeUploadSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FinalizeUploadSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).FinalizeUploadSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_FinalizeUploadSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).FinalizeUploadSession(ctx, req.(*FinalizeUploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_GetQuotaUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQuotaUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetQuotaUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetQuotaUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetQuotaUsage(ctx, req.(*GetQuotaUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).DownloadFile(m, &grpc.GenericServerStream[DownloadFileRequest, DownloadFileResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_DownloadFileServer = grpc.ServerStreamingServer[DownloadFileResponse]
+
+func _FileService_DownloadArchive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadArchiveRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).DownloadArchive(m, &grpc.GenericServerStream[DownloadArchiveRequest, DownloadArchiveResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_DownloadArchiveServer = grpc.ServerStreamingServer[DownloadArchiveResponse]
+
 // FileService_ServiceDesc is the grpc.ServiceDesc for FileService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -141,6 +477,34 @@ var FileService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListDirectory",
 			Handler:    _FileService_ListDirectory_Handler,
 		},
+		{
+			MethodName: "ListReleases",
+			Handler:    _FileService_ListReleases_Handler,
+		},
+		{
+			MethodName: "RollbackRelease",
+			Handler:    _FileService_RollbackRelease_Handler,
+		},
+		{
+			MethodName: "PruneReleases",
+			Handler:    _FileService_PruneReleases_Handler,
+		},
+		{
+			MethodName: "CreateUploadSession",
+			Handler:    _FileService_CreateUploadSession_Handler,
+		},
+		{
+			MethodName: "GetUploadSession",
+			Handler:    _FileService_GetUploadSession_Handler,
+		},
+		{
+			MethodName: "FinalizeUploadSession",
+			Handler:    _FileService_FinalizeUploadSession_Handler,
+		},
+		{
+			MethodName: "GetQuotaUsage",
+			Handler:    _FileService_GetQuotaUsage_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -148,6 +512,21 @@ var FileService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _FileService_UploadFile_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "ResumeUpload",
+			Handler:       _FileService_ResumeUpload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadFile",
+			Handler:       _FileService_DownloadFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "DownloadArchive",
+			Handler:       _FileService_DownloadArchive_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proto/fileservice/v1/file_service.proto",
 }
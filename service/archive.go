@@ -0,0 +1,261 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ParseArchiveFormat parses the format of a directory download. tar.gz is
+// used when value is empty.
+func ParseArchiveFormat(value string) (Format, error) {
+	format, err := ParseFormat(value)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case "":
+		return FormatTarGzip, nil
+	case FormatTar, FormatTarGzip, FormatTarZstd, FormatZip:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: '%s' cannot be used for directory archives", ErrUnsupportedFormat, value)
+}
+
+// ArchiveMediaType returns the Content-Type of an archive in format.
+func ArchiveMediaType(format Format) string {
+	switch format {
+	case FormatTar:
+		return "application/x-tar"
+	case FormatTarGzip:
+		return "application/gzip"
+	case FormatTarZstd:
+		return "application/zstd"
+	case FormatZip:
+		return "application/zip"
+	}
+	return "application/octet-stream"
+}
+
+// ResolveDirectory validates rawDir like ResolveAndValidatePath and resolves
+// its symlinks, so that a link inside the allowed scope cannot be used to
+// read what is outside of it.
+func ResolveDirectory(rawDir, pathPrefixEnv string) (resolvedDir string, displayPath string, err error) {
+	resolvedDir, displayPath, err = resolveExistingPath(rawDir, pathPrefixEnv)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := os.Stat(resolvedDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to stat '%s': %w", displayPath, err)
+	}
+	if !info.IsDir() {
+		return "", "", fmt.Errorf("'%s' is not a directory", displayPath)
+	}
+	return resolvedDir, displayPath, nil
+}
+
+// WriteArchive streams the content of dir to w as an archive in format,
+// with entry names relative to dir so that it can be uploaded again as is.
+// Modes, modification times and symlinks are preserved; symlinks are stored
+// as links and never followed. Entries other than regular files, directories
+// and symlinks are left out.
+func WriteArchive(w io.Writer, dir string, format Format) error {
+	switch format {
+	case FormatZip:
+		zw := zip.NewWriter(w)
+		if err := walkArchiveDir(dir, func(name string, info fs.FileInfo, link string, open func() (*os.File, error)) error {
+			return writeZipEntry(zw, name, info, link, open)
+		}); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to finish zip archive: %w", err)
+		}
+		return nil
+	case FormatTar, FormatTarGzip, FormatTarZstd:
+	default:
+		return fmt.Errorf("%w: '%s' cannot be used for directory archives", ErrUnsupportedFormat, format)
+	}
+
+	var compressor io.WriteCloser
+	switch format {
+	case FormatTarGzip:
+		compressor = gzip.NewWriter(w)
+	case FormatTarZstd:
+		encoder, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		compressor = encoder
+	}
+	tarOutput := w
+	if compressor != nil {
+		tarOutput = compressor
+	}
+	tw := tar.NewWriter(tarOutput)
+	if err := walkArchiveDir(dir, func(name string, info fs.FileInfo, link string, open func() (*os.File, error)) error {
+		return writeTarEntry(tw, name, info, link, open)
+	}); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish tar archive: %w", err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return fmt.Errorf("failed to finish %s archive: %w", format, err)
+		}
+	}
+	return nil
+}
+
+// walkArchiveDir calls add for every regular file, directory and symlink
+// below dir, parents first, with its slash separated name relative to dir.
+// link is the target of a symlink, and open opens a regular file.
+func walkArchiveDir(dir string, add func(name string, info fs.FileInfo, link string, open func() (*os.File, error)) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", p, err)
+		}
+		if p == dir {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat '%s': %w", p, err)
+		}
+		var link string
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return fmt.Errorf("failed to read symlink '%s': %w", p, err)
+			}
+		default:
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return fmt.Errorf("internal error resolving '%s': %w", p, err)
+		}
+		return add(filepath.ToSlash(rel), info, link, func() (*os.File, error) { return os.Open(p) })
+	})
+}
+
+func writeTarEntry(tw *tar.Writer, name string, info fs.FileInfo, link string, open func() (*os.File, error)) error {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("failed to create tar header for '%s': %w", name, err)
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	var f *os.File
+	if info.Mode().IsRegular() {
+		if f, err = openArchiveFile(name, open); err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				_ = err
+			}
+		}()
+		// The file may have changed size since it was walked, so the header
+		// records the size of the opened file.
+		opened, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat '%s': %w", name, err)
+		}
+		header.Size = opened.Size()
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write tar header for '%s': %w", name, err)
+	}
+	if f == nil {
+		return nil
+	}
+	// Exactly the size recorded in the header is written, so that a log
+	// appended to or truncated while it is archived does not fail the
+	// download.
+	return copyArchiveFile(tw, name, f, header.Size)
+}
+
+func writeZipEntry(zw *zip.Writer, name string, info fs.FileInfo, link string, open func() (*os.File, error)) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("failed to create zip header for '%s': %w", name, err)
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	} else if info.Mode().IsRegular() {
+		header.Method = zip.Deflate
+	}
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write zip header for '%s': %w", name, err)
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		// Zip stores the target of a symlink as its content.
+		if _, err := io.WriteString(entry, link); err != nil {
+			return fmt.Errorf("failed to write symlink '%s': %w", name, err)
+		}
+	case info.Mode().IsRegular():
+		f, err := openArchiveFile(name, open)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				_ = err
+			}
+		}()
+		return copyArchiveFile(entry, name, f, -1)
+	}
+	return nil
+}
+
+func openArchiveFile(name string, open func() (*os.File, error)) (*os.File, error) {
+	f, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", name, err)
+	}
+	return f, nil
+}
+
+// copyArchiveFile copies f to w. Unless size is negative, exactly size bytes
+// are written, padding a file that is shorter with zeros.
+func copyArchiveFile(w io.Writer, name string, f *os.File, size int64) error {
+	if size < 0 {
+		if _, err := io.Copy(w, f); err != nil {
+			return fmt.Errorf("failed to archive '%s': %w", name, err)
+		}
+		return nil
+	}
+	n, err := io.Copy(w, io.LimitReader(f, size))
+	if err != nil {
+		return fmt.Errorf("failed to archive '%s': %w", name, err)
+	}
+	if _, err := io.CopyN(w, zeroReader{}, size-n); err != nil {
+		return fmt.Errorf("failed to archive '%s': %w", name, err)
+	}
+	return nil
+}
+
+// zeroReader reads an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,149 @@
+package service_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestParseArchiveFormat(t *testing.T) {
+	for value, expected := range map[string]service.Format{
+		"":        service.FormatTarGzip,
+		"tgz":     service.FormatTarGzip,
+		"tar":     service.FormatTar,
+		"tar.zst": service.FormatTarZstd,
+		"zip":     service.FormatZip,
+	} {
+		format, err := service.ParseArchiveFormat(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, format, value)
+	}
+	for _, value := range []string{"gz", "plain", "rar"} {
+		_, err := service.ParseArchiveFormat(value)
+		assert.ErrorIs(t, err, service.ErrUnsupportedFormat, value)
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("home"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "run.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "bin", "run.sh"), 0755))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "index.html"), mtime, mtime))
+	require.NoError(t, os.Symlink("index.html", filepath.Join(dir, "home.html")))
+
+	t.Run("tar.gz", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, service.WriteArchive(&buf, dir, service.FormatTarGzip))
+
+		gz, err := gzip.NewReader(&buf)
+		require.NoError(t, err)
+		headers := make(map[string]*tar.Header)
+		contents := make(map[string]string)
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			headers[header.Name] = header
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			contents[header.Name] = string(content)
+		}
+
+		require.Contains(t, headers, "bin/")
+		assert.Equal(t, byte(tar.TypeDir), headers["bin/"].Typeflag)
+		assert.Equal(t, "home", contents["index.html"])
+		assert.True(t, mtime.Equal(headers["index.html"].ModTime))
+		assert.Equal(t, int64(0755), headers["bin/run.sh"].Mode&0777)
+		assert.Equal(t, byte(tar.TypeSymlink), headers["home.html"].Typeflag)
+		assert.Equal(t, "index.html", headers["home.html"].Linkname)
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, service.WriteArchive(&buf, dir, service.FormatZip))
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		files := make(map[string]*zip.File)
+		for _, f := range zr.File {
+			files[f.Name] = f
+		}
+		require.Contains(t, files, "index.html")
+		rc, err := files["index.html"].Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, "home", string(content))
+		assert.True(t, mtime.Equal(files["index.html"].Modified))
+		assert.Equal(t, fs.FileMode(0755), files["bin/run.sh"].Mode().Perm())
+		assert.NotZero(t, files["home.html"].Mode()&fs.ModeSymlink)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, service.WriteArchive(&buf, dir, service.FormatTar))
+		targetDir := filepath.Join(t.TempDir(), "copy")
+		_, err := service.UploadFileWithOptions(&buf, targetDir, "backup.tar", "", service.UploadOptions{IsPutRequest: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bin/run.sh", "home.html", "index.html"}, listFiles(t, targetDir))
+		link, err := os.Readlink(filepath.Join(targetDir, "home.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "index.html", link)
+	})
+	t.Run("file truncated while archived", func(t *testing.T) {
+		dir := t.TempDir()
+		logPath := filepath.Join(dir, "app.log")
+		require.NoError(t, os.WriteFile(logPath, bytes.Repeat([]byte("x"), 100), 0644))
+
+		var buf bytes.Buffer
+		w := &truncatingWriter{Writer: &buf, marker: []byte("app.log"), truncate: func() error { return os.Truncate(logPath, 10) }}
+		require.NoError(t, service.WriteArchive(w, dir, service.FormatTar))
+
+		tr := tar.NewReader(&buf)
+		header, err := tr.Next()
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		assert.Len(t, content, int(header.Size), "The entry should be padded to its header size")
+		assert.Equal(t, bytes.Repeat([]byte("x"), 10), content[:10])
+	})
+}
+
+// truncatingWriter calls truncate once marker is written, such as when the
+// header of an entry has been written but not its content.
+type truncatingWriter struct {
+	io.Writer
+	marker   []byte
+	truncate func() error
+	done     bool
+}
+
+func (w *truncatingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if !w.done && bytes.Contains(p, w.marker) {
+		w.done = true
+		if err := w.truncate(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+var (
+	ErrInvalidChecksum  = errors.New("invalid checksum")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// uploadDigester hashes the raw upload stream as it is consumed.
+type uploadDigester struct {
+	sha256 hash.Hash
+	sha512 hash.Hash
+	n      int64
+}
+
+func newUploadDigester() *uploadDigester {
+	return &uploadDigester{sha256: sha256.New(), sha512: sha512.New()}
+}
+
+func (d *uploadDigester) Write(p []byte) (int, error) {
+	d.sha256.Write(p)
+	d.sha512.Write(p)
+	d.n += int64(len(p))
+	return len(p), nil
+}
+
+// verify compares the computed digests with the expected hex encoded values.
+// Empty expectations are not checked.
+func (d *uploadDigester) verify(expectedSHA256, expectedSHA512 string) error {
+	checks := []struct {
+		name     string
+		expected string
+		actual   hash.Hash
+	}{
+		{"sha256", expectedSHA256, d.sha256},
+		{"sha512", expectedSHA512, d.sha512},
+	}
+	for _, check := range checks {
+		if check.expected == "" {
+			continue
+		}
+		actual := hex.EncodeToString(check.actual.Sum(nil))
+		if !strings.EqualFold(check.expected, actual) {
+			return fmt.Errorf("%w: expected %s %s, got %s", ErrChecksumMismatch, check.name, check.expected, actual)
+		}
+	}
+	return nil
+}
+
+func validateChecksums(expectedSHA256, expectedSHA512 string) error {
+	checks := []struct {
+		name     string
+		value    string
+		hexBytes int
+	}{
+		{"sha256", expectedSHA256, sha256.Size},
+		{"sha512", expectedSHA512, sha512.Size},
+	}
+	for _, check := range checks {
+		if check.value == "" {
+			continue
+		}
+		decoded, err := hex.DecodeString(check.value)
+		if err != nil || len(decoded) != check.hexBytes {
+			return fmt.Errorf("%w: %s must be %d hex characters", ErrInvalidChecksum, check.name, check.hexBytes*2)
+		}
+	}
+	return nil
+}
+
+// drain reads the rest of an upload so that the digest covers bytes an
+// extractor did not need, such as tar padding after the end-of-archive marker.
+func drain(r io.Reader) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("failed to read the rest of the upload stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_Checksums(t *testing.T) {
+	tarBytes := createTestTar(t, map[string]string{"index.html": "new"}).Bytes()
+	sum256 := sha256.Sum256(tarBytes)
+	sum512 := sha512.Sum512(tarBytes)
+	expected256 := hex.EncodeToString(sum256[:])
+	expected512 := hex.EncodeToString(sum512[:])
+
+	t.Run("digests are always returned", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		result, err := service.UploadFileWithOptions(bytes.NewReader(tarBytes), targetDir, "site.tar", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, expected256, result.SHA256)
+		assert.Equal(t, expected512, result.SHA512)
+	})
+
+	t.Run("zip digest covers the whole archive", func(t *testing.T) {
+		zipBytes := createTestZip(t, map[string]string{"index.html": "zip"}).Bytes()
+		sum := sha256.Sum256(zipBytes)
+		targetDir := filepath.Join(t.TempDir(), "target")
+		result, err := service.UploadFileWithOptions(bytes.NewReader(zipBytes), targetDir, "site.zip", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString(sum[:]), result.SHA256)
+	})
+
+	t.Run("matching digests commit the upload", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		_, err := service.UploadFileWithOptions(bytes.NewReader(tarBytes), targetDir, "site.tar", "", service.UploadOptions{
+			SHA256: strings.ToUpper(expected256),
+			SHA512: expected512,
+		})
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+
+	for method, isPut := range map[string]bool{"POST": false, "PUT": true} {
+		t.Run(method+" mismatch leaves target untouched", func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			require.NoError(t, os.MkdirAll(targetDir, 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(targetDir, "index.html"), []byte("old"), 0644))
+
+			_, err := service.UploadFileWithOptions(bytes.NewReader(tarBytes), targetDir, "site.tar", "", service.UploadOptions{
+				IsPutRequest: isPut,
+				SHA256:       strings.Repeat("0", 64),
+			})
+			require.ErrorIs(t, err, service.ErrChecksumMismatch)
+
+			content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+			require.NoError(t, err)
+			assert.Equal(t, "old", string(content))
+
+			siblings, err := os.ReadDir(filepath.Dir(targetDir))
+			require.NoError(t, err)
+			assert.Len(t, siblings, 1, "staging directory should be removed")
+		})
+	}
+
+	t.Run("malformed digest is rejected", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		_, err := service.UploadFileWithOptions(bytes.NewReader(tarBytes), targetDir, "site.tar", "", service.UploadOptions{SHA512: "abc"})
+		require.ErrorIs(t, err, service.ErrInvalidChecksum)
+		_, err = os.Stat(targetDir)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestUploadFile_PostMergesIntoExistingTarget(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "target")
+	require.NoError(t, os.MkdirAll(filepath.Join(targetDir, "assets"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "assets", "keep.css"), []byte("keep"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "index.html"), []byte("old"), 0644))
+
+	archive := createTestTar(t, map[string]string{
+		"index.html":    "new",
+		"assets/app.js": "js",
+	})
+	_, err := service.UploadFile(archive, targetDir, "site.tar", "", false)
+	require.NoError(t, err)
+
+	for name, expected := range map[string]string{
+		"index.html":      "new",
+		"assets/app.js":   "js",
+		"assets/keep.css": "keep",
+	} {
+		content, err := os.ReadFile(filepath.Join(targetDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), name)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressionFormat describes a stream compression that can wrap either a tar
+// archive or a single file.
+type compressionFormat struct {
+	name            string
+	description     string
+	archiveFormat   Format
+	fileFormat      Format
+	magic           []byte
+	archiveSuffixes []string
+	fileSuffix      string
+	defaultFileName string
+	newReader       func(io.Reader) (io.ReadCloser, error)
+}
+
+var compressionFormats = []compressionFormat{
+	{
+		name:            "gzip",
+		description:     "gzipped",
+		archiveFormat:   FormatTarGzip,
+		fileFormat:      FormatGzip,
+		magic:           []byte{0x1f, 0x8b},
+		archiveSuffixes: []string{".tar.gz", ".tgz"},
+		fileSuffix:      ".gz",
+		defaultFileName: "gzipped_file",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		name:            "zstd",
+		description:     "zstd-compressed",
+		archiveFormat:   FormatTarZstd,
+		fileFormat:      FormatZstd,
+		magic:           []byte{0x28, 0xb5, 0x2f, 0xfd},
+		archiveSuffixes: []string{".tar.zst", ".tzst"},
+		fileSuffix:      ".zst",
+		defaultFileName: "zstd_file",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+	{
+		name:            "xz",
+		description:     "xz-compressed",
+		archiveFormat:   FormatTarXz,
+		fileFormat:      FormatXz,
+		magic:           []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		archiveSuffixes: []string{".tar.xz", ".txz"},
+		fileSuffix:      ".xz",
+		defaultFileName: "xz_file",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(xr), nil
+		},
+	},
+	{
+		name:            "bzip2",
+		description:     "bzip2-compressed",
+		archiveFormat:   FormatTarBzip2,
+		fileFormat:      FormatBzip2,
+		magic:           []byte{'B', 'Z', 'h'},
+		archiveSuffixes: []string{".tar.bz2", ".tbz2"},
+		fileSuffix:      ".bz2",
+		defaultFileName: "bzip2_file",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+}
@@ -0,0 +1,116 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+
+	"deploytar/service"
+)
+
+// bzip2 has no encoder in the standard library, so these fixtures were
+// produced with Python's bz2 module.
+const (
+	// tar containing file_in_tbz2.txt = "bzip2 content"
+	testTarBz2Hex = "425a683931415926535996bb325f0000737b80ca800200400177004000fb25de50080820007510a7946806201a1b49e50494268683400001f7501a840d721087735ca460f9502180c2254e7b112304448420079cd72d5ceb42532d019e87c4e4f40c69434568b605f2c18371141f8bb9229c28484b5d992f80"
+	// "single bzip2 file"
+	testBz2Hex = "425a68393141592653591b2b519900000799804000100013a54810200022000c840d03421fa351bb010541f1772453850901b2b51990"
+)
+
+func zstdCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw, err := zstd.NewWriter(buf)
+	require.NoError(t, err)
+	_, err = zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func xzCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	xw, err := xz.NewWriter(buf)
+	require.NoError(t, err)
+	_, err = xw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, xw.Close())
+	return buf.Bytes()
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestUploadFile_CompressedFormats(t *testing.T) {
+	tarBytes := createTestTar(t, map[string]string{"file_in_archive.txt": "archive content"}).Bytes()
+
+	archiveTests := []struct {
+		name         string
+		fileName     string
+		content      []byte
+		expectedFile string
+		expectedText string
+	}{
+		{"tar.zst", "bundle.tar.zst", zstdCompress(t, tarBytes), "file_in_archive.txt", "archive content"},
+		{"tzst", "bundle.tzst", zstdCompress(t, tarBytes), "file_in_archive.txt", "archive content"},
+		{"tar.xz", "bundle.tar.xz", xzCompress(t, tarBytes), "file_in_archive.txt", "archive content"},
+		{"txz", "bundle.TXZ", xzCompress(t, tarBytes), "file_in_archive.txt", "archive content"},
+		{"tar.bz2", "bundle.tar.bz2", mustDecodeHex(t, testTarBz2Hex), "file_in_tbz2.txt", "bzip2 content"},
+		{"tbz2", "bundle.tbz2", mustDecodeHex(t, testTarBz2Hex), "file_in_tbz2.txt", "bzip2 content"},
+	}
+	for _, tt := range archiveTests {
+		t.Run("extract "+tt.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			finalPath, err := service.UploadFile(bytes.NewReader(tt.content), targetDir, tt.fileName, "", false)
+			require.NoError(t, err)
+			assert.Equal(t, targetDir, finalPath)
+
+			content, err := os.ReadFile(filepath.Join(targetDir, tt.expectedFile))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedText, string(content))
+		})
+	}
+
+	singleTests := []struct {
+		name         string
+		fileName     string
+		content      []byte
+		expectedName string
+		expectedText string
+	}{
+		{"zst", "notes.txt.zst", zstdCompress(t, []byte("single zstd file")), "notes.txt", "single zstd file"},
+		{"xz", "notes.txt.xz", xzCompress(t, []byte("single xz file")), "notes.txt", "single xz file"},
+		{"bz2", "notes.txt.bz2", mustDecodeHex(t, testBz2Hex), "notes.txt", "single bzip2 file"},
+	}
+	for _, tt := range singleTests {
+		t.Run("decompress single "+tt.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			finalPath, err := service.UploadFile(bytes.NewReader(tt.content), targetDir, tt.fileName, "", false)
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(targetDir, tt.expectedName), finalPath)
+
+			content, err := os.ReadFile(finalPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedText, string(content))
+		})
+	}
+
+	t.Run("reject corrupt xz stream", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		_, err := service.UploadFile(bytes.NewReader([]byte("not xz data")), targetDir, "bundle.tar.xz", "", false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create xz reader for archive")
+	})
+}
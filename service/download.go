@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotRegularFile = errors.New("not a regular file")
+
+// resolveExistingPath validates rawPath like ResolveAndValidatePath and
+// resolves its symlinks, so that a link inside the allowed scope cannot be
+// used to read what is outside of it.
+func resolveExistingPath(rawPath, pathPrefixEnv string) (resolvedPath string, displayPath string, err error) {
+	absPath, displayPath, err := ResolveAndValidatePath(rawPath, pathPrefixEnv)
+	if err != nil {
+		return "", "", err
+	}
+
+	root := filepath.Clean(pathPrefixEnv)
+	if root == "." || root == "/" {
+		if root, err = os.Getwd(); err != nil {
+			return "", "", fmt.Errorf("error getting current working directory: %w", err)
+		}
+	} else if root, err = filepath.Abs(root); err != nil {
+		return "", "", fmt.Errorf("failed to get absolute path for prefix '%s': %w", pathPrefixEnv, err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving '%s': %w", root, err)
+	}
+	if resolvedPath, err = filepath.EvalSymlinks(absPath); err != nil {
+		return "", "", fmt.Errorf("failed to resolve '%s': %w", displayPath, err)
+	}
+	if resolvedPath != resolvedRoot && !strings.HasPrefix(resolvedPath, strings.TrimSuffix(resolvedRoot, string(os.PathSeparator))+string(os.PathSeparator)) {
+		return "", "", errors.New("access to the requested path is forbidden (resolved path outside its allowed scope)")
+	}
+	return resolvedPath, displayPath, nil
+}
+
+// OpenFile opens the regular file at rawPath, validated and resolved like a
+// listed directory, for download. The caller closes the file.
+func OpenFile(rawPath, pathPrefixEnv string) (*os.File, os.FileInfo, error) {
+	resolvedPath, displayPath, err := resolveExistingPath(rawPath, pathPrefixEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(resolvedPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open '%s': %w", displayPath, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		if closeErr := f.Close(); closeErr != nil {
+			_ = closeErr
+		}
+		return nil, nil, fmt.Errorf("failed to stat '%s': %w", displayPath, err)
+	}
+	if !info.Mode().IsRegular() {
+		if closeErr := f.Close(); closeErr != nil {
+			_ = closeErr
+		}
+		return nil, nil, fmt.Errorf("%w: '%s'", ErrNotRegularFile, displayPath)
+	}
+	return f, info, nil
+}
@@ -0,0 +1,68 @@
+package service_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestOpenFile(t *testing.T) {
+	workDir := t.TempDir()
+	t.Chdir(workDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(workDir, "site"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "site", "app.js"), []byte("app"), 0644))
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(workDir, "site", "secret.txt")))
+
+	f, info, err := service.OpenFile("site/app.js", "")
+	require.NoError(t, err)
+	defer func() {
+		if err := f.Close(); err != nil {
+			_ = err
+		}
+	}()
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "app", string(content))
+	assert.Equal(t, int64(3), info.Size())
+
+	_, _, err = service.OpenFile("site/secret.txt", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "forbidden", "Symlinks must not escape the working directory")
+
+	_, _, err = service.OpenFile("site", "")
+	assert.ErrorIs(t, err, service.ErrNotRegularFile)
+
+	_, _, err = service.OpenFile("site/missing.js", "")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestOpenFile_RelativePathPrefix(t *testing.T) {
+	workDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	t.Chdir(workDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(workDir, "data", "site"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "data", "site", "app.js"), []byte("app"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "outside.txt"), []byte("secret"), 0644))
+
+	f, _, err := service.OpenFile("site/app.js", "data")
+	require.NoError(t, err)
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "app", string(content))
+	require.NoError(t, f.Close())
+
+	resolvedDir, _, err := service.ResolveDirectory("site", "data")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(workDir, "data", "site"), resolvedDir)
+
+	_, _, err = service.OpenFile("../outside.txt", "data")
+	assert.Error(t, err)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiffEntry describes one file of an upload diff. For modified files the
+// Previous fields describe the file currently in place; for deleted files
+// Size and SHA256 do. Symlinks are compared by their target.
+type DiffEntry struct {
+	Path           string
+	Size           int64
+	SHA256         string
+	PreviousSize   int64
+	PreviousSHA256 string
+}
+
+// UploadDiff is the change a dry-run upload would make to its target.
+type UploadDiff struct {
+	Added     []DiffEntry
+	Modified  []DiffEntry
+	Deleted   []DiffEntry
+	Unchanged []DiffEntry
+}
+
+type fileDigest struct {
+	size   int64
+	sha256 string
+}
+
+// dryRunUpload stages parts in memory, runs the checks a real upload runs and
+// reports the difference to the current target without committing anything.
+// Staged files are hashed as they are extracted and their content discarded,
+// so the extracted tree is never written to disk.
+func dryRunUpload(parts []UploadPart, absTargetDir, pathPrefixEnv string, opts UploadOptions) ([]*UploadResult, error) {
+	// The staging directory only exists in memory; it is named like the one
+	// a real upload would use so that quotas see it in the same place.
+	stagingParent, stagingPattern, _ := stagingLocation(absTargetDir, pathPrefixEnv)
+	currentDir := absTargetDir
+	quotaTargetDir := absTargetDir
+	stagingDir := filepath.Join(stagingParent, strings.TrimSuffix(stagingPattern, "*")+"dry-run")
+	if opts.Release {
+		currentDir = filepath.Join(absTargetDir, currentLinkName)
+		stagingDir = filepath.Join(absTargetDir, releasesDirName, ".dry-run")
+		quotaTargetDir = stagingDir
+	}
+	staged := newMemFS(stagingDir)
+
+	results, relStagedPaths, err := stageParts(staged, parts, stagingDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuotas(staged, opts.Quotas, pathPrefixEnv, quotaTargetDir, stagingDir, opts.replacedUsage(absTargetDir)); err != nil {
+		return nil, err
+	}
+
+	diff := &UploadDiff{}
+	if !excludedUpload(results) {
+		if diff, err = diffUpload(staged, stagingDir, currentDir, uploadWhiteouts(results), opts); err != nil {
+			return nil, err
+		}
+	}
+	for i, result := range results {
+		result.Path = filepath.Join(currentDir, relStagedPaths[i])
+		result.Diff = diff
+	}
+	return results, nil
+}
+
+// diffUpload compares the tree staged in fsys with the files in currentDir,
+// taking into account how the upload would be committed and its whiteouts.
+func diffUpload(fsys *memFS, stagingDir, currentDir string, whiteouts []string, opts UploadOptions) (*UploadDiff, error) {
+	before, err := digestTree(currentDir)
+	if err != nil {
+		return nil, err
+	}
+	staged, err := fsys.digests(stagingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	replacesAll := opts.Release || (opts.IsPutRequest && !opts.Sync)
+	var removals []string
+	if opts.Sync {
+		if removals, err = syncRemovals(fsys, stagingDir, currentDir, opts.Protect); err != nil {
+			return nil, err
+		}
+	}
+	if !replacesAll {
+		whiteoutPaths, err := whiteoutRemovals(fsys, stagingDir, currentDir, whiteouts)
+		if err != nil {
+			return nil, err
+		}
+		removals = append(removals, whiteoutPaths...)
+	}
+
+	diff := &UploadDiff{}
+	for name, digest := range staged {
+		entry := DiffEntry{Path: name, Size: digest.size, SHA256: digest.sha256}
+		previous, ok := before[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, entry)
+		case previous.sha256 != digest.sha256:
+			entry.PreviousSize, entry.PreviousSHA256 = previous.size, previous.sha256
+			diff.Modified = append(diff.Modified, entry)
+		default:
+			diff.Unchanged = append(diff.Unchanged, entry)
+		}
+	}
+	for name, digest := range before {
+		if _, ok := staged[name]; ok {
+			continue
+		}
+		if replacesAll || isShadowed(fsys, stagingDir, name) || isRemoved(removals, name) {
+			diff.Deleted = append(diff.Deleted, DiffEntry{Path: name, Size: digest.size, SHA256: digest.sha256})
+		}
+	}
+	for _, entries := range [][]DiffEntry{diff.Added, diff.Modified, diff.Deleted, diff.Unchanged} {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	}
+	return diff, nil
+}
+
+// isShadowed reports whether merging stagingDir, staged in fsys, replaces the
+// existing file name, because the upload has a directory in its place or a
+// file in place of one of its parent directories.
+func isShadowed(fsys stageFS, stagingDir, name string) bool {
+	if _, err := fsys.Lstat(filepath.Join(stagingDir, filepath.FromSlash(name))); err == nil {
+		return true
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if info, err := fsys.Lstat(filepath.Join(stagingDir, filepath.FromSlash(dir))); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func isRemoved(removals []string, name string) bool {
+	for _, removal := range removals {
+		if name == removal || strings.HasPrefix(name, removal+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// digestTree returns the size and SHA-256 of every file below dir, keyed by
+// slash separated relative path, leaving out staging directories. A missing
+// dir has no files.
+func digestTree(dir string) (map[string]fileDigest, error) {
+	digests := make(map[string]fileDigest)
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return digests, nil
+		}
+		return nil, fmt.Errorf("failed to resolve '%s': %w", dir, err)
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), rootStagingPrefix) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		digest, err := digestFile(p, d)
+		if err != nil {
+			return err
+		}
+		digests[filepath.ToSlash(rel)] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", dir, err)
+	}
+	return digests, nil
+}
+
+func digestFile(p string, d fs.DirEntry) (fileDigest, error) {
+	h := sha256.New()
+	if d.Type()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return fileDigest{}, err
+		}
+		h.Write([]byte(target))
+		return fileDigest{size: int64(len(target)), sha256: hex.EncodeToString(h.Sum(nil))}, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			_ = err
+		}
+	}()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	return fileDigest{size: size, sha256: hex.EncodeToString(h.Sum(nil))}, nil
+}
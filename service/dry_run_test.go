@@ -0,0 +1,132 @@
+package service_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_DryRun(t *testing.T) {
+	digest := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	paths := func(entries []service.DiffEntry) []string {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Path)
+		}
+		return names
+	}
+
+	parentDir := t.TempDir()
+	targetDir := filepath.Join(parentDir, "site")
+	existing := map[string]string{
+		"index.html":    "old home",
+		"about.html":    "about",
+		"stale.html":    "stale",
+		"assets/app.js": "app",
+	}
+	for name, content := range existing {
+		path := filepath.Join(targetDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	files := map[string]string{
+		"index.html":    "new home",
+		"about.html":    "about",
+		"assets/new.js": "new",
+	}
+
+	testCases := []struct {
+		name        string
+		opts        service.UploadOptions
+		wantDeleted []string
+	}{
+		{name: "put", opts: service.UploadOptions{IsPutRequest: true}, wantDeleted: []string{"assets/app.js", "stale.html"}},
+		{name: "post", opts: service.UploadOptions{}, wantDeleted: nil},
+		{name: "sync", opts: service.UploadOptions{Sync: true, Protect: []string{"stale.html"}}, wantDeleted: []string{"assets/app.js"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.DryRun = true
+			result, err := service.UploadFileWithOptions(createTestTar(t, files), targetDir, "site.tar", "", opts)
+			require.NoError(t, err)
+			require.NotNil(t, result.Diff)
+
+			assert.Equal(t, []service.DiffEntry{{Path: "assets/new.js", Size: 3, SHA256: digest("new")}}, result.Diff.Added)
+			assert.Equal(t, []service.DiffEntry{{
+				Path:           "index.html",
+				Size:           8,
+				SHA256:         digest("new home"),
+				PreviousSize:   8,
+				PreviousSHA256: digest("old home"),
+			}}, result.Diff.Modified)
+			assert.Equal(t, []string{"about.html"}, paths(result.Diff.Unchanged))
+			assert.Equal(t, tc.wantDeleted, paths(result.Diff.Deleted))
+
+			content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+			require.NoError(t, err)
+			assert.Equal(t, "old home", string(content), "A dry run must not write to the target")
+			_, err = os.Stat(filepath.Join(targetDir, "assets", "new.js"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+
+	t.Run("checks still apply", func(t *testing.T) {
+		archive := createTestTar(t, map[string]string{"../escape.txt": "escape"})
+		_, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", "", service.UploadOptions{DryRun: true})
+		assert.Error(t, err)
+
+		limits := service.Limits{MaxEntries: 1}
+		_, err = service.UploadFileWithOptions(createTestTar(t, files), targetDir, "site.tar", "", service.UploadOptions{DryRun: true, Limits: &limits})
+		assert.ErrorIs(t, err, service.ErrLimitExceeded)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		appDir := filepath.Join(parentDir, "app")
+		_, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "v1"}), appDir, "site.tar", "", service.UploadOptions{Release: true})
+		require.NoError(t, err)
+
+		result, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "v2"}), appDir, "site.tar", "", service.UploadOptions{Release: true, DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"index.html"}, paths(result.Diff.Modified))
+		releases, err := os.ReadDir(filepath.Join(appDir, "releases"))
+		require.NoError(t, err)
+		assert.Len(t, releases, 1, "A dry run must not create a release")
+	})
+
+	t.Run("nothing is extracted to disk", func(t *testing.T) {
+		// Staging in a temporary directory fails when there is none.
+		t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+		archive := createTestTarWithHeaders(t, []*tar.Header{
+			{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "docs/a.txt", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "latest", Typeflag: tar.TypeSymlink, Linkname: "docs/a.txt"},
+			{Name: "copy.txt", Typeflag: tar.TypeLink, Linkname: "docs/a.txt"},
+		}, map[string]string{"docs/a.txt": "a"})
+
+		result, err := service.UploadFileWithOptions(archive, targetDir, "docs.tar", "", service.UploadOptions{DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, []service.DiffEntry{
+			{Path: "copy.txt", Size: 1, SHA256: digest("a")},
+			{Path: "docs/a.txt", Size: 1, SHA256: digest("a")},
+			{Path: "latest", Size: 10, SHA256: digest("docs/a.txt")},
+		}, result.Diff.Added)
+		_, err = os.Lstat(filepath.Join(targetDir, "latest"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	entries, err := os.ReadDir(parentDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
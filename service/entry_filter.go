@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var ErrInvalidEntryFilter = errors.New("invalid entry filter")
+
+// entryFilter selects and renames archive entries before they are extracted.
+// The traversal checks apply to the renamed entries.
+type entryFilter struct {
+	stripComponents int
+	subpath         string
+	include         []string
+	exclude         []string
+}
+
+// ParsePatterns splits a comma or newline separated list of glob patterns and
+// checks that each one is valid.
+func ParsePatterns(text string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if err := validatePattern(pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func validatePattern(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("%w: invalid pattern '%s'", ErrInvalidEntryFilter, pattern)
+		}
+	}
+	return nil
+}
+
+func newEntryFilter(opts UploadOptions) (entryFilter, error) {
+	if opts.StripComponents < 0 {
+		return entryFilter{}, fmt.Errorf("%w: strip_components must not be negative", ErrInvalidEntryFilter)
+	}
+	subpath := strings.Trim(path.Clean("/"+opts.Subpath), "/")
+	if opts.Subpath != "" && (subpath == "" || strings.Contains("/"+opts.Subpath+"/", "/../")) {
+		return entryFilter{}, fmt.Errorf("%w: subpath '%s' must name a directory inside the archive", ErrInvalidEntryFilter, opts.Subpath)
+	}
+	exclude := append(append([]string(nil), opts.DefaultExclude...), opts.Exclude...)
+	for _, patterns := range [][]string{exclude, opts.Include} {
+		for _, pattern := range patterns {
+			if err := validatePattern(pattern); err != nil {
+				return entryFilter{}, err
+			}
+		}
+	}
+	return entryFilter{stripComponents: opts.StripComponents, subpath: subpath, include: opts.Include, exclude: exclude}, nil
+}
+
+// apply returns the name an entry is extracted under, or false when the entry
+// is not selected. Leading path components are stripped first, like tar
+// --strip-components, and the subpath is then matched against what remains
+// and removed, so the selected subtree is extracted into the target itself.
+func (f entryFilter) apply(name string) (string, bool) {
+	if f.stripComponents == 0 && f.subpath == "" {
+		return name, true
+	}
+	var components []string
+	for _, component := range strings.Split(name, "/") {
+		if component != "" && component != "." {
+			components = append(components, component)
+		}
+	}
+	if len(components) <= f.stripComponents {
+		return "", false
+	}
+	rest := strings.Join(components[f.stripComponents:], "/")
+	if f.subpath != "" {
+		var ok bool
+		if rest, ok = strings.CutPrefix(rest, f.subpath+"/"); !ok {
+			return "", false
+		}
+	}
+	if strings.HasSuffix(name, "/") {
+		rest += "/"
+	}
+	return rest, true
+}
+
+// skipReason reports why an entry is left out by the include and exclude
+// patterns. A pattern matching a directory also matches everything below it,
+// and include patterns do not apply to directories.
+func (f entryFilter) skipReason(name string, isDir bool) (string, bool) {
+	for _, pattern := range f.exclude {
+		if matchPattern(pattern, name) {
+			return fmt.Sprintf("excluded by pattern '%s'", pattern), true
+		}
+	}
+	if len(f.include) == 0 || isDir {
+		return "", false
+	}
+	for _, pattern := range f.include {
+		if matchPattern(pattern, name) {
+			return "", false
+		}
+	}
+	return "not matched by any include pattern", true
+}
+
+// matchPattern reports whether a slash separated glob matches name or one of
+// its parent directories. "**" matches any number of path segments, and a
+// pattern without a slash matches at any depth, so "*.map" matches
+// "js/app.js.map" while "/node_modules" only matches at the top.
+func matchPattern(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	patternSegments := strings.Split(pattern, "/")
+	nameSegments := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	for i := 1; i <= len(nameSegments); i++ {
+		if matchSegments(patternSegments, nameSegments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
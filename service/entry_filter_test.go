@@ -0,0 +1,211 @@
+package service_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(files)
+	return files
+}
+
+func TestUploadFileWithOptions_EntryFilter(t *testing.T) {
+	files := map[string]string{
+		"project-1.2.3/README.md":          "readme",
+		"project-1.2.3/dist/index.html":    "home",
+		"project-1.2.3/dist/assets/app.js": "app",
+		"project-1.2.3/src/main.go":        "package main",
+	}
+
+	testCases := []struct {
+		name     string
+		archive  func(t *testing.T) *bytes.Buffer
+		fileName string
+		strip    int
+		subpath  string
+		want     []string
+	}{
+		{
+			name:     "strip components",
+			archive:  func(t *testing.T) *bytes.Buffer { return createTestTar(t, files) },
+			fileName: "site.tar",
+			strip:    1,
+			want:     []string{"README.md", "dist/assets/app.js", "dist/index.html", "src/main.go"},
+		},
+		{
+			name:     "strip components and subpath",
+			archive:  func(t *testing.T) *bytes.Buffer { return createTestTarGz(t, files) },
+			fileName: "site.tar.gz",
+			strip:    1,
+			subpath:  "dist/",
+			want:     []string{"assets/app.js", "index.html"},
+		},
+		{
+			name:     "zip subpath",
+			archive:  func(t *testing.T) *bytes.Buffer { return createTestZip(t, files) },
+			fileName: "site.zip",
+			subpath:  "project-1.2.3/dist",
+			want:     []string{"assets/app.js", "index.html"},
+		},
+		{
+			name:     "everything stripped",
+			archive:  func(t *testing.T) *bytes.Buffer { return createTestTar(t, files) },
+			fileName: "site.tar",
+			strip:    4,
+			want:     nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "site")
+			opts := service.UploadOptions{IsPutRequest: true, StripComponents: tc.strip, Subpath: tc.subpath}
+			_, err := service.UploadFileWithOptions(tc.archive(t), targetDir, tc.fileName, "", opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, listFiles(t, targetDir))
+		})
+	}
+
+	t.Run("traversal is checked after stripping", func(t *testing.T) {
+		archive := createTestTar(t, map[string]string{"wrap/../../escape.sh": "escape"})
+		_, err := service.UploadFileWithOptions(archive, t.TempDir(), "site.tar", "", service.UploadOptions{StripComponents: 1})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsafe path")
+	})
+
+	t.Run("hard link to an entry outside the subpath", func(t *testing.T) {
+		headers := []*tar.Header{
+			{Name: "wrap/shared.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 6},
+			{Name: "wrap/dist/shared.txt", Typeflag: tar.TypeLink, Linkname: "wrap/shared.txt"},
+			{Name: "wrap/dist/index.html", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		}
+		archive := createTestTarWithHeaders(t, headers, map[string]string{"wrap/shared.txt": "shared", "wrap/dist/index.html": "home"})
+		targetDir := t.TempDir()
+		result, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", "", service.UploadOptions{StripComponents: 1, Subpath: "dist"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"index.html"}, listFiles(t, targetDir))
+		require.Len(t, result.Skipped, 1)
+		assert.Equal(t, "shared.txt", result.Skipped[0].Name)
+	})
+
+	for _, opts := range []service.UploadOptions{{StripComponents: -1}, {Subpath: "../dist"}, {Subpath: "/"}} {
+		_, err := service.UploadFileWithOptions(createTestTar(t, files), t.TempDir(), "site.tar", "", opts)
+		assert.ErrorIs(t, err, service.ErrInvalidEntryFilter)
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := service.ParsePatterns("*.map, .git/**\nnode_modules/**,,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.map", ".git/**", "node_modules/**"}, patterns)
+
+	_, err = service.ParsePatterns("[")
+	assert.ErrorIs(t, err, service.ErrInvalidEntryFilter)
+}
+
+func TestUploadFileWithOptions_IncludeExclude(t *testing.T) {
+	files := map[string]string{
+		"index.html":                  "home",
+		"js/app.js":                   "app",
+		"js/app.js.map":               "map",
+		".git/config":                 "git",
+		"node_modules/lib/index.js":   "lib",
+		"docs/node_modules/keep.html": "nested",
+	}
+
+	testCases := []struct {
+		name        string
+		opts        service.UploadOptions
+		want        []string
+		wantSkipped []string
+	}{
+		{
+			name:        "exclude",
+			opts:        service.UploadOptions{DefaultExclude: []string{".git/**"}, Exclude: []string{"*.map", "/node_modules"}},
+			want:        []string{"docs/node_modules/keep.html", "index.html", "js/app.js"},
+			wantSkipped: []string{".git/config", "js/app.js.map", "node_modules/lib/index.js"},
+		},
+		{
+			name:        "include",
+			opts:        service.UploadOptions{Include: []string{"**/*.html"}},
+			want:        []string{"docs/node_modules/keep.html", "index.html"},
+			wantSkipped: []string{".git/config", "js/app.js", "js/app.js.map", "node_modules/lib/index.js"},
+		},
+		{
+			name:        "exclude takes precedence",
+			opts:        service.UploadOptions{Include: []string{"js"}, Exclude: []string{"*.map"}},
+			want:        []string{"js/app.js"},
+			wantSkipped: []string{".git/config", "docs/node_modules/keep.html", "index.html", "js/app.js.map", "node_modules/lib/index.js"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "site")
+			opts := tc.opts
+			opts.IsPutRequest = true
+			result, err := service.UploadFileWithOptions(createTestTar(t, files), targetDir, "site.tar", "", opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, listFiles(t, targetDir))
+
+			var skipped []string
+			for _, entry := range result.Skipped {
+				skipped = append(skipped, entry.Name)
+			}
+			sort.Strings(skipped)
+			assert.Equal(t, tc.wantSkipped, skipped)
+		})
+	}
+
+	t.Run("single file", func(t *testing.T) {
+		targetDir := t.TempDir()
+		result, err := service.UploadFileWithOptions(bytes.NewReader([]byte("map")), targetDir, "app.js.map", "", service.UploadOptions{Exclude: []string{"*.map"}})
+		require.NoError(t, err)
+		assert.Empty(t, listFiles(t, targetDir))
+		require.Len(t, result.Skipped, 1)
+		assert.Equal(t, "app.js.map", result.Skipped[0].Name)
+		assert.Contains(t, result.Skipped[0].Reason, "*.map")
+	})
+
+	t.Run("excluded single file leaves the target alone", func(t *testing.T) {
+		targetDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(targetDir, "index.html"), []byte("home"), 0644))
+		opts := service.UploadOptions{IsPutRequest: true, DefaultExclude: []string{"*.map"}}
+		result, err := service.UploadFileWithOptions(bytes.NewReader([]byte("map")), targetDir, "app.js.map", "", opts)
+		require.NoError(t, err)
+		require.Len(t, result.Skipped, 1)
+		assert.Equal(t, []string{"index.html"}, listFiles(t, targetDir), "A PUT that writes nothing should not be committed")
+
+		opts.DryRun = true
+		result, err = service.UploadFileWithOptions(bytes.NewReader([]byte("map")), targetDir, "app.js.map", "", opts)
+		require.NoError(t, err)
+		assert.Empty(t, result.Diff.Deleted)
+	})
+}
@@ -2,14 +2,17 @@ package service
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bufio"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type DirectoryEntryService struct {
@@ -113,7 +116,557 @@ func ListDirectory(validatedAbsPath string, originalRequestPath string) ([]Direc
 	return entries, parentLink, nil
 }
 
+var ErrNoUploadParts = errors.New("no files to upload")
+
+// UploadOptions controls how UploadFileWithOptions writes an upload. Client
+// supplied options are serialized with upload sessions; server-side settings
+// are not.
+type UploadOptions struct {
+	IsPutRequest bool `json:"is_put_request,omitempty"`
+	// Sync merges the upload into the target and then deletes the entries it
+	// does not contain, except those matching a Protect pattern. It takes
+	// precedence over IsPutRequest.
+	Sync    bool     `json:"sync,omitempty"`
+	Protect []string `json:"-"`
+	// DryRun runs every check of the upload and reports the resulting
+	// UploadResult.Diff without writing to the target.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Release writes the upload into a new <target>/releases/<id> directory
+	// and points the <target>/current symlink at it.
+	Release bool `json:"release,omitempty"`
+	// Format overrides content detection when set.
+	Format Format `json:"format,omitempty"`
+	// StripComponents removes leading path components from archive entries,
+	// and Subpath restricts extraction to the entries below it.
+	StripComponents int    `json:"strip_components,omitempty"`
+	Subpath         string `json:"subpath,omitempty"`
+	// Include and Exclude are glob patterns selecting the archive entries,
+	// or the single file, that are written. DefaultExclude is the server-side
+	// list applied to every upload.
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	DefaultExclude []string `json:"-"`
+	// ModePolicy controls extracted permissions. DefaultModePolicy is used
+	// when it is nil.
+	ModePolicy *ModePolicy `json:"-"`
+	// SHA256 and SHA512 are optional hex encoded digests of the upload. The
+	// upload is not committed when a digest does not match.
+	SHA256 string `json:"sha256,omitempty"`
+	SHA512 string `json:"sha512,omitempty"`
+	// Signature is a detached minisign or SSH signature over the upload.
+	// It is required when TrustedKeys is not empty.
+	Signature   string       `json:"signature,omitempty"`
+	TrustedKeys []TrustedKey `json:"-"`
+	// Limits bounds the size of the upload and of its extracted content.
+	// No limits apply when it is nil.
+	Limits *Limits `json:"-"`
+	// Quotas are checked against the staged upload before it is committed.
+	Quotas []Quota `json:"-"`
+	// LockTimeout is how long the upload waits for a conflicting deployment
+	// to the target, a parent or a child to finish; it fails right away when
+	// zero. It does not change what is deployed, so it is left out of
+	// idempotency fingerprints. LockDir, when set, holds lock files shared
+	// with other processes.
+	LockTimeout time.Duration `json:"-"`
+	LockDir     string        `json:"-"`
+}
+
+// replacedUsage returns the quota accounting for the usage the upload
+// removes from targetDir when it is committed.
+func (opts UploadOptions) replacedUsage(targetDir string) func(fsys stageFS, stagedDir, dir string) (diskUsage, error) {
+	switch {
+	case opts.Release:
+		return replacedByRelease
+	case opts.Sync:
+		return replacedBySync(targetDir, opts.Protect)
+	case opts.IsPutRequest:
+		return replacedByPut
+	default:
+		return replacedByMerge
+	}
+}
+
+func (opts UploadOptions) modePolicy() ModePolicy {
+	if opts.ModePolicy != nil {
+		return *opts.ModePolicy
+	}
+	return DefaultModePolicy()
+}
+
+func (opts UploadOptions) limits() Limits {
+	if opts.Limits != nil {
+		return *opts.Limits
+	}
+	return Limits{}
+}
+
+// SkippedEntry is an archive entry that was not extracted, such as a device
+// node or FIFO.
+type SkippedEntry struct {
+	Name   string
+	Reason string
+}
+
+// UploadResult describes where an upload was written.
+type UploadResult struct {
+	Path      string
+	ReleaseID string
+	Format    Format
+	// Skipped lists archive entries that were not extracted.
+	Skipped []SkippedEntry
+	// SHA256 and SHA512 are the hex encoded digests of the uploaded bytes.
+	SHA256 string
+	SHA512 string
+	// Diff is set for dry runs.
+	Diff *UploadDiff
+	// whiteouts are the whiteout entries of the archive, relative to the
+	// staging directory.
+	whiteouts []string
+}
+
 func UploadFile(inputStream io.Reader, targetDirUserPath, fileName, pathPrefixEnv string, isPutRequest bool) (finalPath string, err error) {
+	result, err := UploadFileWithOptions(inputStream, targetDirUserPath, fileName, pathPrefixEnv, UploadOptions{IsPutRequest: isPutRequest})
+	if err != nil {
+		return "", err
+	}
+	return result.Path, nil
+}
+
+func UploadFileWithOptions(inputStream io.Reader, targetDirUserPath, fileName, pathPrefixEnv string, opts UploadOptions) (*UploadResult, error) {
+	results, err := UploadFilesWithOptions(singleUploadPart(inputStream, fileName, opts), targetDirUserPath, pathPrefixEnv, opts)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// singleUploadPart describes an upload of one file, whose checksums and
+// signature are given with the options.
+func singleUploadPart(inputStream io.Reader, fileName string, opts UploadOptions) []UploadPart {
+	return []UploadPart{{
+		Reader:    inputStream,
+		FileName:  fileName,
+		Format:    opts.Format,
+		SHA256:    opts.SHA256,
+		SHA512:    opts.SHA512,
+		Signature: opts.Signature,
+	}}
+}
+
+// UploadPart is one file of an upload made of several files.
+type UploadPart struct {
+	Reader   io.Reader
+	FileName string
+	// RelPath is the directory below the target the part is written to.
+	RelPath   string
+	Format    Format
+	SHA256    string
+	SHA512    string
+	Signature string
+}
+
+// UploadFilesWithOptions writes several files to a target as one deployment
+// that is committed only when every part has been written and verified. The
+// per-file settings of opts are ignored in favour of those of each part.
+func UploadFilesWithOptions(parts []UploadPart, targetDirUserPath, pathPrefixEnv string, opts UploadOptions) ([]*UploadResult, error) {
+	if err := validateUploadParts(parts, opts); err != nil {
+		return nil, err
+	}
+	absValidatedTargetDir, err := resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return dryRunUpload(parts, absValidatedTargetDir, pathPrefixEnv, opts)
+	}
+	// The lock also covers staging, since the staging directory of a child
+	// target lives inside its parent, and that of the PATH_PREFIX root inside
+	// the root.
+	unlock, err := lockTarget(absValidatedTargetDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return deployParts(parts, absValidatedTargetDir, pathPrefixEnv, opts, nil)
+}
+
+// validateUploadParts checks the parts and options of an upload before
+// anything is read.
+func validateUploadParts(parts []UploadPart, opts UploadOptions) error {
+	if len(parts) == 0 {
+		return ErrNoUploadParts
+	}
+	for _, part := range parts {
+		if err := validateChecksums(part.SHA256, part.SHA512); err != nil {
+			return err
+		}
+		if err := validatePartRelPath(part.RelPath); err != nil {
+			return err
+		}
+	}
+	if _, err := newEntryFilter(opts); err != nil {
+		return err
+	}
+	return nil
+}
+
+// deployedCheck returns the results of an upload whose parts have the given
+// digests when it was already deployed to the target, and nil otherwise.
+type deployedCheck func(digests []string) ([]*UploadResult, error)
+
+// alreadyDeployed runs check, if any, against the digests of the staged
+// results.
+func alreadyDeployed(check deployedCheck, results []*UploadResult) ([]*UploadResult, error) {
+	if check == nil {
+		return nil, nil
+	}
+	digests := make([]string, len(results))
+	for i, result := range results {
+		digests[i] = result.SHA256
+	}
+	return check(digests)
+}
+
+// deployParts stages parts and commits them to absValidatedTargetDir. The
+// caller holds the target lock. Once staged, an upload that deployed reports
+// as already deployed is discarded and the stored results are returned.
+func deployParts(parts []UploadPart, absValidatedTargetDir, pathPrefixEnv string, opts UploadOptions, deployed deployedCheck) ([]*UploadResult, error) {
+	if opts.Release {
+		return uploadRelease(parts, absValidatedTargetDir, pathPrefixEnv, opts, deployed)
+	}
+
+	// Uploads are written to a sibling staging directory and only committed
+	// once they have been fully written and verified. PUT swaps the staged
+	// tree into place, so readers never observe a partially written tree; POST
+	// merges it into the existing target.
+	stagingParent, stagingPattern, inTarget := stagingLocation(absValidatedTargetDir, pathPrefixEnv)
+	stagingDir, err := createStagingDir(stagingParent, stagingPattern)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(stagingDir); err != nil {
+			_ = err
+		}
+	}()
+
+	results, relStagedPaths, err := stageParts(diskFS, parts, stagingDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if stored, err := alreadyDeployed(deployed, results); err != nil || stored != nil {
+		return stored, err
+	}
+	if excludedUpload(results) {
+		// Committing would only remove what the target holds, such as a PUT
+		// swapping the empty staging directory into place.
+		for i, result := range results {
+			result.Path = filepath.Join(absValidatedTargetDir, relStagedPaths[i])
+		}
+		return results, nil
+	}
+	if err := checkQuotas(diskFS, opts.Quotas, pathPrefixEnv, absValidatedTargetDir, stagingDir, opts.replacedUsage(absValidatedTargetDir)); err != nil {
+		return nil, err
+	}
+	if opts.IsPutRequest && !opts.Sync {
+		swap := swapDirectory
+		if inTarget {
+			swap = swapDirectoryContents
+		}
+		if err := swap(stagingDir, absValidatedTargetDir); err != nil {
+			return nil, err
+		}
+	} else {
+		// Sync merges like POST and then deletes what the upload no longer
+		// contains, so that stale files are only gone once the new ones are
+		// in place.
+		var removals []string
+		if opts.Sync {
+			if removals, err = syncRemovals(diskFS, stagingDir, absValidatedTargetDir, opts.Protect); err != nil {
+				return nil, err
+			}
+		}
+		whiteoutPaths, err := whiteoutRemovals(diskFS, stagingDir, absValidatedTargetDir, uploadWhiteouts(results))
+		if err != nil {
+			return nil, err
+		}
+		removals = append(removals, whiteoutPaths...)
+		if err := os.MkdirAll(absValidatedTargetDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create target directory '%s': %w", absValidatedTargetDir, err)
+		}
+		if err := mergeDirectory(stagingDir, absValidatedTargetDir, opts.modePolicy().RestoreDirModTimes); err != nil {
+			return nil, err
+		}
+		if err := removeEntries(absValidatedTargetDir, removals); err != nil {
+			return nil, err
+		}
+	}
+	for i, result := range results {
+		result.Path = filepath.Join(absValidatedTargetDir, relStagedPaths[i])
+	}
+	return results, nil
+}
+
+func validatePartRelPath(relPath string) error {
+	cleaned := filepath.Clean(relPath)
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("path traversal attempt in relative path '%s'", relPath)
+	}
+	return nil
+}
+
+// stageParts writes every part into stagingDir and returns the results along
+// with the staged paths relative to stagingDir.
+func stageParts(fsys stageFS, parts []UploadPart, stagingDir string, opts UploadOptions) ([]*UploadResult, []string, error) {
+	var results []*UploadResult
+	var relStagedPaths []string
+	for _, part := range parts {
+		result, err := stagePart(fsys, part, stagingDir, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		relStagedPath, err := filepath.Rel(stagingDir, result.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("internal error resolving staged path '%s': %w", result.Path, err)
+		}
+		results = append(results, result)
+		relStagedPaths = append(relStagedPaths, relStagedPath)
+	}
+	return results, relStagedPaths, nil
+}
+
+func stagePart(fsys stageFS, part UploadPart, stagingDir string, opts UploadOptions) (*UploadResult, error) {
+	partOpts := opts
+	partOpts.Format = part.Format
+	partOpts.SHA256 = part.SHA256
+	partOpts.SHA512 = part.SHA512
+	partOpts.Signature = part.Signature
+
+	inputStream, err := limitUploadSize(part.Reader, opts.limits().MaxUploadBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.TrustedKeys) > 0 || part.Signature != "" {
+		verifiedFile, cleanup, err := spoolAndVerify(inputStream, part.Signature, opts.TrustedKeys)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		inputStream = verifiedFile
+	}
+
+	partDir := stagingDir
+	if part.RelPath != "" {
+		partDir = filepath.Join(stagingDir, filepath.Clean(part.RelPath))
+		if err := fsys.MkdirAll(partDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory '%s': %w", partDir, err)
+		}
+	}
+	result, err := writeUploadContent(fsys, inputStream, partDir, part.FileName, partOpts)
+	if err != nil {
+		return nil, err
+	}
+	if part.RelPath != "" {
+		for i, whiteout := range result.whiteouts {
+			result.whiteouts[i] = path.Join(filepath.ToSlash(filepath.Clean(part.RelPath)), whiteout)
+		}
+	}
+	return result, nil
+}
+
+// excludedUpload reports whether every part of an upload is a single file
+// left out by the include and exclude patterns, so that it writes nothing.
+func excludedUpload(results []*UploadResult) bool {
+	for _, result := range results {
+		if result.Format.IsArchive() || len(result.Skipped) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// uploadWhiteouts returns the whiteouts of every part of an upload.
+func uploadWhiteouts(results []*UploadResult) []string {
+	var whiteouts []string
+	for _, result := range results {
+		whiteouts = append(whiteouts, result.whiteouts...)
+	}
+	return whiteouts
+}
+
+// rootStagingPrefix names the hidden directories that uploads to the
+// PATH_PREFIX root are staged in.
+const rootStagingPrefix = ".deploytar-staging-"
+
+// stagingLocation returns the directory that the staging directory of an
+// upload to absTargetDir is created in and its name pattern. Uploads are
+// staged next to their target so that they can be committed with renames,
+// except for the PATH_PREFIX root: its parent lies outside the prefix, may not
+// be writable or on the same file system, so the root is staged inside itself
+// and inTarget is set.
+func stagingLocation(absTargetDir, pathPrefixEnv string) (parentDir, pattern string, inTarget bool) {
+	if cleanedPathPrefix := filepath.Clean(pathPrefixEnv); pathPrefixEnv != "" && cleanedPathPrefix != "." && cleanedPathPrefix != "/" {
+		if root, err := filepath.Abs(cleanedPathPrefix); err == nil && root == absTargetDir {
+			return absTargetDir, rootStagingPrefix + "*", true
+		}
+	}
+	return filepath.Dir(absTargetDir), "." + filepath.Base(absTargetDir) + ".staging-*", false
+}
+
+func createStagingDir(parentDir, pattern string) (string, error) {
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directory '%s': %w", parentDir, err)
+	}
+	stagingDir, err := os.MkdirTemp(parentDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory in '%s': %w", parentDir, err)
+	}
+	if err := os.Chmod(stagingDir, 0755); err != nil {
+		if rmErr := os.RemoveAll(stagingDir); rmErr != nil {
+			_ = rmErr
+		}
+		return "", fmt.Errorf("failed to set permissions on staging directory '%s': %w", stagingDir, err)
+	}
+	return stagingDir, nil
+}
+
+// swapDirectory replaces targetDir with stagingDir using renames. The previous
+// tree is moved aside first and restored if the final rename fails.
+func swapDirectory(stagingDir, targetDir string) error {
+	backupDir := ""
+	if _, err := os.Lstat(targetDir); err == nil {
+		backupDir = filepath.Join(filepath.Dir(targetDir), fmt.Sprintf(".%s.old-%d", filepath.Base(targetDir), time.Now().UnixNano()))
+		if err := os.Rename(targetDir, backupDir); err != nil {
+			return fmt.Errorf("failed to move existing directory '%s' aside for PUT: %w", targetDir, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat existing directory '%s' for PUT: %w", targetDir, err)
+	}
+
+	if err := os.Rename(stagingDir, targetDir); err != nil {
+		if backupDir != "" {
+			if restoreErr := os.Rename(backupDir, targetDir); restoreErr != nil {
+				_ = restoreErr
+			}
+		}
+		return fmt.Errorf("failed to move staged content into '%s': %w", targetDir, err)
+	}
+
+	if backupDir != "" {
+		if err := os.RemoveAll(backupDir); err != nil {
+			_ = err
+		}
+	}
+	return nil
+}
+
+// swapDirectoryContents replaces the entries of targetDir with those of
+// stagingDir, which lies inside it, for targets that cannot be renamed.
+// Staging directories in targetDir are left alone. The
+// previous entries are moved aside to a hidden directory in targetDir first
+// and restored if a staged entry cannot be moved into place. Unlike
+// swapDirectory, readers can observe the target while entries are moved.
+func swapDirectoryContents(stagingDir, targetDir string) error {
+	backupDir, err := os.MkdirTemp(targetDir, rootStagingPrefix+"old-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup directory in '%s' for PUT: %w", targetDir, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(backupDir); err != nil {
+			_ = err
+		}
+	}()
+
+	existing, err := os.ReadDir(targetDir)
+	if err != nil {
+		return fmt.Errorf("failed to read existing directory '%s' for PUT: %w", targetDir, err)
+	}
+	var movedAside, movedIn []string
+	restore := func() {
+		for _, name := range movedIn {
+			if err := os.RemoveAll(filepath.Join(targetDir, name)); err != nil {
+				_ = err
+			}
+		}
+		for _, name := range movedAside {
+			if err := os.Rename(filepath.Join(backupDir, name), filepath.Join(targetDir, name)); err != nil {
+				_ = err
+			}
+		}
+	}
+	for _, entry := range existing {
+		p := filepath.Join(targetDir, entry.Name())
+		if strings.HasPrefix(entry.Name(), rootStagingPrefix) {
+			continue
+		}
+		if err := os.Rename(p, filepath.Join(backupDir, entry.Name())); err != nil {
+			restore()
+			return fmt.Errorf("failed to move existing entry '%s' aside for PUT: %w", p, err)
+		}
+		movedAside = append(movedAside, entry.Name())
+	}
+
+	staged, err := os.ReadDir(stagingDir)
+	if err != nil {
+		restore()
+		return fmt.Errorf("failed to read staging directory '%s': %w", stagingDir, err)
+	}
+	for _, entry := range staged {
+		dst := filepath.Join(targetDir, entry.Name())
+		if err := os.Rename(filepath.Join(stagingDir, entry.Name()), dst); err != nil {
+			restore()
+			return fmt.Errorf("failed to move staged content into '%s': %w", dst, err)
+		}
+		movedIn = append(movedIn, entry.Name())
+	}
+	return nil
+}
+
+// mergeDirectory moves the contents of stagingDir into targetDir. Existing
+// directories are merged recursively and every other entry is replaced with
+// a rename. Symlinks in targetDir are never followed.
+func mergeDirectory(stagingDir, targetDir string, copyDirModTimes bool) error {
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return fmt.Errorf("failed to read staging directory '%s': %w", stagingDir, err)
+	}
+	for _, entry := range entries {
+		src := filepath.Join(stagingDir, entry.Name())
+		dst := filepath.Join(targetDir, entry.Name())
+
+		dstInfo, err := os.Lstat(dst)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat '%s': %w", dst, err)
+		}
+		if err == nil {
+			if entry.IsDir() && dstInfo.IsDir() {
+				if err := mergeDirectory(src, dst, copyDirModTimes); err != nil {
+					return err
+				}
+				if copyDirModTimes {
+					srcInfo, err := entry.Info()
+					if err != nil {
+						return fmt.Errorf("failed to stat '%s': %w", src, err)
+					}
+					if err := os.Chtimes(dst, time.Time{}, srcInfo.ModTime()); err != nil {
+						return fmt.Errorf("failed to set modification time of directory '%s': %w", dst, err)
+					}
+				}
+				continue
+			}
+			if err := os.RemoveAll(dst); err != nil {
+				return fmt.Errorf("failed to remove '%s' before replacing it: %w", dst, err)
+			}
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("failed to move staged content into '%s': %w", dst, err)
+		}
+	}
+	return nil
+}
+
+func resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv string) (string, error) {
 	cleanedTargetUserPath := filepath.Clean(targetDirUserPath)
 
 	var absValidatedTargetDir string
@@ -200,171 +753,306 @@ func UploadFile(inputStream io.Reader, targetDirUserPath, fileName, pathPrefixEn
 		return "", fmt.Errorf("target path '%s' attempts to traverse outside its allowed scope", targetDirUserPath)
 	}
 
-	if isPutRequest {
-		if err := os.RemoveAll(absValidatedTargetDir); err != nil {
-			if !os.IsNotExist(err) {
-				return "", fmt.Errorf("failed to remove existing directory '%s' for PUT: %w", absValidatedTargetDir, err)
-			}
-		}
-	}
-	if err := os.MkdirAll(absValidatedTargetDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create target directory '%s': %w", absValidatedTargetDir, err)
-	}
+	return absValidatedTargetDir, nil
+}
 
+// writeUploadContent writes an upload into absValidatedTargetDir. When no
+// format is given it is detected from the content and file name.
+func writeUploadContent(fsys stageFS, inputStream io.Reader, absValidatedTargetDir, fileName string, opts UploadOptions) (*UploadResult, error) {
+	digester := newUploadDigester()
+	bufferedStream := bufio.NewReaderSize(io.TeeReader(inputStream, digester), sniffLen)
 	fileNameLower := strings.ToLower(fileName)
-	isTgz := strings.HasSuffix(fileNameLower, ".tgz")
-	isTarGz := strings.HasSuffix(fileNameLower, ".tar.gz")
-	isTar := strings.HasSuffix(fileNameLower, ".tar") && !isTarGz
-	isGz := strings.HasSuffix(fileNameLower, ".gz") && !isTarGz && !isTgz
+	var finalPath string
+	var skipped []SkippedEntry
+	var whiteouts []string
+	var errExtract error
+	policy := opts.modePolicy()
+	limiter := newExtractLimiter(opts.limits(), func() int64 { return digester.n })
+	filter, err := newEntryFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+	detected := opts.Format
+	if detected == "" {
+		head, _ := bufferedStream.Peek(sniffLen)
+		if detected, err = detectFormat(head, fileNameLower); err != nil {
+			return nil, fmt.Errorf("failed to detect the format of '%s': %w", fileName, err)
+		}
+	}
+	compression := detected.compression()
 
-	if isTgz || isTarGz {
-		gzr, errGzip := gzip.NewReader(inputStream)
-		if errGzip != nil {
-			return "", fmt.Errorf("failed to create gzip reader for archive '%s': %w", fileName, errGzip)
+	if detected == FormatZip {
+		zipSource := io.Reader(bufferedStream)
+		if _, size, ok := randomAccess(inputStream); ok {
+			zipSource = inputStream
+			limiter.received = func() int64 { return size }
+		}
+		if skipped, errExtract = extractZipStream(fsys, zipSource, absValidatedTargetDir, fileName, policy, filter, limiter); errExtract != nil {
+			return nil, errExtract
+		}
+		finalPath = absValidatedTargetDir
+	} else if compression != nil && detected.IsArchive() {
+		dr, errReader := compression.newReader(bufferedStream)
+		if errReader != nil {
+			return nil, fmt.Errorf("failed to create %s reader for archive '%s': %w", compression.name, fileName, errReader)
 		}
 		defer func() {
-			if err := gzr.Close(); err != nil {
+			if err := dr.Close(); err != nil {
 				_ = err
 			}
 		}()
-		if errExtract := extractTar(gzr, absValidatedTargetDir, fileName); errExtract != nil {
-			return "", errExtract
+		if skipped, whiteouts, errExtract = extractTar(fsys, dr, absValidatedTargetDir, fileName, policy, filter, limiter); errExtract != nil {
+			return nil, errExtract
 		}
 		finalPath = absValidatedTargetDir
-	} else if isTar {
-		if errExtract := extractTar(inputStream, absValidatedTargetDir, fileName); errExtract != nil {
-			return "", errExtract
+	} else if detected == FormatTar {
+		if skipped, whiteouts, errExtract = extractTar(fsys, bufferedStream, absValidatedTargetDir, fileName, policy, filter, limiter); errExtract != nil {
+			return nil, errExtract
 		}
 		finalPath = absValidatedTargetDir
-	} else if isGz {
-		gzr, errGzip := gzip.NewReader(inputStream)
-		if errGzip != nil {
-			return "", fmt.Errorf("failed to create gzip reader for '%s': %w", fileName, errGzip)
+	} else if reason, skip := filter.skipReason(fileName, false); skip {
+		skipped = append(skipped, SkippedEntry{Name: fileName, Reason: reason})
+		finalPath = absValidatedTargetDir
+	} else if compression != nil {
+		dr, errReader := compression.newReader(bufferedStream)
+		if errReader != nil {
+			return nil, fmt.Errorf("failed to create %s reader for '%s': %w", compression.name, fileName, errReader)
 		}
 		defer func() {
-			if err := gzr.Close(); err != nil {
+			if err := dr.Close(); err != nil {
 				_ = err
 			}
 		}()
 
-		targetFileName := strings.TrimSuffix(fileName, ".gz")
+		targetFileName := fileName
+		if nameCompression := formatForFileName(fileNameLower); nameCompression.IsCompressedFile() {
+			targetFileName = fileName[:len(fileName)-len(nameCompression.compression().fileSuffix)]
+		}
 		if targetFileName == "" {
-			targetFileName = "gzipped_file"
+			targetFileName = compression.defaultFileName
 		}
 		absFinalFilePath := filepath.Join(absValidatedTargetDir, filepath.Clean(targetFileName))
 		if !strings.HasPrefix(absFinalFilePath, absValidatedTargetDir+string(os.PathSeparator)) && absFinalFilePath != absValidatedTargetDir {
-			return "", fmt.Errorf("path traversal attempt for gzipped file target '%s'", targetFileName)
+			return nil, fmt.Errorf("path traversal attempt for %s file target '%s'", compression.description, targetFileName)
 		}
-		if errMkdir := os.MkdirAll(filepath.Dir(absFinalFilePath), 0755); errMkdir != nil {
-			return "", fmt.Errorf("failed to create parent directory for gzipped file '%s': %w", absFinalFilePath, errMkdir)
+		if errMkdir := fsys.MkdirAll(filepath.Dir(absFinalFilePath), 0755); errMkdir != nil {
+			return nil, fmt.Errorf("failed to create parent directory for %s file '%s': %w", compression.description, absFinalFilePath, errMkdir)
 		}
 
-		outFile, errOpen := os.OpenFile(absFinalFilePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		outFile, errOpen := fsys.Create(absFinalFilePath, 0644)
 		if errOpen != nil {
-			return "", fmt.Errorf("failed to create file for gzipped content '%s': %w", absFinalFilePath, errOpen)
+			return nil, fmt.Errorf("failed to create file for %s content '%s': %w", compression.description, absFinalFilePath, errOpen)
 		}
-		_, copyErr := io.Copy(outFile, gzr)
+		_, copyErr := limiter.copyFile(outFile, dr, targetFileName)
 		if closeErr := outFile.Close(); closeErr != nil && copyErr == nil {
-			return "", fmt.Errorf("failed to close output file for gzipped content '%s': %w", absFinalFilePath, closeErr)
+			return nil, fmt.Errorf("failed to close output file for %s content '%s': %w", compression.description, absFinalFilePath, closeErr)
 		}
 		if copyErr != nil {
-			if err := os.Remove(absFinalFilePath); err != nil {
+			if err := fsys.Remove(absFinalFilePath); err != nil {
 				_ = err
 			}
-			return "", fmt.Errorf("failed to copy gzipped file content to '%s': %w", absFinalFilePath, copyErr)
+			return nil, fmt.Errorf("failed to copy %s file content to '%s': %w", compression.description, absFinalFilePath, copyErr)
+		}
+		if err := policy.finishFile(fsys, absFinalFilePath, 0644, time.Time{}); err != nil {
+			return nil, err
 		}
 		finalPath = absFinalFilePath
 	} else {
 		cleanedFileName := filepath.Clean(fileName)
 		if strings.HasPrefix(cleanedFileName, string(os.PathSeparator)) || strings.HasPrefix(cleanedFileName, "..") {
-			return "", fmt.Errorf("invalid characters or traversal attempt in filename '%s'", fileName)
+			return nil, fmt.Errorf("invalid characters or traversal attempt in filename '%s'", fileName)
 		}
 		absFinalFilePath := filepath.Join(absValidatedTargetDir, cleanedFileName)
 
 		if !strings.HasPrefix(absFinalFilePath, absValidatedTargetDir+string(os.PathSeparator)) && absFinalFilePath != absValidatedTargetDir {
-			return "", fmt.Errorf("path traversal attempt for file target '%s'", fileName)
+			return nil, fmt.Errorf("path traversal attempt for file target '%s'", fileName)
 		}
-		if errMkdir := os.MkdirAll(filepath.Dir(absFinalFilePath), 0755); errMkdir != nil {
-			return "", fmt.Errorf("failed to create parent directory for file '%s': %w", absFinalFilePath, errMkdir)
+		if errMkdir := fsys.MkdirAll(filepath.Dir(absFinalFilePath), 0755); errMkdir != nil {
+			return nil, fmt.Errorf("failed to create parent directory for file '%s': %w", absFinalFilePath, errMkdir)
 		}
 
-		outFile, errOpen := os.OpenFile(absFinalFilePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		outFile, errOpen := fsys.Create(absFinalFilePath, 0644)
 		if errOpen != nil {
-			return "", fmt.Errorf("failed to create file '%s': %w", absFinalFilePath, errOpen)
+			return nil, fmt.Errorf("failed to create file '%s': %w", absFinalFilePath, errOpen)
 		}
-		_, copyErr := io.Copy(outFile, inputStream)
+		_, copyErr := limiter.copyFile(outFile, bufferedStream, fileName)
 		if closeErr := outFile.Close(); closeErr != nil && copyErr == nil {
-			return "", fmt.Errorf("failed to close output file '%s': %w", absFinalFilePath, closeErr)
+			return nil, fmt.Errorf("failed to close output file '%s': %w", absFinalFilePath, closeErr)
 		}
 		if copyErr != nil {
-			if err := os.Remove(absFinalFilePath); err != nil {
+			if err := fsys.Remove(absFinalFilePath); err != nil {
 				_ = err
 			}
-			return "", fmt.Errorf("failed to copy file content to '%s': %w", absFinalFilePath, copyErr)
+			return nil, fmt.Errorf("failed to copy file content to '%s': %w", absFinalFilePath, copyErr)
+		}
+		if err := policy.finishFile(fsys, absFinalFilePath, 0644, time.Time{}); err != nil {
+			return nil, err
 		}
 		finalPath = absFinalFilePath
 	}
 
-	return finalPath, nil
+	if err := drain(bufferedStream); err != nil {
+		return nil, err
+	}
+	if err := digester.verify(opts.SHA256, opts.SHA512); err != nil {
+		return nil, err
+	}
+	return &UploadResult{
+		Path:      finalPath,
+		Format:    detected,
+		Skipped:   skipped,
+		SHA256:    hex.EncodeToString(digester.sha256.Sum(nil)),
+		SHA512:    hex.EncodeToString(digester.sha512.Sum(nil)),
+		whiteouts: whiteouts,
+	}, nil
 }
 
-func extractTar(r io.Reader, baseExtractDir string, archiveName string) error {
+// resolveArchiveEntryPath returns the path an archive entry extracts to,
+// rejecting absolute names and names that escape baseExtractDir.
+func resolveArchiveEntryPath(baseExtractDir, archiveKind, archiveName, entryName string) (string, error) {
+	cleanedEntryName := filepath.Clean(entryName)
+	if filepath.IsAbs(cleanedEntryName) || strings.HasPrefix(cleanedEntryName, ".."+string(os.PathSeparator)) || cleanedEntryName == ".." {
+		return "", fmt.Errorf("%s archive '%s' contains potentially unsafe path entry '%s'", archiveKind, archiveName, entryName)
+	}
+
+	targetItemPath := filepath.Join(baseExtractDir, cleanedEntryName)
+	if !strings.HasPrefix(targetItemPath, baseExtractDir+string(os.PathSeparator)) && targetItemPath != baseExtractDir {
+		return "", fmt.Errorf("path traversal attempt in archive '%s': entry '%s' resolves to '%s' which is outside extraction directory '%s'", archiveName, entryName, targetItemPath, baseExtractDir)
+	}
+	return targetItemPath, nil
+}
+
+func extractTar(fsys stageFS, r io.Reader, baseExtractDir string, archiveName string, policy ModePolicy, filter entryFilter, limiter *extractLimiter) ([]SkippedEntry, []string, error) {
 	tr := tar.NewReader(r)
 	headerProcessedSuccessfullyAtLeastOnce := false
+	var skipped []SkippedEntry
+	var whiteouts []string
+	var symlinkPaths []string
+	var dirs []extractedDir
 
 	for {
 		header, err := tr.Next()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				if !headerProcessedSuccessfullyAtLeastOnce && archiveName != "" {
-					return fmt.Errorf("empty or invalid tar archive '%s': no headers found", archiveName)
+					return nil, nil, fmt.Errorf("empty or invalid tar archive '%s': no headers found", archiveName)
 				}
 				break
 			}
-			return fmt.Errorf("failed to read tar header from archive '%s': %w", archiveName, err)
+			return nil, nil, fmt.Errorf("failed to read tar header from archive '%s': %w", archiveName, err)
 		}
 		headerProcessedSuccessfullyAtLeastOnce = true
+		// Global pax headers, like the one git archive writes first, only
+		// carry metadata and are not entries of their own.
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
 
-		cleanedHeaderName := filepath.Clean(header.Name)
-		if filepath.IsAbs(cleanedHeaderName) || strings.HasPrefix(cleanedHeaderName, ".."+string(os.PathSeparator)) || cleanedHeaderName == ".." {
-			return fmt.Errorf("tar archive '%s' contains potentially unsafe path entry '%s'", archiveName, header.Name)
+		name, selected := filter.apply(header.Name)
+		if !selected {
+			continue
+		}
+		header.Name = name
+		if header.Typeflag != tar.TypeDir && isWhiteout(header.Name) {
+			whiteout, ok, err := validateWhiteout(archiveName, header.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				skipped = append(skipped, SkippedEntry{Name: header.Name, Reason: "unsupported whiteout"})
+				continue
+			}
+			whiteouts = append(whiteouts, whiteout)
+			continue
+		}
+		if reason, skip := filter.skipReason(header.Name, header.Typeflag == tar.TypeDir); skip {
+			skipped = append(skipped, SkippedEntry{Name: header.Name, Reason: reason})
+			continue
+		}
+		if header.Typeflag == tar.TypeLink {
+			linkname, selected := filter.apply(header.Linkname)
+			if _, skip := filter.skipReason(linkname, false); !selected || skip {
+				skipped = append(skipped, SkippedEntry{Name: header.Name, Reason: fmt.Sprintf("hard link target '%s' is not extracted", header.Linkname)})
+				continue
+			}
+			header.Linkname = linkname
 		}
 
-		targetItemPath := filepath.Join(baseExtractDir, cleanedHeaderName)
-		if !strings.HasPrefix(targetItemPath, baseExtractDir+string(os.PathSeparator)) && targetItemPath != baseExtractDir {
-			return fmt.Errorf("path traversal attempt in archive '%s': entry '%s' resolves to '%s' which is outside extraction directory '%s'", archiveName, header.Name, targetItemPath, baseExtractDir)
+		if _, err := resolveArchiveEntryPath(baseExtractDir, "tar", archiveName, header.Name); err != nil {
+			return nil, nil, err
+		}
+		if err := limiter.addEntry(header.Name); err != nil {
+			return nil, nil, err
 		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := os.MkdirAll(targetItemPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to create directory '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+			targetItemPath, err := resolveInDir(fsys, baseExtractDir, baseExtractDir, filepath.Clean(header.Name))
+			if err != nil {
+				return nil, nil, fmt.Errorf("path traversal attempt in archive '%s': directory '%s' %w", archiveName, header.Name, err)
 			}
+			if err := fsys.MkdirAll(targetItemPath, 0755); err != nil {
+				return nil, nil, fmt.Errorf("failed to create directory '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+			}
+			dirs = append(dirs, extractedDir{path: targetItemPath, mode: header.FileInfo().Mode(), modTime: header.ModTime})
 		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(targetItemPath), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory for file '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+			if err := limiter.checkFileSize(header.Name, header.Size); err != nil {
+				return nil, nil, err
+			}
+			targetItemPath, err := resolveEntryPath(fsys, baseExtractDir, archiveName, header.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := fsys.MkdirAll(filepath.Dir(targetItemPath), 0755); err != nil {
+				return nil, nil, fmt.Errorf("failed to create parent directory for file '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+			}
+			if info, err := fsys.Lstat(targetItemPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				if err := fsys.Remove(targetItemPath); err != nil {
+					return nil, nil, fmt.Errorf("failed to replace symlink '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+				}
 			}
-			itemOutFile, errOpen := os.OpenFile(targetItemPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(header.Mode))
+			itemOutFile, errOpen := fsys.Create(targetItemPath, 0600)
 			if errOpen != nil {
-				return fmt.Errorf("failed to create file '%s' from archive '%s': %w", targetItemPath, archiveName, errOpen)
+				return nil, nil, fmt.Errorf("failed to create file '%s' from archive '%s': %w", targetItemPath, archiveName, errOpen)
 			}
 			var itemCopyErr error
 			if header.Size > 0 {
-				_, itemCopyErr = io.Copy(itemOutFile, tr)
+				_, itemCopyErr = limiter.copyFile(itemOutFile, tr, header.Name)
 			}
 			closeErr := itemOutFile.Close()
 
 			if itemCopyErr != nil {
-				if err := os.Remove(targetItemPath); err != nil {
+				if err := fsys.Remove(targetItemPath); err != nil {
 					_ = err
 				}
-				return fmt.Errorf("failed to copy content to '%s' from archive '%s': %w", targetItemPath, archiveName, itemCopyErr)
+				return nil, nil, fmt.Errorf("failed to copy content to '%s' from archive '%s': %w", targetItemPath, archiveName, itemCopyErr)
 			}
 			if closeErr != nil {
-				return fmt.Errorf("failed to close file '%s' from archive '%s': %w", targetItemPath, archiveName, closeErr)
+				return nil, nil, fmt.Errorf("failed to close file '%s' from archive '%s': %w", targetItemPath, archiveName, closeErr)
+			}
+			if err := policy.finishFile(fsys, targetItemPath, header.FileInfo().Mode(), header.ModTime); err != nil {
+				return nil, nil, err
+			}
+		case tar.TypeSymlink:
+			linkPath, err := extractTarSymlink(fsys, header, baseExtractDir, archiveName)
+			if err != nil {
+				return nil, nil, err
+			}
+			symlinkPaths = append(symlinkPaths, linkPath)
+		case tar.TypeLink:
+			if err := extractTarHardLink(fsys, header, baseExtractDir, archiveName); err != nil {
+				return nil, nil, err
 			}
 		default:
+			skipped = append(skipped, SkippedEntry{Name: header.Name, Reason: skippedTarEntryReason(header.Typeflag)})
 		}
 	}
-	return nil
+
+	if err := verifySymlinks(fsys, baseExtractDir, archiveName, symlinkPaths); err != nil {
+		return nil, nil, err
+	}
+	if err := policy.finishDirs(fsys, dirs); err != nil {
+		return nil, nil, err
+	}
+	return skipped, whiteouts, nil
 }
@@ -477,3 +477,209 @@ func TestUploadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestUploadFile_PutSwapsDirectoryAtomically(t *testing.T) {
+	baseDir := t.TempDir()
+	targetDir := filepath.Join(baseDir, "site")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "old.txt"), []byte("old"), 0644))
+
+	t.Run("failed extraction keeps the existing tree", func(t *testing.T) {
+		corrupt := createTestTar(t, map[string]string{"new.txt": strings.Repeat("x", 2048)})
+		truncated := bytes.NewReader(corrupt.Bytes()[:1024])
+
+		_, err := service.UploadFile(truncated, targetDir, "site.tar", "", true)
+		require.Error(t, err)
+
+		content, errRead := os.ReadFile(filepath.Join(targetDir, "old.txt"))
+		require.NoError(t, errRead)
+		assert.Equal(t, "old", string(content))
+		_, errStat := os.Stat(filepath.Join(targetDir, "new.txt"))
+		assert.True(t, os.IsNotExist(errStat), "Partially extracted file should not be visible")
+	})
+
+	t.Run("successful extraction replaces the tree", func(t *testing.T) {
+		archive := createTestTar(t, map[string]string{"new.txt": "new content"})
+
+		finalPath, err := service.UploadFile(archive, targetDir, "site.tar", "", true)
+		require.NoError(t, err)
+		assert.Equal(t, targetDir, finalPath)
+
+		content, errRead := os.ReadFile(filepath.Join(targetDir, "new.txt"))
+		require.NoError(t, errRead)
+		assert.Equal(t, "new content", string(content))
+		_, errStat := os.Stat(filepath.Join(targetDir, "old.txt"))
+		assert.True(t, os.IsNotExist(errStat), "Old file should be gone after PUT")
+	})
+
+	entries, err := os.ReadDir(baseDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "Staging and backup directories should be cleaned up")
+	assert.Equal(t, "site", entries[0].Name())
+}
+
+func TestUploadFileWithOptions_PathPrefixRoot(t *testing.T) {
+	parentDir := t.TempDir()
+	prefix := filepath.Join(parentDir, "prefix")
+	require.NoError(t, os.Mkdir(prefix, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "old.txt"), []byte("old"), 0644))
+	rootInfo, err := os.Stat(prefix)
+	require.NoError(t, err)
+	// The parent of the prefix is out of reach.
+	require.NoError(t, os.Chmod(parentDir, 0555))
+	t.Cleanup(func() { require.NoError(t, os.Chmod(parentDir, 0755)) })
+
+	upload := func(files map[string]string, opts service.UploadOptions) error {
+		_, err := service.UploadFileWithOptions(createTestTar(t, files), "", "site.tar", prefix, opts)
+		return err
+	}
+	rootFiles := func() []string {
+		var names []string
+		entries, err := os.ReadDir(prefix)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	t.Run("put replaces the content of the root", func(t *testing.T) {
+		require.NoError(t, upload(map[string]string{"index.html": "home", "assets/app.js": "app"}, service.UploadOptions{IsPutRequest: true}))
+		assert.Equal(t, []string{"assets", "index.html"}, rootFiles())
+	})
+
+	t.Run("failed put keeps the root", func(t *testing.T) {
+		corrupt := createTestTar(t, map[string]string{"new.txt": strings.Repeat("x", 2048)})
+		_, err := service.UploadFileWithOptions(bytes.NewReader(corrupt.Bytes()[:1024]), "", "site.tar", prefix, service.UploadOptions{IsPutRequest: true})
+		require.Error(t, err)
+		assert.Equal(t, []string{"assets", "index.html"}, rootFiles())
+	})
+
+	t.Run("post merges into the root", func(t *testing.T) {
+		require.NoError(t, upload(map[string]string{"about.html": "about"}, service.UploadOptions{}))
+		assert.Equal(t, []string{"about.html", "assets", "index.html"}, rootFiles())
+	})
+
+	t.Run("sync removes stale entries of the root", func(t *testing.T) {
+		require.NoError(t, upload(map[string]string{"index.html": "new home"}, service.UploadOptions{IsPutRequest: true, Sync: true}))
+		assert.Equal(t, []string{"index.html"}, rootFiles())
+		content, err := os.ReadFile(filepath.Join(prefix, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "new home", string(content))
+	})
+
+	info, err := os.Stat(prefix)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(rootInfo, info), "The root itself should never be replaced")
+	entries, err := os.ReadDir(parentDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "Nothing should be staged outside the root")
+}
+
+func TestUploadFilesWithOptions(t *testing.T) {
+	baseDir := t.TempDir()
+	targetDir := filepath.Join(baseDir, "site")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "old.txt"), []byte("old"), 0644))
+
+	t.Run("a failing part commits nothing", func(t *testing.T) {
+		parts := []service.UploadPart{
+			{Reader: strings.NewReader("config"), FileName: "app.conf", RelPath: "etc"},
+			{Reader: strings.NewReader("not a tarball"), FileName: "site.tar", Format: service.FormatTar},
+		}
+		_, err := service.UploadFilesWithOptions(parts, targetDir, "", service.UploadOptions{IsPutRequest: true})
+		require.Error(t, err)
+
+		_, errStat := os.Stat(filepath.Join(targetDir, "etc", "app.conf"))
+		assert.True(t, os.IsNotExist(errStat), "The first part must not be committed")
+		_, errStat = os.Stat(filepath.Join(targetDir, "old.txt"))
+		assert.NoError(t, errStat)
+	})
+
+	t.Run("relative path traversal", func(t *testing.T) {
+		parts := []service.UploadPart{{Reader: strings.NewReader("x"), FileName: "x.txt", RelPath: "../outside"}}
+		_, err := service.UploadFilesWithOptions(parts, targetDir, "", service.UploadOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "path traversal attempt")
+	})
+
+	t.Run("no parts", func(t *testing.T) {
+		_, err := service.UploadFilesWithOptions(nil, targetDir, "", service.UploadOptions{})
+		assert.ErrorIs(t, err, service.ErrNoUploadParts)
+	})
+
+	t.Run("all parts are committed together", func(t *testing.T) {
+		parts := []service.UploadPart{
+			{Reader: createTestTar(t, map[string]string{"index.html": "home"}), FileName: "site.tar"},
+			{Reader: strings.NewReader("config"), FileName: "app.conf", RelPath: "etc"},
+		}
+		results, err := service.UploadFilesWithOptions(parts, targetDir, "", service.UploadOptions{IsPutRequest: true})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, targetDir, results[0].Path)
+		assert.Equal(t, service.FormatTar, results[0].Format)
+		assert.Equal(t, filepath.Join(targetDir, "etc", "app.conf"), results[1].Path)
+
+		content, errRead := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, errRead)
+		assert.Equal(t, "home", string(content))
+		content, errRead = os.ReadFile(filepath.Join(targetDir, "etc", "app.conf"))
+		require.NoError(t, errRead)
+		assert.Equal(t, "config", string(content))
+		_, errStat := os.Stat(filepath.Join(targetDir, "old.txt"))
+		assert.True(t, os.IsNotExist(errStat), "PUT replaces the tree with all parts")
+	})
+
+	t.Run("release", func(t *testing.T) {
+		parts := []service.UploadPart{
+			{Reader: strings.NewReader("a"), FileName: "a.txt"},
+			{Reader: strings.NewReader("b"), FileName: "b.txt", RelPath: "sub"},
+		}
+		results, err := service.UploadFilesWithOptions(parts, filepath.Join(baseDir, "app"), "", service.UploadOptions{Release: true})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.NotEmpty(t, results[0].ReleaseID)
+		assert.Equal(t, results[0].ReleaseID, results[1].ReleaseID)
+		content, errRead := os.ReadFile(filepath.Join(baseDir, "app", "current", "sub", "b.txt"))
+		require.NoError(t, errRead)
+		assert.Equal(t, "b", string(content))
+	})
+}
+
+func TestUploadFileWithOptions_PathPrefixRootStagingDirs(t *testing.T) {
+	prefix := t.TempDir()
+	staleDir := filepath.Join(prefix, ".deploytar-staging-stale")
+	require.NoError(t, os.Mkdir(staleDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(staleDir, "file.txt"), []byte("staged"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "old.txt"), []byte("old"), 0644))
+	upload := func(archive *bytes.Buffer, opts service.UploadOptions) *service.UploadResult {
+		result, err := service.UploadFileWithOptions(archive, "", "site.tar", prefix, opts)
+		require.NoError(t, err)
+		return result
+	}
+	deleted := func(result *service.UploadResult) []string {
+		var names []string
+		for _, entry := range result.Diff.Deleted {
+			names = append(names, entry.Path)
+		}
+		return names
+	}
+	files := map[string]string{"index.html": "home"}
+
+	assert.Equal(t, []string{"old.txt"}, deleted(upload(createTestTar(t, files), service.UploadOptions{IsPutRequest: true, DryRun: true})))
+	assert.Equal(t, []string{"old.txt"}, deleted(upload(createTestTar(t, files), service.UploadOptions{IsPutRequest: true, Sync: true, DryRun: true})))
+
+	whiteouts := createTestTarWithHeaders(t, []*tar.Header{
+		{Name: ".wh..deploytar-staging-stale", Typeflag: tar.TypeReg},
+		{Name: ".wh..wh..opq", Typeflag: tar.TypeReg},
+	}, nil)
+	upload(whiteouts, service.UploadOptions{})
+	upload(createTestTar(t, files), service.UploadOptions{IsPutRequest: true, Sync: true})
+	upload(createTestTar(t, files), service.UploadOptions{IsPutRequest: true})
+
+	content, err := os.ReadFile(filepath.Join(staleDir, "file.txt"))
+	require.NoError(t, err, "Staging directories in the root are not part of the target")
+	assert.Equal(t, "staged", string(content))
+	_, err = os.Stat(filepath.Join(prefix, "old.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Format identifies how an upload is written to the target directory.
+type Format string
+
+const (
+	FormatTar      Format = "tar"
+	FormatTarGzip  Format = "tar.gz"
+	FormatTarZstd  Format = "tar.zst"
+	FormatTarXz    Format = "tar.xz"
+	FormatTarBzip2 Format = "tar.bz2"
+	FormatZip      Format = "zip"
+	FormatGzip     Format = "gz"
+	FormatZstd     Format = "zst"
+	FormatXz       Format = "xz"
+	FormatBzip2    Format = "bz2"
+	FormatPlain    Format = "plain"
+)
+
+// sniffLen is the number of leading bytes inspected to detect a format. It is
+// large enough to hold a whole bzip2 block, which must be decoded before the
+// tar header inside it becomes visible.
+const sniffLen = 1 << 20
+
+var ErrUnsupportedFormat = errors.New("unsupported upload format")
+
+var formatAliases = map[string]Format{
+	"tgz":   FormatTarGzip,
+	"tzst":  FormatTarZstd,
+	"txz":   FormatTarXz,
+	"tbz2":  FormatTarBzip2,
+	"gzip":  FormatGzip,
+	"zstd":  FormatZstd,
+	"bzip2": FormatBzip2,
+}
+
+var mediaTypeFormats = map[string]Format{
+	"application/x-tar":   FormatTar,
+	"application/tar":     FormatTar,
+	"application/zip":     FormatZip,
+	"application/gzip":    FormatGzip,
+	"application/x-gzip":  FormatGzip,
+	"application/zstd":    FormatZstd,
+	"application/x-xz":    FormatXz,
+	"application/x-bzip2": FormatBzip2,
+}
+
+var contentEncodingFormats = map[string]Format{
+	"gzip":   FormatGzip,
+	"x-gzip": FormatGzip,
+	"zstd":   FormatZstd,
+}
+
+var zipMagics = [][]byte{
+	[]byte("PK\x03\x04"),
+	[]byte("PK\x05\x06"),
+	[]byte("PK\x07\x08"),
+}
+
+// ParseFormat parses a client supplied format override. An empty value means
+// the format is detected from the content.
+func ParseFormat(value string) (Format, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), ".")
+	if normalized == "" {
+		return "", nil
+	}
+	if alias, ok := formatAliases[normalized]; ok {
+		return alias, nil
+	}
+	switch f := Format(normalized); f {
+	case FormatTar, FormatZip, FormatPlain:
+		return f, nil
+	default:
+		if f.compression() != nil {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("%w: '%s'", ErrUnsupportedFormat, value)
+}
+
+// FormatForMediaType derives a format from the Content-Type and
+// Content-Encoding of a raw upload. Compressed content that is not declared to
+// be a tar archive returns an empty format, leaving it to content detection
+// to tell a compressed tarball from a single compressed file.
+func FormatForMediaType(contentType, contentEncoding string) (Format, error) {
+	var base Format
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		base = mediaTypeFormats[mediaType]
+	}
+
+	var encodings []Format
+	for _, token := range strings.Split(contentEncoding, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" || token == "identity" {
+			continue
+		}
+		encoding, ok := contentEncodingFormats[token]
+		if !ok {
+			return "", fmt.Errorf("%w: content encoding '%s'", ErrUnsupportedFormat, token)
+		}
+		encodings = append(encodings, encoding)
+	}
+	if len(encodings) > 1 {
+		return "", fmt.Errorf("%w: content encoding '%s'", ErrUnsupportedFormat, contentEncoding)
+	}
+
+	if len(encodings) == 0 {
+		if base.IsCompressedFile() {
+			return "", nil
+		}
+		return base, nil
+	}
+	switch base {
+	case FormatTar:
+		return encodings[0].compression().archiveFormat, nil
+	case "":
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w: '%s' with content encoding '%s'", ErrUnsupportedFormat, contentType, contentEncoding)
+	}
+}
+
+// IsArchive reports whether the format is extracted into the target directory.
+func (f Format) IsArchive() bool {
+	if f == FormatTar || f == FormatZip {
+		return true
+	}
+	c := f.compression()
+	return c != nil && c.archiveFormat == f
+}
+
+// IsCompressedFile reports whether the format is a single compressed file.
+func (f Format) IsCompressedFile() bool {
+	c := f.compression()
+	return c != nil && c.fileFormat == f
+}
+
+func (f Format) compression() *compressionFormat {
+	for i := range compressionFormats {
+		if compressionFormats[i].archiveFormat == f || compressionFormats[i].fileFormat == f {
+			return &compressionFormats[i]
+		}
+	}
+	return nil
+}
+
+// formatForFileName derives a format from a lower-cased file name suffix.
+func formatForFileName(fileNameLower string) Format {
+	for i := range compressionFormats {
+		for _, suffix := range compressionFormats[i].archiveSuffixes {
+			if strings.HasSuffix(fileNameLower, suffix) {
+				return compressionFormats[i].archiveFormat
+			}
+		}
+	}
+	if strings.HasSuffix(fileNameLower, ".tar") {
+		return FormatTar
+	}
+	if strings.HasSuffix(fileNameLower, ".zip") {
+		return FormatZip
+	}
+	for i := range compressionFormats {
+		if strings.HasSuffix(fileNameLower, compressionFormats[i].fileSuffix) {
+			return compressionFormats[i].fileFormat
+		}
+	}
+	return FormatPlain
+}
+
+// detectFormat identifies the upload format from its leading bytes, using the
+// file name to break ties. Zip and single compressed files are only unpacked
+// when the name says so, because many document formats (.docx, .jar, .svgz)
+// are zip or gzip containers that should be stored as-is. A .tar name whose
+// content is not a tar archive is rejected rather than extracted.
+func detectFormat(head []byte, fileNameLower string) (Format, error) {
+	nameFormat := formatForFileName(fileNameLower)
+
+	if isTarHeader(head) {
+		return FormatTar, nil
+	}
+	for _, magic := range zipMagics {
+		if bytes.HasPrefix(head, magic) {
+			if nameFormat == FormatPlain {
+				return FormatPlain, nil
+			}
+			return FormatZip, nil
+		}
+	}
+	for i := range compressionFormats {
+		c := &compressionFormats[i]
+		if !bytes.HasPrefix(head, c.magic) {
+			continue
+		}
+		if isTarHeader(peekDecompressed(c, head)) || nameFormat.IsArchive() {
+			return c.archiveFormat, nil
+		}
+		if nameFormat == FormatPlain {
+			return FormatPlain, nil
+		}
+		return c.fileFormat, nil
+	}
+	if nameFormat == FormatTar && !isEmptyTar(head) {
+		return "", fmt.Errorf("%w: content is not a tar archive", ErrUnsupportedFormat)
+	}
+	return nameFormat, nil
+}
+
+func isTarHeader(block []byte) bool {
+	return len(block) >= 263 && bytes.Equal(block[257:262], []byte("ustar"))
+}
+
+// isEmptyTar reports whether head is empty or starts with the zero block that
+// ends a tar archive, which the tar reader reports as an empty archive.
+func isEmptyTar(head []byte) bool {
+	return len(bytes.TrimLeft(head[:min(len(head), 512)], "\x00")) == 0
+}
+
+// peekDecompressed decodes the start of a compressed stream held in memory.
+func peekDecompressed(c *compressionFormat, head []byte) []byte {
+	dr, err := c.newReader(bytes.NewReader(head))
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		if err := dr.Close(); err != nil {
+			_ = err
+		}
+	}()
+	block := make([]byte, 512)
+	n, _ := io.ReadFull(dr, block)
+	return block[:n]
+}
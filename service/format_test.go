@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected service.Format
+	}{
+		{"", ""},
+		{"tar", service.FormatTar},
+		{"TGZ", service.FormatTarGzip},
+		{".tar.zst", service.FormatTarZstd},
+		{"zip", service.FormatZip},
+		{"bzip2", service.FormatBzip2},
+		{"plain", service.FormatPlain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			format, err := service.ParseFormat(tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+
+	_, err := service.ParseFormat("rar")
+	require.ErrorIs(t, err, service.ErrUnsupportedFormat)
+}
+
+func TestFormatForMediaType(t *testing.T) {
+	tests := []struct {
+		contentType     string
+		contentEncoding string
+		expected        service.Format
+	}{
+		{"", "", ""},
+		{"application/x-www-form-urlencoded", "", ""},
+		{"application/x-tar", "", service.FormatTar},
+		{"application/x-tar", "gzip", service.FormatTarGzip},
+		{"application/tar; charset=binary", "zstd", service.FormatTarZstd},
+		{"application/zip", "", service.FormatZip},
+		{"application/gzip", "", ""},
+		{"application/octet-stream", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType+"+"+tt.contentEncoding, func(t *testing.T) {
+			format, err := service.FormatForMediaType(tt.contentType, tt.contentEncoding)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+
+	_, err := service.FormatForMediaType("application/x-tar", "br")
+	assert.ErrorIs(t, err, service.ErrUnsupportedFormat)
+	_, err = service.FormatForMediaType("application/zip", "gzip")
+	assert.ErrorIs(t, err, service.ErrUnsupportedFormat)
+}
+
+func TestFormatClassification(t *testing.T) {
+	assert.True(t, service.FormatTarZstd.IsArchive())
+	assert.True(t, service.FormatZip.IsArchive())
+	assert.False(t, service.FormatXz.IsArchive())
+	assert.True(t, service.FormatBzip2.IsCompressedFile())
+	assert.False(t, service.FormatTarGzip.IsCompressedFile())
+	assert.False(t, service.FormatPlain.IsCompressedFile())
+}
+
+func TestUploadFileWithOptions_DetectsFormatFromContent(t *testing.T) {
+	tarBytes := createTestTar(t, map[string]string{"file_in_archive.txt": "archive content"}).Bytes()
+
+	tests := []struct {
+		name           string
+		fileName       string
+		content        []byte
+		expectedFormat service.Format
+	}{
+		{"tar.gz without suffix", "bundle.bin", createTestTarGz(t, map[string]string{"file_in_archive.txt": "archive content"}).Bytes(), service.FormatTarGzip},
+		{"tar.zst named as gz", "bundle.gz", zstdCompress(t, tarBytes), service.FormatTarZstd},
+		{"plain tar without suffix", "bundle", tarBytes, service.FormatTar},
+		{"zip named as tar", "bundle.tar", createTestZip(t, map[string]string{"file_in_archive.txt": "archive content"}).Bytes(), service.FormatZip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			result, err := service.UploadFileWithOptions(bytes.NewReader(tt.content), targetDir, tt.fileName, "", service.UploadOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFormat, result.Format)
+			assert.Equal(t, targetDir, result.Path)
+
+			content, err := os.ReadFile(filepath.Join(targetDir, "file_in_archive.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "archive content", string(content))
+		})
+	}
+
+	t.Run("zip container with unrecognised name is stored as-is", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		docx := createTestZip(t, map[string]string{"word/document.xml": "<w:document/>"}).Bytes()
+		result, err := service.UploadFileWithOptions(bytes.NewReader(docx), targetDir, "report.docx", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, service.FormatPlain, result.Format)
+		assert.Equal(t, filepath.Join(targetDir, "report.docx"), result.Path)
+
+		stored, err := os.ReadFile(result.Path)
+		require.NoError(t, err)
+		assert.Equal(t, docx, stored)
+	})
+
+	t.Run("tar name without tar content is rejected", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		_, err := service.UploadFileWithOptions(bytes.NewReader(bytes.Repeat([]byte("not a tar archive\n"), 64)), targetDir, "bundle.tar", "", service.UploadOptions{})
+		require.ErrorIs(t, err, service.ErrUnsupportedFormat)
+		_, err = os.Stat(targetDir)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("format override is honoured", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		result, err := service.UploadFileWithOptions(bytes.NewReader(tarBytes), targetDir, "bundle.tar", "", service.UploadOptions{Format: service.FormatPlain})
+		require.NoError(t, err)
+		assert.Equal(t, service.FormatPlain, result.Format)
+
+		stored, err := os.ReadFile(filepath.Join(targetDir, "bundle.tar"))
+		require.NoError(t, err)
+		assert.Equal(t, tarBytes, stored)
+	})
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// idempotencyKeyTTL is how long an idempotency key is remembered.
+const idempotencyKeyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength bounds the length of an idempotency key.
+const maxIdempotencyKeyLength = 255
+
+var (
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different upload")
+	ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+
+	errIdempotencyRecordStale = errors.New("idempotency record expired")
+)
+
+// idempotencyKeyLocks serializes the uploads made with the same key within
+// the process, so that concurrent retries to different targets cannot both
+// claim it. Entries are removed once no upload holds or waits for them.
+var idempotencyKeyLocks = struct {
+	sync.Mutex
+	keys map[string]*idempotencyKeyLock
+}{keys: make(map[string]*idempotencyKeyLock)}
+
+type idempotencyKeyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// IdempotencyStore remembers the uploads made with an idempotency key and the
+// upload last deployed to each target, so that a repeated upload returns the
+// original result instead of being deployed again.
+type IdempotencyStore struct {
+	dir string
+}
+
+// idempotencyRecord is the stored outcome of an upload.
+type idempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Results     []*UploadResult `json:"results"`
+	// TargetState is the treeState of the target after the upload.
+	TargetState string `json:"target_state"`
+}
+
+func NewIdempotencyStore(dir string) *IdempotencyStore {
+	return &IdempotencyStore{dir: dir}
+}
+
+func (s *IdempotencyStore) keyPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, "keys", hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *IdempotencyStore) targetPath(absTargetDir string) string {
+	sum := sha256.Sum256([]byte(absTargetDir))
+	return filepath.Join(s.dir, "targets", hex.EncodeToString(sum[:])+".json")
+}
+
+// Upload deploys parts like UploadFilesWithOptions. An upload of the content
+// last deployed to a target that has not changed since returns the stored
+// result without committing anything, whether or not it carries a key.
+// Uploads with a key are fingerprinted before anything is written: repeating
+// a key returns the stored result without touching the target and reusing a
+// key for a different upload is rejected with ErrIdempotencyKeyReused. Dry
+// runs are not remembered.
+func (s *IdempotencyStore) Upload(key string, parts []UploadPart, targetDirUserPath, pathPrefixEnv string, opts UploadOptions) ([]*UploadResult, error) {
+	if opts.DryRun {
+		return UploadFilesWithOptions(parts, targetDirUserPath, pathPrefixEnv, opts)
+	}
+	if len(key) > maxIdempotencyKeyLength || !isPrintable(key) {
+		return nil, fmt.Errorf("%w: keys are at most %d printable characters", ErrInvalidIdempotencyKey, maxIdempotencyKeyLength)
+	}
+	if err := validateUploadParts(parts, opts); err != nil {
+		return nil, err
+	}
+	absTargetDir, err := resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return s.uploadWithoutKey(parts, absTargetDir, pathPrefixEnv, opts)
+	}
+
+	spooledParts, digests, cleanup, err := spoolParts(parts, opts.limits().MaxUploadBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	fingerprint, err := uploadFingerprint(absTargetDir, spooledParts, digests, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The target lock keeps the target record consistent with the target
+	// and the key lock keeps a key from being claimed twice. Only uploads
+	// with the same key wait for each other on the latter, which is taken
+	// last so that a locked target still fails fast.
+	unlock, err := lockTarget(absTargetDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	unlockKey := lockIdempotencyKey(key)
+	defer unlockKey()
+
+	if record, err := s.load(s.keyPath(key), idempotencyKeyTTL); err == nil {
+		if record.Fingerprint != fingerprint {
+			return nil, fmt.Errorf("%w: '%s'", ErrIdempotencyKeyReused, key)
+		}
+		return record.Results, nil
+	} else if !os.IsNotExist(err) && !errors.Is(err, errIdempotencyRecordStale) {
+		return nil, err
+	}
+	record, err := s.lastDeployed(absTargetDir, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		results, err := deployParts(spooledParts, absTargetDir, pathPrefixEnv, opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		if record, err = s.saveTarget(absTargetDir, fingerprint, results); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.save(s.keyPath(key), record); err != nil {
+		return nil, err
+	}
+	return record.Results, nil
+}
+
+// uploadWithoutKey streams parts into staging like UploadFilesWithOptions
+// and checks the target record once they are staged and their digests are
+// known.
+func (s *IdempotencyStore) uploadWithoutKey(parts []UploadPart, absTargetDir, pathPrefixEnv string, opts UploadOptions) ([]*UploadResult, error) {
+	unlock, err := lockTarget(absTargetDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var fingerprint string
+	var stored bool
+	deployed := func(digests []string) ([]*UploadResult, error) {
+		var err error
+		if fingerprint, err = uploadFingerprint(absTargetDir, parts, digests, opts); err != nil {
+			return nil, err
+		}
+		record, err := s.lastDeployed(absTargetDir, fingerprint)
+		if err != nil || record == nil {
+			return nil, err
+		}
+		stored = true
+		return record.Results, nil
+	}
+	results, err := deployParts(parts, absTargetDir, pathPrefixEnv, opts, deployed)
+	if err != nil || stored {
+		return results, err
+	}
+	if _, err := s.saveTarget(absTargetDir, fingerprint, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// lastDeployed returns the record of the target when the target was left by
+// the upload with fingerprint and has not changed since, and nil otherwise.
+func (s *IdempotencyStore) lastDeployed(absTargetDir, fingerprint string) (*idempotencyRecord, error) {
+	record, err := s.load(s.targetPath(absTargetDir), 0)
+	if err != nil || record.Fingerprint != fingerprint {
+		return nil, nil
+	}
+	// Anything that changed the target since, including rollbacks and
+	// changes made outside of deploytar, invalidates the record.
+	state, err := treeState(absTargetDir)
+	if err != nil {
+		return nil, err
+	}
+	if state != record.TargetState {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// saveTarget records results as the upload with fingerprint that left the
+// target in its current state.
+func (s *IdempotencyStore) saveTarget(absTargetDir, fingerprint string, results []*UploadResult) (*idempotencyRecord, error) {
+	state, err := treeState(absTargetDir)
+	if err != nil {
+		return nil, err
+	}
+	record := &idempotencyRecord{Fingerprint: fingerprint, Results: results, TargetState: state}
+	if err := s.save(s.targetPath(absTargetDir), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func lockIdempotencyKey(key string) func() {
+	idempotencyKeyLocks.Lock()
+	l := idempotencyKeyLocks.keys[key]
+	if l == nil {
+		l = &idempotencyKeyLock{}
+		idempotencyKeyLocks.keys[key] = l
+	}
+	l.refs++
+	idempotencyKeyLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		idempotencyKeyLocks.Lock()
+		defer idempotencyKeyLocks.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(idempotencyKeyLocks.keys, key)
+		}
+	}
+}
+
+// UploadFile is Upload for a single file, like UploadFileWithOptions.
+func (s *IdempotencyStore) UploadFile(key string, inputStream io.Reader, targetDirUserPath, fileName, pathPrefixEnv string, opts UploadOptions) (*UploadResult, error) {
+	results, err := s.Upload(key, singleUploadPart(inputStream, fileName, opts), targetDirUserPath, pathPrefixEnv, opts)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// treeState summarizes the entries below dir by name, type, mode, size,
+// modification time and symlink target, so that any change to the tree
+// changes it. A missing dir has an empty state.
+func treeState(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		var linkTarget string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if linkTarget, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(h, "%q %v %d %d %q\n", filepath.ToSlash(rel), info.Mode(), info.Size(), info.ModTime().UnixNano(), linkTarget)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", dir, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// load reads a record, treating records older than ttl as stale when ttl is
+// not zero.
+func (s *IdempotencyStore) load(path string, ttl time.Duration) (*idempotencyRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 && time.Since(info.ModTime()) > ttl {
+		return nil, errIdempotencyRecordStale
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotency record '%s': %w", path, err)
+	}
+	return &record, nil
+}
+
+func (s *IdempotencyStore) save(path string, record *idempotencyRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create idempotency directory '%s': %w", filepath.Dir(path), err)
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write idempotency record: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write idempotency record: %w", err)
+	}
+	return nil
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// spoolParts copies every part to a temporary file so that its SHA-256 is
+// known before the upload is deployed.
+func spoolParts(parts []UploadPart, maxUploadBytes int64) ([]UploadPart, []string, func(), error) {
+	var files []*os.File
+	cleanup := func() {
+		for _, f := range files {
+			if err := f.Close(); err != nil {
+				_ = err
+			}
+			if err := os.Remove(f.Name()); err != nil {
+				_ = err
+			}
+		}
+	}
+
+	spooled := make([]UploadPart, len(parts))
+	digests := make([]string, len(parts))
+	for i, part := range parts {
+		inputStream, err := limitUploadSize(part.Reader, maxUploadBytes)
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+		f, err := os.CreateTemp("", "idempotent-upload-*.tmp")
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, fmt.Errorf("failed to create temporary file for upload: %w", err)
+		}
+		files = append(files, f)
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(f, h), inputStream); err != nil {
+			cleanup()
+			return nil, nil, nil, fmt.Errorf("failed to spool upload: %w", err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			cleanup()
+			return nil, nil, nil, fmt.Errorf("failed to rewind spooled upload: %w", err)
+		}
+		spooled[i] = part
+		spooled[i].Reader = f
+		digests[i] = hex.EncodeToString(h.Sum(nil))
+	}
+	return spooled, digests, cleanup, nil
+}
+
+// uploadFingerprint identifies an upload by its target, the digests and
+// per-file settings of its parts and the client supplied options that change
+// what is deployed. Options that UploadOptions does not serialize, like
+// LockTimeout, are left out.
+func uploadFingerprint(absTargetDir string, parts []UploadPart, digests []string, opts UploadOptions) (string, error) {
+	type partFingerprint struct {
+		FileName  string `json:"file_name"`
+		RelPath   string `json:"rel_path"`
+		Format    Format `json:"format"`
+		SHA256    string `json:"sha256"`
+		Signature string `json:"signature"`
+	}
+	fingerprint := struct {
+		Target  string            `json:"target"`
+		Parts   []partFingerprint `json:"parts"`
+		Options UploadOptions     `json:"options"`
+	}{Target: absTargetDir, Options: opts}
+	for i, part := range parts {
+		fingerprint.Parts = append(fingerprint.Parts, partFingerprint{
+			FileName:  part.FileName,
+			RelPath:   part.RelPath,
+			Format:    part.Format,
+			SHA256:    digests[i],
+			Signature: part.Signature,
+		})
+	}
+	encoded, err := json.Marshal(fingerprint)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upload fingerprint: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestIdempotencyStore_Upload(t *testing.T) {
+	site := map[string]string{"index.html": "v1"}
+	upload := func(t *testing.T, store *service.IdempotencyStore, key, targetDir string, files map[string]string) (*service.UploadResult, error) {
+		t.Helper()
+		return store.UploadFile(key, createTestTar(t, files), targetDir, "site.tar", "", service.UploadOptions{IsPutRequest: true})
+	}
+
+	t.Run("Repeated key returns the original result without deploying", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		first, err := upload(t, store, "build-1", targetDir, site)
+		require.NoError(t, err)
+
+		// A redeploy would restore the removed file.
+		require.NoError(t, os.Remove(filepath.Join(targetDir, "index.html")))
+		second, err := upload(t, store, "build-1", targetDir, site)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		_, err = os.Stat(filepath.Join(targetDir, "index.html"))
+		assert.True(t, os.IsNotExist(err), "The target should not be touched")
+	})
+
+	t.Run("Reused key with different content is rejected", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		_, err := upload(t, store, "build-1", targetDir, site)
+		require.NoError(t, err)
+
+		_, err = upload(t, store, "build-1", targetDir, map[string]string{"index.html": "v2"})
+		require.ErrorIs(t, err, service.ErrIdempotencyKeyReused)
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(content))
+
+		_, err = upload(t, store, "build-1", filepath.Join(t.TempDir(), "other"), site)
+		assert.ErrorIs(t, err, service.ErrIdempotencyKeyReused, "The key should be bound to its target")
+	})
+
+	t.Run("Retry with another lock timeout returns the original result", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		first, err := store.UploadFile("build-1", createTestTar(t, site), targetDir, "site.tar", "", service.UploadOptions{IsPutRequest: true})
+		require.NoError(t, err)
+
+		second, err := store.UploadFile("build-1", createTestTar(t, site), targetDir, "site.tar", "", service.UploadOptions{IsPutRequest: true, LockTimeout: time.Minute})
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("Content already deployed to an unchanged target is not redeployed", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		first, err := upload(t, store, "build-1", targetDir, site)
+		require.NoError(t, err)
+		info, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+
+		second, err := upload(t, store, "build-1-retry", targetDir, site)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		after, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(info, after), "The target should not be touched")
+	})
+
+	t.Run("Content already deployed is not redeployed without a key", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		first, err := upload(t, store, "", targetDir, site)
+		require.NoError(t, err)
+		info, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+
+		second, err := upload(t, store, "", targetDir, site)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		after, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(info, after), "The target should not be touched")
+	})
+
+	t.Run("Changed target is redeployed", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		_, err := upload(t, store, "build-1", targetDir, site)
+		require.NoError(t, err)
+
+		_, err = upload(t, store, "", targetDir, map[string]string{"index.html": "v2"})
+		require.NoError(t, err)
+		_, err = upload(t, store, "build-1-retry", targetDir, site)
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(content))
+	})
+
+	t.Run("Locked target fails fast while other keys proceed", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		root := t.TempDir()
+		pw, done := startBlockedUpload(t, filepath.Join(root, "a"))
+		defer func() {
+			require.NoError(t, pw.Close())
+			require.NoError(t, <-done)
+		}()
+
+		_, err := upload(t, store, "build-a", filepath.Join(root, "a"), site)
+		assert.ErrorIs(t, err, service.ErrTargetLocked)
+		_, err = upload(t, store, "build-b", filepath.Join(root, "b"), site)
+		assert.NoError(t, err, "Keyed uploads to other targets should not wait")
+	})
+
+	t.Run("Invalid key", func(t *testing.T) {
+		store := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		for _, key := range []string{"line\nbreak", strings.Repeat("k", 256)} {
+			_, err := upload(t, store, key, targetDir, site)
+			assert.ErrorIs(t, err, service.ErrInvalidIdempotencyKey)
+		}
+		_, err := os.Stat(targetDir)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+var ErrLimitExceeded = errors.New("upload limit exceeded")
+
+// Limits bounds the resources a single upload may consume. Zero values are
+// unlimited.
+type Limits struct {
+	// MaxUploadBytes bounds the size of the upload as received.
+	MaxUploadBytes int64
+	// MaxExtractedBytes bounds the total size written to the target.
+	MaxExtractedBytes int64
+	MaxFileBytes      int64
+	MaxEntries        int
+	MaxPathDepth      int
+	// MaxCompressionRatio bounds the bytes written relative to the bytes
+	// received, which stops decompression bombs early.
+	MaxCompressionRatio float64
+}
+
+// limitUploadSize enforces MaxUploadBytes on an upload stream. Streams with
+// random access are checked up front and returned unchanged, so that zip
+// archives can still be read in place.
+func limitUploadSize(inputStream io.Reader, maxBytes int64) (io.Reader, error) {
+	if maxBytes <= 0 {
+		return inputStream, nil
+	}
+	if _, size, ok := randomAccess(inputStream); ok {
+		if size > maxBytes {
+			return nil, fmt.Errorf("%w: upload is %d bytes, the maximum is %d", ErrLimitExceeded, size, maxBytes)
+		}
+		return inputStream, nil
+	}
+	return &uploadSizeReader{r: inputStream, max: maxBytes}, nil
+}
+
+type uploadSizeReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (u *uploadSizeReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.n += int64(n)
+	if u.n > u.max {
+		return n, fmt.Errorf("%w: upload is larger than %d bytes", ErrLimitExceeded, u.max)
+	}
+	return n, err
+}
+
+// extractLimiter accounts for the entries and bytes written by one upload.
+type extractLimiter struct {
+	limits Limits
+	// received reports the number of upload bytes consumed so far.
+	received  func() int64
+	entries   int
+	extracted int64
+}
+
+func newExtractLimiter(limits Limits, received func() int64) *extractLimiter {
+	return &extractLimiter{limits: limits, received: received}
+}
+
+// addEntry accounts for one archive entry before it is written.
+func (l *extractLimiter) addEntry(name string) error {
+	l.entries++
+	if l.limits.MaxEntries > 0 && l.entries > l.limits.MaxEntries {
+		return fmt.Errorf("%w: archive has more than %d entries", ErrLimitExceeded, l.limits.MaxEntries)
+	}
+	if l.limits.MaxPathDepth > 0 {
+		cleaned := filepath.ToSlash(filepath.Clean(name))
+		if depth := strings.Count(strings.Trim(cleaned, "/"), "/") + 1; depth > l.limits.MaxPathDepth {
+			return fmt.Errorf("%w: entry '%s' is nested %d levels deep, the maximum is %d", ErrLimitExceeded, name, depth, l.limits.MaxPathDepth)
+		}
+	}
+	return nil
+}
+
+// checkFileSize rejects an entry whose declared size is already too large.
+func (l *extractLimiter) checkFileSize(name string, size int64) error {
+	if l.limits.MaxFileBytes > 0 && size > l.limits.MaxFileBytes {
+		return fmt.Errorf("%w: '%s' is %d bytes, the maximum file size is %d", ErrLimitExceeded, name, size, l.limits.MaxFileBytes)
+	}
+	return nil
+}
+
+// copyFile copies src to dst while enforcing the file, total and ratio
+// limits. Declared sizes cannot be trusted, so the bytes are counted as they
+// are written.
+func (l *extractLimiter) copyFile(dst io.Writer, src io.Reader, name string) (int64, error) {
+	return io.Copy(&limitedWriter{w: dst, limiter: l, name: name}, src)
+}
+
+type limitedWriter struct {
+	w       io.Writer
+	limiter *extractLimiter
+	name    string
+	written int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	l := lw.limiter
+	lw.written += int64(len(p))
+	l.extracted += int64(len(p))
+	if err := l.checkFileSize(lw.name, lw.written); err != nil {
+		return 0, err
+	}
+	if l.limits.MaxExtractedBytes > 0 && l.extracted > l.limits.MaxExtractedBytes {
+		return 0, fmt.Errorf("%w: extracted content is larger than %d bytes", ErrLimitExceeded, l.limits.MaxExtractedBytes)
+	}
+	if l.limits.MaxCompressionRatio > 0 {
+		if received := max(l.received(), 1); float64(l.extracted) > l.limits.MaxCompressionRatio*float64(received) {
+			return 0, fmt.Errorf("%w: %d bytes extracted from %d received exceeds the compression ratio of %g", ErrLimitExceeded, l.extracted, received, l.limits.MaxCompressionRatio)
+		}
+	}
+	return lw.w.Write(p)
+}
@@ -0,0 +1,71 @@
+package service_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_Limits(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         strings.Repeat("a", 100),
+		"b.txt":         strings.Repeat("b", 100),
+		"deep/er/c.txt": "c",
+	}
+	tarBytes := createTestTar(t, files).Bytes()
+	bomb := createTestTarGz(t, map[string]string{"zeros.bin": strings.Repeat("\x00", 4<<20)}).Bytes()
+
+	testCases := []struct {
+		name     string
+		content  []byte
+		fileName string
+		limits   service.Limits
+		wantErr  bool
+	}{
+		{name: "within limits", content: tarBytes, fileName: "site.tar", limits: service.Limits{MaxUploadBytes: 1 << 20, MaxExtractedBytes: 1000, MaxFileBytes: 100, MaxEntries: 3, MaxPathDepth: 3}},
+		{name: "upload size", content: tarBytes, fileName: "site.tar", limits: service.Limits{MaxUploadBytes: 512}, wantErr: true},
+		{name: "extracted size", content: tarBytes, fileName: "site.tar", limits: service.Limits{MaxExtractedBytes: 150}, wantErr: true},
+		{name: "file size", content: tarBytes, fileName: "site.tar", limits: service.Limits{MaxFileBytes: 99}, wantErr: true},
+		{name: "entry count", content: tarBytes, fileName: "site.tar", limits: service.Limits{MaxEntries: 2}, wantErr: true},
+		{name: "path depth", content: tarBytes, fileName: "site.tar", limits: service.Limits{MaxPathDepth: 2}, wantErr: true},
+		{name: "compression ratio", content: bomb, fileName: "bomb.tar.gz", limits: service.Limits{MaxCompressionRatio: 100}, wantErr: true},
+		{name: "plain file size", content: []byte("hello"), fileName: "notes.txt", limits: service.Limits{MaxFileBytes: 4}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parentDir := t.TempDir()
+			targetDir := filepath.Join(parentDir, "site")
+			limits := tc.limits
+			// io.MultiReader hides random access, so the stream is read as it
+			// would be from a network connection.
+			input := io.MultiReader(bytes.NewReader(tc.content))
+
+			_, err := service.UploadFileWithOptions(input, targetDir, tc.fileName, "", service.UploadOptions{IsPutRequest: true, Limits: &limits})
+			if !tc.wantErr {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, service.ErrLimitExceeded)
+			_, statErr := os.Stat(targetDir)
+			assert.True(t, os.IsNotExist(statErr), "A rejected upload must not be committed")
+			entries, readErr := os.ReadDir(parentDir)
+			require.NoError(t, readErr)
+			assert.Empty(t, entries, "Partial extraction should be cleaned up")
+		})
+	}
+
+	t.Run("random access upload size", func(t *testing.T) {
+		limits := service.Limits{MaxUploadBytes: 512}
+		_, err := service.UploadFileWithOptions(bytes.NewReader(tarBytes), t.TempDir(), "site.tar", "", service.UploadOptions{Limits: &limits})
+		assert.ErrorIs(t, err, service.ErrLimitExceeded)
+	})
+}
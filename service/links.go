@@ -0,0 +1,190 @@
+package service
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinkHops bounds symlink resolution so that link cycles fail instead of
+// looping forever.
+const maxLinkHops = 255
+
+var errEscapesExtractDir = errors.New("resolves outside the extraction directory")
+
+// resolveInDir resolves relPath against startDir, which must lie inside
+// baseDir, following symlinks that already exist in fsys. Unlike a lexical
+// filepath.Join it sees where a path really lands once symlinks created by
+// earlier archive entries are taken into account. Components that do not
+// exist yet are resolved lexically.
+func resolveInDir(fsys stageFS, baseDir, startDir, relPath string) (string, error) {
+	if filepath.IsAbs(relPath) {
+		return "", errEscapesExtractDir
+	}
+	current := startDir
+	components := strings.Split(filepath.FromSlash(relPath), string(os.PathSeparator))
+	hops := 0
+	for len(components) > 0 {
+		component := components[0]
+		components = components[1:]
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if current == baseDir {
+				return "", errEscapesExtractDir
+			}
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, component)
+		info, err := fsys.Lstat(next)
+		if err != nil {
+			if os.IsNotExist(err) {
+				current = next
+				continue
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		hops++
+		if hops > maxLinkHops {
+			return "", fmt.Errorf("too many levels of symbolic links at '%s'", next)
+		}
+		linkTarget, err := fsys.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(linkTarget) {
+			return "", errEscapesExtractDir
+		}
+		components = append(strings.Split(linkTarget, string(os.PathSeparator)), components...)
+	}
+	return current, nil
+}
+
+// resolveEntryPath returns the staged path for an archive entry. The parent
+// directories are resolved through existing symlinks, the final component is
+// not, so the entry replaces a symlink of the same name instead of writing
+// through it.
+func resolveEntryPath(fsys stageFS, baseDir, archiveName, entryName string) (string, error) {
+	parentDir, err := resolveInDir(fsys, baseDir, baseDir, filepath.Dir(filepath.Clean(entryName)))
+	if err != nil {
+		return "", fmt.Errorf("path traversal attempt in archive '%s': parent directory of entry '%s' %w", archiveName, entryName, err)
+	}
+	return filepath.Join(parentDir, filepath.Base(filepath.Clean(entryName))), nil
+}
+
+// removeNonDirectory clears the way for a new entry at path, leaving
+// directories alone.
+func removeNonDirectory(fsys stageFS, path string) error {
+	info, err := fsys.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("'%s' is a directory", path)
+	}
+	return fsys.Remove(path)
+}
+
+// extractTarSymlink creates a symlink entry and returns its path. The link
+// target is resolved relative to the directory holding the link and must stay
+// inside baseDir.
+func extractTarSymlink(fsys stageFS, header *tar.Header, baseDir, archiveName string) (string, error) {
+	linkPath, err := resolveEntryPath(fsys, baseDir, archiveName, header.Name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := resolveInDir(fsys, baseDir, filepath.Dir(linkPath), header.Linkname); err != nil {
+		return "", fmt.Errorf("path traversal attempt in archive '%s': symlink '%s' -> '%s' %w", archiveName, header.Name, header.Linkname, err)
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directory for symlink '%s' from archive '%s': %w", linkPath, archiveName, err)
+	}
+	if err := removeNonDirectory(fsys, linkPath); err != nil {
+		return "", fmt.Errorf("failed to replace '%s' with symlink from archive '%s': %w", linkPath, archiveName, err)
+	}
+	if err := fsys.Symlink(header.Linkname, linkPath); err != nil {
+		return "", fmt.Errorf("failed to create symlink '%s' from archive '%s': %w", linkPath, archiveName, err)
+	}
+	return linkPath, nil
+}
+
+func extractTarHardLink(fsys stageFS, header *tar.Header, baseDir, archiveName string) error {
+	linkPath, err := resolveEntryPath(fsys, baseDir, archiveName, header.Name)
+	if err != nil {
+		return err
+	}
+	sourcePath, err := resolveInDir(fsys, baseDir, baseDir, header.Linkname)
+	if err != nil {
+		return fmt.Errorf("path traversal attempt in archive '%s': hard link '%s' -> '%s' %w", archiveName, header.Name, header.Linkname, err)
+	}
+	sourceInfo, err := fsys.Lstat(sourcePath)
+	if err != nil {
+		return fmt.Errorf("hard link '%s' in archive '%s' refers to missing entry '%s': %w", header.Name, archiveName, header.Linkname, err)
+	}
+	if !sourceInfo.Mode().IsRegular() {
+		return fmt.Errorf("hard link '%s' in archive '%s' must refer to a regular file, '%s' is not", header.Name, archiveName, header.Linkname)
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory for hard link '%s' from archive '%s': %w", linkPath, archiveName, err)
+	}
+	if err := removeNonDirectory(fsys, linkPath); err != nil {
+		return fmt.Errorf("failed to replace '%s' with hard link from archive '%s': %w", linkPath, archiveName, err)
+	}
+	if err := fsys.Link(sourcePath, linkPath); err != nil {
+		return fmt.Errorf("failed to create hard link '%s' from archive '%s': %w", linkPath, archiveName, err)
+	}
+	return nil
+}
+
+// verifySymlinks re-resolves every symlink extracted from an archive. A link
+// that was safe when created can escape once a later entry turns one of the
+// components it passes through into a symlink, so the check is repeated after
+// the whole archive has been written. Escaping links are removed.
+func verifySymlinks(fsys stageFS, baseDir, archiveName string, linkPaths []string) error {
+	for _, linkPath := range linkPaths {
+		linkTarget, err := fsys.Readlink(linkPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to read symlink '%s' from archive '%s': %w", linkPath, archiveName, err)
+		}
+		if _, err := resolveInDir(fsys, baseDir, filepath.Dir(linkPath), linkTarget); err != nil {
+			if rmErr := fsys.Remove(linkPath); rmErr != nil {
+				_ = rmErr
+			}
+			return fmt.Errorf("path traversal attempt in archive '%s': symlink '%s' -> '%s' %w", archiveName, linkPath, linkTarget, err)
+		}
+	}
+	return nil
+}
+
+func skippedTarEntryReason(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeChar:
+		return "character device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "fifo"
+	default:
+		return fmt.Sprintf("unsupported entry type '%c'", typeflag)
+	}
+}
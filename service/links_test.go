@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func createTestTarWithHeaders(t *testing.T, headers []*tar.Header, contents map[string]string) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range headers {
+		content := contents[hdr.Name]
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(content))
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if content != "" {
+			_, err := tw.Write([]byte(content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf
+}
+
+func TestUploadFile_TarLinks(t *testing.T) {
+	t.Run("symlinks and hard links are preserved", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		archive := createTestTarWithHeaders(t, []*tar.Header{
+			{Name: "assets/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "assets/app.js", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "latest.js", Typeflag: tar.TypeSymlink, Linkname: "assets/app.js"},
+			{Name: "assets/copy.js", Typeflag: tar.TypeLink, Linkname: "assets/app.js"},
+			{Name: "static", Typeflag: tar.TypeSymlink, Linkname: "assets"},
+			{Name: "static/through-link.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}, map[string]string{
+			"assets/app.js":           "console.log(1)",
+			"static/through-link.txt": "via link",
+		})
+
+		result, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, result.Skipped)
+
+		linkTarget, err := os.Readlink(filepath.Join(targetDir, "latest.js"))
+		require.NoError(t, err)
+		assert.Equal(t, "assets/app.js", linkTarget)
+
+		appInfo, err := os.Stat(filepath.Join(targetDir, "assets", "app.js"))
+		require.NoError(t, err)
+		copyInfo, err := os.Stat(filepath.Join(targetDir, "assets", "copy.js"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(appInfo, copyInfo))
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "assets", "through-link.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "via link", string(content))
+	})
+
+	escapeTests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{"absolute symlink", []*tar.Header{
+			{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		}},
+		{"relative symlink leaving the directory", []*tar.Header{
+			{Name: "sub/up", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+		}},
+		{"symlink escaping through another symlink", []*tar.Header{
+			{Name: "here", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "here/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		}},
+		{"symlink that escapes after a later entry", []*tar.Header{
+			{Name: "later", Typeflag: tar.TypeSymlink, Linkname: "dir/.."},
+			{Name: "dir", Typeflag: tar.TypeSymlink, Linkname: "."},
+		}},
+		{"hard link to a file outside", []*tar.Header{
+			{Name: "shadow", Typeflag: tar.TypeLink, Linkname: "../outside.txt"},
+		}},
+	}
+	for _, tt := range escapeTests {
+		t.Run("reject "+tt.name, func(t *testing.T) {
+			parentDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(parentDir, "outside.txt"), []byte("secret"), 0644))
+			targetDir := filepath.Join(parentDir, "target")
+			archive := createTestTarWithHeaders(t, tt.headers, nil)
+
+			_, err := service.UploadFile(archive, targetDir, "evil.tar", "", false)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "path traversal attempt")
+		})
+	}
+
+	t.Run("device and fifo entries are reported as skipped", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		archive := createTestTarWithHeaders(t, []*tar.Header{
+			{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "pipe", Typeflag: tar.TypeFifo, Mode: 0644},
+			{Name: "null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3},
+		}, map[string]string{"file.txt": "content"})
+
+		result, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []service.SkippedEntry{
+			{Name: "pipe", Reason: "fifo"},
+			{Name: "null", Reason: "character device"},
+		}, result.Skipped)
+
+		_, err = os.Lstat(filepath.Join(targetDir, "pipe"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("pax global headers are ignored", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "target")
+		archive := createTestTarWithHeaders(t, []*tar.Header{
+			{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123456789abcdef"}},
+			{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}, map[string]string{"file.txt": "content"})
+
+		result, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, result.Skipped)
+		assert.Equal(t, []string{"file.txt"}, listFiles(t, targetDir))
+	})
+}
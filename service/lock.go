@@ -0,0 +1,182 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTargetLocked = errors.New("target is locked by another deployment")
+
+// lockFilePollInterval is how often a lock file held by another process is
+// retried while waiting for it.
+const lockFilePollInterval = 50 * time.Millisecond
+
+// targetLocks tracks the targets being deployed by this process. released is
+// closed and replaced whenever a target is unlocked, waking up the waiters.
+var targetLocks = struct {
+	sync.Mutex
+	held     map[string]bool
+	released chan struct{}
+}{held: make(map[string]bool), released: make(chan struct{})}
+
+// lockTarget serializes deployments to absTargetDir with the deployments to
+// the same directory, its parents and its children, in this process and, when
+// opts.LockDir is set, in every process sharing that directory. It waits up to
+// opts.LockTimeout for conflicting deployments to finish and then fails with
+// ErrTargetLocked.
+func lockTarget(absTargetDir string, opts UploadOptions) (unlock func(), err error) {
+	deadline := time.Now().Add(opts.LockTimeout)
+	key, err := lockKey(absTargetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		targetLocks.Lock()
+		if !isTargetLockHeld(key) {
+			targetLocks.held[key] = true
+			targetLocks.Unlock()
+			break
+		}
+		released := targetLocks.released
+		targetLocks.Unlock()
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("%w: '%s'", ErrTargetLocked, absTargetDir)
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-released:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	unlockTarget := func() {
+		targetLocks.Lock()
+		defer targetLocks.Unlock()
+		delete(targetLocks.held, key)
+		close(targetLocks.released)
+		targetLocks.released = make(chan struct{})
+	}
+
+	if opts.LockDir == "" {
+		return unlockTarget, nil
+	}
+	unlockFiles, err := lockTargetFiles(opts.LockDir, key, deadline)
+	if err != nil {
+		unlockTarget()
+		if errors.Is(err, ErrTargetLocked) {
+			return nil, fmt.Errorf("%w: '%s'", ErrTargetLocked, absTargetDir)
+		}
+		return nil, err
+	}
+	return func() {
+		unlockFiles()
+		unlockTarget()
+	}, nil
+}
+
+// lockKey returns absTargetDir with the symlinks of its existing part
+// resolved, so that every path to a directory takes the same lock.
+func lockKey(absTargetDir string) (string, error) {
+	existing, rest := absTargetDir, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve '%s': %w", existing, err)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return absTargetDir, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// isTargetLockHeld reports whether key, one of its parents or one of its
+// children is locked. The caller holds targetLocks.
+func isTargetLockHeld(key string) bool {
+	for held := range targetLocks.held {
+		if isSameOrWithin(held, key) || isSameOrWithin(key, held) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSameOrWithin(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(os.PathSeparator))+string(os.PathSeparator))
+}
+
+// lockTargetFiles takes the lock files of key in lockDir: a shared lock on
+// the file of every parent directory and an exclusive lock on its own, so
+// that deployments to the same directory or to a parent and a child conflict
+// while deployments to siblings do not. The locks are taken without blocking
+// and retried until deadline, which avoids deadlocks between processes
+// locking overlapping targets.
+func lockTargetFiles(lockDir, key string, deadline time.Time) (func(), error) {
+	if err := os.MkdirAll(lockDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory '%s': %w", lockDir, err)
+	}
+	var dirs []string
+	for dir := key; ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	for {
+		var files []*os.File
+		release := func() {
+			for _, f := range files {
+				if err := unlockFile(f); err != nil {
+					_ = err
+				}
+				if err := f.Close(); err != nil {
+					_ = err
+				}
+			}
+		}
+		locked := true
+		for i, dir := range dirs {
+			sum := sha256.Sum256([]byte(dir))
+			f, err := os.OpenFile(filepath.Join(lockDir, hex.EncodeToString(sum[:])+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+			if err != nil {
+				release()
+				return nil, fmt.Errorf("failed to open lock file for '%s': %w", dir, err)
+			}
+			files = append(files, f)
+			ok, err := tryLockFile(f, i == len(dirs)-1)
+			if err != nil {
+				release()
+				return nil, fmt.Errorf("failed to lock '%s': %w", dir, err)
+			}
+			if !ok {
+				locked = false
+				break
+			}
+		}
+		if locked {
+			return release, nil
+		}
+		release()
+
+		if !time.Now().Before(deadline) {
+			return nil, ErrTargetLocked
+		}
+		time.Sleep(min(lockFilePollInterval, time.Until(deadline)))
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_TargetLockFiles(t *testing.T) {
+	lockDir := t.TempDir()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	parentDir := filepath.Join(root, "sites")
+
+	// Another replica deploying to the parent holds its lock file.
+	sum := sha256.Sum256([]byte(parentDir))
+	lockFile, err := os.OpenFile(filepath.Join(lockDir, hex.EncodeToString(sum[:])+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	require.NoError(t, err)
+	defer func() {
+		if err := lockFile.Close(); err != nil {
+			_ = err
+		}
+	}()
+	require.NoError(t, syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX))
+
+	upload := func(targetDir, lockDir string) error {
+		_, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "home"}), targetDir, "site.tar", "", service.UploadOptions{IsPutRequest: true, LockDir: lockDir})
+		return err
+	}
+	assert.ErrorIs(t, upload(filepath.Join(parentDir, "a"), lockDir), service.ErrTargetLocked)
+	assert.NoError(t, upload(filepath.Join(parentDir, "a"), ""), "Lock files should only be used when configured")
+	assert.NoError(t, upload(filepath.Join(root, "other"), lockDir))
+
+	require.NoError(t, syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN))
+	assert.NoError(t, upload(filepath.Join(parentDir, "a"), lockDir))
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package service
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockFilesUnsupported = errors.New("lock files are not supported on this platform")
+
+func tryLockFile(_ *os.File, _ bool) (bool, error) {
+	return false, errLockFilesUnsupported
+}
+
+func unlockFile(_ *os.File) error {
+	return errLockFilesUnsupported
+}
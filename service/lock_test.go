@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+// startBlockedUpload starts a PUT of a plain file to targetDir that holds the
+// target lock until the returned writer is closed.
+func startBlockedUpload(t *testing.T, targetDir string) (*io.PipeWriter, <-chan error) {
+	t.Helper()
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := service.UploadFileWithOptions(pr, targetDir, "slow.txt", "", service.UploadOptions{IsPutRequest: true, Format: service.FormatPlain})
+		done <- err
+	}()
+	// The upload holds the lock once it reads its content.
+	_, err := pw.Write([]byte("slow"))
+	require.NoError(t, err)
+	return pw, done
+}
+
+func TestUploadFileWithOptions_TargetLock(t *testing.T) {
+	root := t.TempDir()
+	upload := func(targetDir string, lockTimeout time.Duration) error {
+		_, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "home"}), targetDir, "site.tar", "", service.UploadOptions{IsPutRequest: true, LockTimeout: lockTimeout})
+		return err
+	}
+
+	pw, done := startBlockedUpload(t, filepath.Join(root, "sites", "a"))
+
+	assert.ErrorIs(t, upload(filepath.Join(root, "sites", "a"), 0), service.ErrTargetLocked)
+	assert.ErrorIs(t, upload(filepath.Join(root, "sites"), 0), service.ErrTargetLocked, "A parent target should conflict")
+	assert.ErrorIs(t, upload(filepath.Join(root, "sites", "a", "docs"), 0), service.ErrTargetLocked, "A child target should conflict")
+	assert.ErrorIs(t, upload(filepath.Join(root, "sites", "a"), 50*time.Millisecond), service.ErrTargetLocked, "Waiting should time out")
+	assert.NoError(t, upload(filepath.Join(root, "sites", "b"), 0), "A sibling target should not conflict")
+	assert.NoError(t, upload(filepath.Join(root, "sites", "ab"), 0))
+
+	waited := make(chan error, 1)
+	go func() { waited <- upload(filepath.Join(root, "sites"), 10*time.Second) }()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, pw.Close())
+	require.NoError(t, <-done)
+	require.NoError(t, <-waited, "A waiting upload should proceed once the lock is released")
+
+	content, err := os.ReadFile(filepath.Join(root, "sites", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "home", string(content))
+	_, err = os.Stat(filepath.Join(root, "sites", "a"))
+	assert.True(t, os.IsNotExist(err), "The PUT to the parent should have replaced the child")
+}
+
+func TestUploadFileWithOptions_TargetLockDryRun(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "site")
+	pw, done := startBlockedUpload(t, targetDir)
+	defer func() {
+		require.NoError(t, pw.Close())
+		require.NoError(t, <-done)
+	}()
+
+	_, err := service.UploadFileWithOptions(bytes.NewBufferString("plan"), targetDir, "plan.txt", "", service.UploadOptions{DryRun: true, Format: service.FormatPlain})
+	assert.NoError(t, err, "Dry runs should not take the lock")
+}
+
+func TestReleases_TargetLock(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "app")
+	release, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "v1"}), targetDir, "site.tar", "", service.UploadOptions{Release: true})
+	require.NoError(t, err)
+
+	pw, done := startBlockedUpload(t, filepath.Join(targetDir, "current", "uploads"))
+	_, err = service.RollbackRelease(targetDir, "", release.ReleaseID, service.UploadOptions{})
+	assert.ErrorIs(t, err, service.ErrTargetLocked)
+	_, err = service.PruneReleases(targetDir, "", 1, service.UploadOptions{LockTimeout: 50 * time.Millisecond})
+	assert.ErrorIs(t, err, service.ErrTargetLocked, "Waiting should time out")
+
+	require.NoError(t, pw.Close())
+	require.NoError(t, <-done)
+	_, err = service.RollbackRelease(targetDir, "", release.ReleaseID, service.UploadOptions{})
+	assert.NoError(t, err)
+	_, err = service.PruneReleases(targetDir, "", 1, service.UploadOptions{})
+	assert.NoError(t, err)
+}
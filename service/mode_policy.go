@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const specialModeBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// ModePolicy controls the permissions and timestamps of extracted files.
+type ModePolicy struct {
+	// Umask is cleared from the permission bits recorded in the archive.
+	Umask os.FileMode
+	// KeepSpecialBits keeps setuid, setgid and sticky bits instead of
+	// stripping them.
+	KeepSpecialBits bool
+	// FileMode and DirMode, when non-zero, replace the recorded permissions.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	// RestoreDirModTimes restores directory modification times once all of
+	// their children have been written.
+	RestoreDirModTimes bool
+}
+
+// DefaultModePolicy returns the policy used when none is configured.
+func DefaultModePolicy() ModePolicy {
+	return ModePolicy{Umask: 0022}
+}
+
+// ParseMode parses an octal permission string such as "0644".
+func ParseMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid octal permission '%s'", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+func (p ModePolicy) apply(recorded os.FileMode, forced os.FileMode) os.FileMode {
+	if forced != 0 {
+		return forced
+	}
+	mode := recorded.Perm() &^ p.Umask
+	if p.KeepSpecialBits {
+		mode |= recorded & specialModeBits
+	}
+	return mode
+}
+
+func (p ModePolicy) fileMode(recorded os.FileMode) os.FileMode {
+	return p.apply(recorded, p.FileMode)
+}
+
+func (p ModePolicy) dirMode(recorded os.FileMode) os.FileMode {
+	return p.apply(recorded, p.DirMode)
+}
+
+// finishFile applies the policy mode to a file that has just been written and
+// restores its modification time when the archive recorded one.
+func (p ModePolicy) finishFile(fsys stageFS, path string, recorded os.FileMode, modTime time.Time) error {
+	if err := fsys.Chmod(path, p.fileMode(recorded)); err != nil {
+		return fmt.Errorf("failed to set mode of '%s': %w", path, err)
+	}
+	if !modTime.IsZero() {
+		if err := fsys.Chtimes(path, time.Time{}, modTime); err != nil {
+			return fmt.Errorf("failed to set modification time of '%s': %w", path, err)
+		}
+	}
+	return nil
+}
+
+type extractedDir struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// finishDirs applies directory modes, and optionally modification times,
+// after extraction. Modes are applied last so that a read-only directory does
+// not prevent its children from being written.
+func (p ModePolicy) finishDirs(fsys stageFS, dirs []extractedDir) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if err := fsys.Chmod(dir.path, p.dirMode(dir.mode)); err != nil {
+			return fmt.Errorf("failed to set mode of directory '%s': %w", dir.path, err)
+		}
+		if p.RestoreDirModTimes && !dir.modTime.IsZero() {
+			if err := fsys.Chtimes(dir.path, time.Time{}, dir.modTime); err != nil {
+				return fmt.Errorf("failed to set modification time of directory '%s': %w", dir.path, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package service_test
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_ModePolicy(t *testing.T) {
+	fileTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dirTime := time.Date(2023, 6, 15, 8, 30, 0, 0, time.UTC)
+	newArchive := func() []*tar.Header {
+		return []*tar.Header{
+			{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0555, ModTime: dirTime},
+			{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 04777, ModTime: fileTime},
+		}
+	}
+	contents := map[string]string{"bin/tool": "#!/bin/sh"}
+
+	tests := []struct {
+		name            string
+		policy          *service.ModePolicy
+		expectedFile    os.FileMode
+		expectedDir     os.FileMode
+		restoresDirTime bool
+	}{
+		{"default policy applies umask and strips setuid", nil, 0755, 0555, false},
+		{"special bits kept when allowed", &service.ModePolicy{Umask: 0022, KeepSpecialBits: true}, 0755 | os.ModeSetuid, 0555, false},
+		{"forced modes", &service.ModePolicy{FileMode: 0640, DirMode: 0750}, 0640, 0750, false},
+		{"directory mtimes restored", &service.ModePolicy{Umask: 0022, RestoreDirModTimes: true}, 0755, 0555, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			t.Cleanup(func() {
+				if err := os.Chmod(filepath.Join(targetDir, "bin"), 0755); err != nil {
+					_ = err
+				}
+			})
+			archive := createTestTarWithHeaders(t, newArchive(), contents)
+
+			_, err := service.UploadFileWithOptions(archive, targetDir, "tools.tar", "", service.UploadOptions{ModePolicy: tt.policy})
+			require.NoError(t, err)
+
+			fileInfo, err := os.Stat(filepath.Join(targetDir, "bin", "tool"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFile, fileInfo.Mode()&(os.ModePerm|os.ModeSetuid))
+			assert.True(t, fileInfo.ModTime().Equal(fileTime), "file mtime %v", fileInfo.ModTime())
+
+			dirInfo, err := os.Stat(filepath.Join(targetDir, "bin"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDir, dirInfo.Mode().Perm())
+			assert.Equal(t, tt.restoresDirTime, dirInfo.ModTime().Equal(dirTime))
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := service.ParseMode("0640")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), mode)
+
+	_, err = service.ParseMode("4755")
+	assert.Error(t, err)
+	_, err = service.ParseMode("rw-r--r--")
+	assert.Error(t, err)
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits the space used below every directory matching Pattern. The
+// pattern is a slash separated glob relative to PATH_PREFIX, such as "*" for
+// each top-level directory or "teams/*". Zero limits are unlimited.
+type Quota struct {
+	Pattern   string
+	MaxBytes  int64
+	MaxInodes int64
+}
+
+// QuotaUsage is the current usage of one directory governed by a quota.
+type QuotaUsage struct {
+	Quota
+	Path   string
+	Bytes  int64
+	Inodes int64
+}
+
+type diskUsage struct {
+	bytes  int64
+	inodes int64
+}
+
+var byteSizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseQuotas parses quota definitions separated by newlines or semicolons,
+// each a pattern followed by "bytes=<size>" and/or "inodes=<count>". Sizes
+// accept K, M, G and T suffixes, e.g. "* bytes=10G inodes=100000".
+func ParseQuotas(text string) ([]Quota, error) {
+	var quotas []Quota
+	for _, definition := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ';' }) {
+		fields := strings.Fields(definition)
+		if len(fields) == 0 {
+			continue
+		}
+		quota := Quota{Pattern: strings.Trim(fields[0], "/")}
+		if _, err := path.Match(quota.Pattern, ""); err != nil || quota.Pattern == "" || path.Clean(quota.Pattern) != quota.Pattern || strings.HasPrefix(quota.Pattern, "..") {
+			return nil, fmt.Errorf("invalid quota pattern '%s'", fields[0])
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("quota '%s' has no limits", quota.Pattern)
+		}
+		for _, field := range fields[1:] {
+			name, value, _ := strings.Cut(field, "=")
+			var err error
+			switch name {
+			case "bytes":
+				quota.MaxBytes, err = parseByteSize(value)
+			case "inodes":
+				quota.MaxInodes, err = strconv.ParseInt(value, 10, 64)
+			default:
+				return nil, fmt.Errorf("unknown quota limit '%s' for '%s'", field, quota.Pattern)
+			}
+			if err != nil || quota.MaxBytes < 0 || quota.MaxInodes < 0 {
+				return nil, fmt.Errorf("invalid quota limit '%s' for '%s'", field, quota.Pattern)
+			}
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
+
+// parseByteSize parses a byte count with an optional K, M, G or T suffix,
+// optionally followed by "iB" or "B". Units are powers of 1024.
+func parseByteSize(value string) (int64, error) {
+	upper := strings.TrimSuffix(strings.ToUpper(value), "B")
+	numberEnd := strings.IndexFunc(upper, func(r rune) bool { return r < '0' || r > '9' })
+	if numberEnd < 0 {
+		numberEnd = len(upper)
+	}
+	unit, ok := byteSizeUnits[strings.TrimSuffix(upper[numberEnd:], "I")]
+	if !ok {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	n, err := strconv.ParseInt(upper[:numberEnd], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return n * unit, nil
+}
+
+// quotaRoot returns the directory quota patterns are relative to.
+func quotaRoot(pathPrefixEnv string) string {
+	if pathPrefixEnv == "" {
+		return string(filepath.Separator)
+	}
+	if abs, err := filepath.Abs(pathPrefixEnv); err == nil {
+		return abs
+	}
+	return filepath.Clean(pathPrefixEnv)
+}
+
+// QuotaUsages reports the usage of every existing directory matching one of
+// the quotas.
+func QuotaUsages(quotas []Quota, pathPrefixEnv string) ([]QuotaUsage, error) {
+	root := quotaRoot(pathPrefixEnv)
+	var usages []QuotaUsage
+	for _, quota := range quotas {
+		dirs, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(quota.Pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota pattern '%s': %w", quota.Pattern, err)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+				continue
+			}
+			usage, err := measureUsage(diskFS, dir, "")
+			if err != nil {
+				return nil, err
+			}
+			usages = append(usages, QuotaUsage{Quota: quota, Path: dir, Bytes: usage.bytes, Inodes: usage.inodes})
+		}
+	}
+	return usages, nil
+}
+
+// affectedDirs returns the directories governed by q that an upload to
+// targetDir can change: the one containing targetDir, or, when targetDir is
+// above the quota level, those below it that exist now or in the tree staged
+// in fsys.
+func (q Quota) affectedDirs(fsys stageFS, root, targetDir, stagingDir string) []string {
+	rel, err := filepath.Rel(root, targetDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	var targetParts []string
+	if rel != "." {
+		targetParts = strings.Split(filepath.ToSlash(rel), "/")
+	}
+	patternParts := strings.Split(q.Pattern, "/")
+
+	common := min(len(targetParts), len(patternParts))
+	for i := 0; i < common; i++ {
+		if ok, _ := path.Match(patternParts[i], targetParts[i]); !ok {
+			return nil
+		}
+	}
+	if len(targetParts) >= len(patternParts) {
+		return []string{filepath.Join(root, filepath.FromSlash(strings.Join(targetParts[:len(patternParts)], "/")))}
+	}
+
+	rest := filepath.FromSlash(strings.Join(patternParts[len(targetParts):], "/"))
+	seen := make(map[string]bool)
+	var dirs []string
+	existing, _ := filepath.Glob(filepath.Join(targetDir, rest))
+	staged, _ := fsys.Glob(filepath.Join(stagingDir, rest))
+	for _, stagedPath := range staged {
+		relStaged, err := filepath.Rel(stagingDir, stagedPath)
+		if err == nil {
+			existing = append(existing, filepath.Join(targetDir, relStaged))
+		}
+	}
+	for _, dir := range existing {
+		// The PATH_PREFIX root holds its own staging directory.
+		if dir == stagingDir {
+			continue
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// checkQuotas verifies that committing stagingDir, staged in fsys, to targetDir
+// keeps every affected quota directory within its limits. replaced returns the
+// usage of an existing directory that the commit removes, given the staged
+// directory that takes its place.
+func checkQuotas(fsys stageFS, quotas []Quota, pathPrefixEnv, targetDir, stagingDir string, replaced func(fsys stageFS, stagedDir, dir string) (diskUsage, error)) error {
+	root := quotaRoot(pathPrefixEnv)
+	for _, quota := range quotas {
+		for _, dir := range quota.affectedDirs(fsys, root, targetDir, stagingDir) {
+			scope, stagedDir := targetDir, stagingDir
+			if rel, err := filepath.Rel(targetDir, dir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+				scope, stagedDir = dir, filepath.Join(stagingDir, rel)
+			}
+
+			// Staging directories can live inside dir and must not be
+			// counted twice.
+			current, err := measureUsage(diskFS, dir, stagingDir)
+			if err != nil {
+				return err
+			}
+			staged, err := measureUsage(fsys, stagedDir, "")
+			if err != nil {
+				return err
+			}
+			removed, err := replaced(fsys, stagedDir, scope)
+			if err != nil {
+				return err
+			}
+
+			projectedBytes := current.bytes - removed.bytes + staged.bytes
+			projectedInodes := current.inodes - removed.inodes + staged.inodes
+			if quota.MaxBytes > 0 && projectedBytes > quota.MaxBytes {
+				return fmt.Errorf("%w: '%s' would use %d bytes, the quota for '%s' is %d", ErrQuotaExceeded, dir, projectedBytes, quota.Pattern, quota.MaxBytes)
+			}
+			if quota.MaxInodes > 0 && projectedInodes > quota.MaxInodes {
+				return fmt.Errorf("%w: '%s' would use %d inodes, the quota for '%s' is %d", ErrQuotaExceeded, dir, projectedInodes, quota.Pattern, quota.MaxInodes)
+			}
+		}
+	}
+	return nil
+}
+
+// measureUsage returns the size of the regular files below dir in fsys and the
+// number of entries including dir itself, leaving out the exclude subtree. A missing
+// dir uses nothing.
+func measureUsage(fsys stageFS, dir, exclude string) (diskUsage, error) {
+	var usage diskUsage
+	err := fsys.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if exclude != "" && (p == exclude || strings.HasPrefix(p, exclude+string(filepath.Separator))) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		usage.inodes++
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			usage.bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return diskUsage{}, fmt.Errorf("failed to measure usage of '%s': %w", dir, err)
+	}
+	return usage, nil
+}
+
+// replacedByPut returns the usage removed when dir is swapped for the upload.
+func replacedByPut(_ stageFS, _, dir string) (diskUsage, error) {
+	return measureUsage(diskFS, dir, "")
+}
+
+// replacedByMerge returns the usage removed when stagedDir, staged in fsys, is
+// merged into dir the way mergeDirectory does: directories present on both
+// sides are kept and every other existing entry is replaced.
+func replacedByMerge(fsys stageFS, stagedDir, dir string) (diskUsage, error) {
+	var usage diskUsage
+	stagedInfo, err := fsys.Lstat(stagedDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usage, nil
+		}
+		return usage, fmt.Errorf("failed to stat '%s': %w", stagedDir, err)
+	}
+	dirInfo, err := os.Lstat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usage, nil
+		}
+		return usage, fmt.Errorf("failed to stat '%s': %w", dir, err)
+	}
+	if !stagedInfo.IsDir() || !dirInfo.IsDir() {
+		return measureUsage(diskFS, dir, "")
+	}
+
+	// The existing directory is kept in place of the staged one.
+	usage.inodes++
+	entries, err := fsys.ReadDir(stagedDir)
+	if err != nil {
+		return usage, fmt.Errorf("failed to read staging directory '%s': %w", stagedDir, err)
+	}
+	for _, entry := range entries {
+		entryUsage, err := replacedByMerge(fsys, filepath.Join(stagedDir, entry.Name()), filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return usage, err
+		}
+		usage.bytes += entryUsage.bytes
+		usage.inodes += entryUsage.inodes
+	}
+	return usage, nil
+}
+
+// replacedByRelease returns nothing, as a release never replaces content.
+func replacedByRelease(_ stageFS, _, _ string) (diskUsage, error) {
+	return diskUsage{}, nil
+}
@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestParseQuotas(t *testing.T) {
+	quotas, err := service.ParseQuotas("* bytes=10M inodes=1000; teams/* bytes=1GiB\nshared inodes=5")
+	require.NoError(t, err)
+	assert.Equal(t, []service.Quota{
+		{Pattern: "*", MaxBytes: 10 << 20, MaxInodes: 1000},
+		{Pattern: "teams/*", MaxBytes: 1 << 30},
+		{Pattern: "shared", MaxInodes: 5},
+	}, quotas)
+
+	for _, invalid := range []string{"*", "* bytes=ten", "../* bytes=1", "[ bytes=1", "* files=1"} {
+		_, err := service.ParseQuotas(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestUploadFileWithOptions_Quotas(t *testing.T) {
+	prefix := t.TempDir()
+	quotas := []service.Quota{{Pattern: "*", MaxBytes: 1000, MaxInodes: 10}}
+	upload := func(target, fileName string, content []byte, isPut bool) error {
+		_, err := service.UploadFileWithOptions(bytes.NewReader(content), target, fileName, prefix, service.UploadOptions{IsPutRequest: isPut, Quotas: quotas})
+		return err
+	}
+	fill := []byte(strings.Repeat("x", 600))
+
+	require.NoError(t, upload(filepath.Join(prefix, "team-a", "site"), "data.bin", fill, true))
+	require.NoError(t, upload(filepath.Join(prefix, "team-a", "site"), "data.bin", fill, true), "PUT replaces the previous upload")
+	require.NoError(t, upload(filepath.Join(prefix, "team-a", "site"), "data.bin", fill, false), "POST overwrites the existing file")
+	require.NoError(t, upload(filepath.Join(prefix, "team-b"), "data.bin", fill, true), "Quotas apply per directory")
+
+	err := upload(filepath.Join(prefix, "team-a", "other"), "data.bin", fill, true)
+	require.ErrorIs(t, err, service.ErrQuotaExceeded)
+	_, statErr := os.Stat(filepath.Join(prefix, "team-a", "other"))
+	assert.True(t, os.IsNotExist(statErr))
+
+	t.Run("upload above the quota level", func(t *testing.T) {
+		archive := createTestTar(t, map[string]string{"team-b/more.bin": string(fill)}).Bytes()
+		err := upload(prefix, "teams.tar", archive, false)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+
+	t.Run("inodes", func(t *testing.T) {
+		files := make(map[string]string)
+		for _, name := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"} {
+			files[name] = ""
+		}
+		archive := createTestTar(t, files).Bytes()
+		err := upload(filepath.Join(prefix, "team-c"), "many.tar", archive, true)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		usages, err := service.QuotaUsages(quotas, prefix)
+		require.NoError(t, err)
+		require.Len(t, usages, 2)
+		assert.Equal(t, filepath.Join(prefix, "team-a"), usages[0].Path)
+		assert.Equal(t, int64(600), usages[0].Bytes)
+		assert.Equal(t, int64(3), usages[0].Inodes)
+		assert.Equal(t, int64(1000), usages[0].MaxBytes)
+	})
+}
+
+func TestUploadFileWithOptions_QuotaSyncToRoot(t *testing.T) {
+	prefix := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(prefix, "old.txt"), []byte(strings.Repeat("o", 10)), 0644))
+	quotas := []service.Quota{{Pattern: ".", MaxBytes: 50}}
+	archive := createTestTar(t, map[string]string{"data.bin": strings.Repeat("x", 110)}).Bytes()
+
+	for _, opts := range []service.UploadOptions{{Quotas: quotas}, {IsPutRequest: true, Sync: true, Quotas: quotas}} {
+		_, err := service.UploadFileWithOptions(bytes.NewReader(archive), "", "site.tar", prefix, opts)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded, "The staging directory must not count as removed, sync=%v", opts.Sync)
+	}
+	content, err := os.ReadFile(filepath.Join(prefix, "old.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("o", 10), string(content))
+}
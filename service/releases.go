@@ -0,0 +1,233 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	releasesDirName = "releases"
+	currentLinkName = "current"
+	releaseIDLayout = "20060102150405"
+)
+
+var (
+	ErrReleaseNotFound = errors.New("release not found")
+	ErrInvalidRelease  = errors.New("invalid release request")
+)
+
+type Release struct {
+	ID      string
+	Path    string
+	Current bool
+}
+
+func uploadRelease(parts []UploadPart, absTargetDir, pathPrefixEnv string, opts UploadOptions, deployed deployedCheck) ([]*UploadResult, error) {
+	releasesDir := filepath.Join(absTargetDir, releasesDirName)
+	stagingDir, err := createStagingDir(releasesDir, ".staging-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(stagingDir); err != nil {
+			_ = err
+		}
+	}()
+
+	results, relStagedPaths, err := stageParts(diskFS, parts, stagingDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if stored, err := alreadyDeployed(deployed, results); err != nil || stored != nil {
+		return stored, err
+	}
+	if excludedUpload(results) {
+		// An empty release would take the place of the current one.
+		for i, result := range results {
+			result.Path = filepath.Join(absTargetDir, currentLinkName, relStagedPaths[i])
+		}
+		return results, nil
+	}
+	// The staging directory becomes the release directory, so it is checked
+	// as the target of the upload.
+	if err := checkQuotas(diskFS, opts.Quotas, pathPrefixEnv, stagingDir, stagingDir, opts.replacedUsage(absTargetDir)); err != nil {
+		return nil, err
+	}
+
+	releaseID, err := renameToNewRelease(stagingDir, releasesDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := switchCurrentRelease(absTargetDir, releaseID); err != nil {
+		return nil, err
+	}
+
+	for i, result := range results {
+		result.Path = filepath.Join(releasesDir, releaseID, relStagedPaths[i])
+		result.ReleaseID = releaseID
+	}
+	return results, nil
+}
+
+// renameToNewRelease moves a staged directory to releases/<timestamp>, adding
+// a numeric suffix when several releases are created within the same second.
+func renameToNewRelease(stagingDir, releasesDir string) (string, error) {
+	baseID := time.Now().UTC().Format(releaseIDLayout)
+	for i := 0; i < 100; i++ {
+		releaseID := baseID
+		if i > 0 {
+			releaseID = fmt.Sprintf("%s-%02d", baseID, i)
+		}
+		releaseDir := filepath.Join(releasesDir, releaseID)
+		if _, err := os.Lstat(releaseDir); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to stat release directory '%s': %w", releaseDir, err)
+		}
+		if err := os.Rename(stagingDir, releaseDir); err != nil {
+			return "", fmt.Errorf("failed to move staged content into release '%s': %w", releaseDir, err)
+		}
+		return releaseID, nil
+	}
+	return "", fmt.Errorf("failed to allocate a release ID in '%s'", releasesDir)
+}
+
+// switchCurrentRelease atomically points <target>/current at releases/<id> by
+// renaming a freshly created symlink over the existing one.
+func switchCurrentRelease(absTargetDir, releaseID string) error {
+	currentLink := filepath.Join(absTargetDir, currentLinkName)
+	tmpLink := filepath.Join(absTargetDir, fmt.Sprintf(".%s.tmp-%d", currentLinkName, time.Now().UnixNano()))
+	if err := os.Symlink(filepath.Join(releasesDirName, releaseID), tmpLink); err != nil {
+		return fmt.Errorf("failed to create symlink for release '%s': %w", releaseID, err)
+	}
+	if err := os.Rename(tmpLink, currentLink); err != nil {
+		if rmErr := os.Remove(tmpLink); rmErr != nil {
+			_ = rmErr
+		}
+		return fmt.Errorf("failed to switch '%s' to release '%s': %w", currentLink, releaseID, err)
+	}
+	return nil
+}
+
+func currentReleaseID(absTargetDir string) (string, error) {
+	linkTarget, err := os.Readlink(filepath.Join(absTargetDir, currentLinkName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read current release link in '%s': %w", absTargetDir, err)
+	}
+	return filepath.Base(linkTarget), nil
+}
+
+func readReleases(absTargetDir string) ([]Release, error) {
+	releasesDir := filepath.Join(absTargetDir, releasesDirName)
+	dirEntries, err := os.ReadDir(releasesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read releases directory '%s': %w", releasesDir, err)
+	}
+	currentID, err := currentReleaseID(absTargetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []Release
+	for _, entry := range dirEntries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		releases = append(releases, Release{
+			ID:      entry.Name(),
+			Path:    filepath.Join(releasesDir, entry.Name()),
+			Current: entry.Name() == currentID,
+		})
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].ID < releases[j].ID })
+	return releases, nil
+}
+
+// ListReleases returns the releases of a target ordered from oldest to newest.
+func ListReleases(targetDirUserPath, pathPrefixEnv string) ([]Release, error) {
+	absTargetDir, err := resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv)
+	if err != nil {
+		return nil, err
+	}
+	return readReleases(absTargetDir)
+}
+
+// RollbackRelease points the current release of a target at releaseID. It
+// takes the target lock like an upload; only the lock settings of opts are
+// used.
+func RollbackRelease(targetDirUserPath, pathPrefixEnv, releaseID string, opts UploadOptions) (*Release, error) {
+	if releaseID == "" || releaseID != filepath.Base(releaseID) || strings.HasPrefix(releaseID, ".") {
+		return nil, fmt.Errorf("%w: release ID '%s' is not valid", ErrInvalidRelease, releaseID)
+	}
+	absTargetDir, err := resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockTarget(absTargetDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	releaseDir := filepath.Join(absTargetDir, releasesDirName, releaseID)
+	info, err := os.Stat(releaseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: '%s'", ErrReleaseNotFound, releaseID)
+		}
+		return nil, fmt.Errorf("failed to stat release directory '%s': %w", releaseDir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: '%s'", ErrReleaseNotFound, releaseID)
+	}
+
+	if err := switchCurrentRelease(absTargetDir, releaseID); err != nil {
+		return nil, err
+	}
+	return &Release{ID: releaseID, Path: releaseDir, Current: true}, nil
+}
+
+// PruneReleases removes all but the newest keep releases. The current release
+// is never removed, even when it is older than the releases being kept. Like
+// RollbackRelease, it takes the target lock with the lock settings of opts.
+func PruneReleases(targetDirUserPath, pathPrefixEnv string, keep int, opts UploadOptions) ([]string, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("%w: keep must be at least 1, got %d", ErrInvalidRelease, keep)
+	}
+	absTargetDir, err := resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockTarget(absTargetDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	releases, err := readReleases(absTargetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for i := 0; i < len(releases)-keep; i++ {
+		if releases[i].Current {
+			continue
+		}
+		if err := os.RemoveAll(releases[i].Path); err != nil {
+			return removed, fmt.Errorf("failed to remove release '%s': %w", releases[i].ID, err)
+		}
+		removed = append(removed, releases[i].ID)
+	}
+	return removed, nil
+}
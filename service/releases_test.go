@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_Release(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "app")
+
+	first, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "v1"}), targetDir, "site.tar", "", service.UploadOptions{Release: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.ReleaseID)
+	assert.Equal(t, filepath.Join(targetDir, "releases", first.ReleaseID), first.Path)
+
+	second, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "v2"}), targetDir, "site.tar", "", service.UploadOptions{Release: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ReleaseID, second.ReleaseID)
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "current", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(content))
+
+	releases, err := service.ListReleases(targetDir, "")
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, first.ReleaseID, releases[0].ID)
+	assert.False(t, releases[0].Current)
+	assert.Equal(t, second.ReleaseID, releases[1].ID)
+	assert.True(t, releases[1].Current)
+
+	t.Run("rollback to previous release", func(t *testing.T) {
+		release, err := service.RollbackRelease(targetDir, "", first.ReleaseID, service.UploadOptions{})
+		require.NoError(t, err)
+		assert.True(t, release.Current)
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "current", "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(content))
+	})
+
+	t.Run("rollback to unknown release", func(t *testing.T) {
+		_, err := service.RollbackRelease(targetDir, "", "19700101000000", service.UploadOptions{})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, service.ErrReleaseNotFound))
+	})
+
+	t.Run("rollback rejects traversal in release ID", func(t *testing.T) {
+		_, err := service.RollbackRelease(targetDir, "", "../"+first.ReleaseID, service.UploadOptions{})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, service.ErrInvalidRelease))
+	})
+
+	t.Run("prune keeps the current release", func(t *testing.T) {
+		removed, err := service.PruneReleases(targetDir, "", 1, service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, removed, "Older release is current and must be kept")
+
+		_, err = service.RollbackRelease(targetDir, "", second.ReleaseID, service.UploadOptions{})
+		require.NoError(t, err)
+		removed, err = service.PruneReleases(targetDir, "", 1, service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{first.ReleaseID}, removed)
+
+		releases, err := service.ListReleases(targetDir, "")
+		require.NoError(t, err)
+		require.Len(t, releases, 1)
+		assert.Equal(t, second.ReleaseID, releases[0].ID)
+	})
+
+	t.Run("prune rejects keep below one", func(t *testing.T) {
+		_, err := service.PruneReleases(targetDir, "", 0, service.UploadOptions{})
+		assert.True(t, errors.Is(err, service.ErrInvalidRelease))
+	})
+}
+
+func TestUploadFileWithOptions_ReleaseFailureLeavesCurrent(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "app")
+	first, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"index.html": "v1"}), targetDir, "site.tar", "", service.UploadOptions{Release: true})
+	require.NoError(t, err)
+
+	_, err = service.UploadFileWithOptions(createTestTar(t, map[string]string{"../evil.txt": "evil"}), targetDir, "site.tar", "", service.UploadOptions{Release: true})
+	require.Error(t, err)
+
+	releases, err := service.ListReleases(targetDir, "")
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, first.ReleaseID, releases[0].ID)
+	assert.True(t, releases[0].Current)
+}
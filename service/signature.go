@@ -0,0 +1,312 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// SSHSignatureNamespace is the namespace SSH signatures must be created with,
+// e.g. `ssh-keygen -Y sign -n deploytar -f key archive.tar.gz`.
+const SSHSignatureNamespace = "deploytar"
+
+// maxLegacyMinisignSize is the largest upload accepted with a legacy ("Ed")
+// minisign signature. Those sign the content itself, which ed25519 can only
+// verify as a whole in memory; larger uploads have to be prehashed.
+const maxLegacyMinisignSize = 1 << 20
+
+var (
+	ErrSignatureRequired = errors.New("upload signature required")
+	ErrInvalidSignature  = errors.New("invalid upload signature")
+)
+
+// TrustedKey is an ed25519 public key allowed to sign uploads.
+type TrustedKey struct {
+	// KeyID is the minisign key ID. It is empty for SSH keys.
+	KeyID     []byte
+	PublicKey ed25519.PublicKey
+}
+
+// ParseTrustedKeys parses one public key per line. Lines may hold a minisign
+// public key (the base64 line of a .pub file) or an OpenSSH "ssh-ed25519"
+// key. Empty lines, "#" comments and minisign "untrusted comment:" lines are
+// ignored.
+func ParseTrustedKeys(text string) ([]TrustedKey, error) {
+	var keys []TrustedKey
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		key, err := parseTrustedKey(line)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func parseTrustedKey(line string) (TrustedKey, error) {
+	if strings.HasPrefix(line, "ssh-ed25519 ") {
+		fields := strings.Fields(line)
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return TrustedKey{}, fmt.Errorf("invalid ssh-ed25519 key: %w", err)
+		}
+		publicKey, err := parseSSHEd25519PublicKey(blob)
+		if err != nil {
+			return TrustedKey{}, err
+		}
+		return TrustedKey{PublicKey: publicKey}, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return TrustedKey{}, fmt.Errorf("invalid minisign public key '%s'", line)
+	}
+	return TrustedKey{KeyID: raw[2:10], PublicKey: ed25519.PublicKey(raw[10:])}, nil
+}
+
+// spoolAndVerify copies the upload to a temporary file and verifies its
+// detached signature before anything is extracted. The returned file is
+// positioned at the start of the content; cleanup closes and removes it.
+func spoolAndVerify(inputStream io.Reader, signature string, keys []TrustedKey) (*os.File, func(), error) {
+	if signature == "" {
+		return nil, nil, ErrSignatureRequired
+	}
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("%w: no trusted signing keys are configured", ErrInvalidSignature)
+	}
+
+	spoolFile, err := os.CreateTemp("", "signed-upload-*.tmp")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file for signed upload: %w", err)
+	}
+	cleanup := func() {
+		if err := spoolFile.Close(); err != nil {
+			_ = err
+		}
+		if err := os.Remove(spoolFile.Name()); err != nil {
+			_ = err
+		}
+	}
+	if _, err := io.Copy(spoolFile, inputStream); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to spool signed upload: %w", err)
+	}
+
+	if strings.Contains(signature, "-----BEGIN SSH SIGNATURE-----") {
+		err = verifySSHSignature(spoolFile, signature, keys)
+	} else {
+		err = verifyMinisignSignature(spoolFile, signature, keys)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := spoolFile.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to rewind signed upload: %w", err)
+	}
+	return spoolFile, cleanup, nil
+}
+
+// verifyMinisignSignature checks a minisign signature, including the global
+// signature over its trusted comment. Both legacy ("Ed") and prehashed ("ED")
+// signatures are accepted, legacy ones only up to maxLegacyMinisignSize.
+func verifyMinisignSignature(content *os.File, signature string, keys []TrustedKey) error {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(signature))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("%w: malformed minisign signature", ErrInvalidSignature)
+	}
+	sigBlob, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sigBlob) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed minisign signature", ErrInvalidSignature)
+	}
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed minisign global signature", ErrInvalidSignature)
+	}
+
+	algorithm, keyID, sig := string(sigBlob[:2]), sigBlob[2:10], sigBlob[10:]
+	var key *TrustedKey
+	for i := range keys {
+		if bytes.Equal(keys[i].KeyID, keyID) {
+			key = &keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("%w: signed by an untrusted key", ErrInvalidSignature)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind signed upload: %w", err)
+	}
+	var message []byte
+	switch algorithm {
+	case "ED":
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, content); err != nil {
+			return fmt.Errorf("failed to hash signed upload: %w", err)
+		}
+		message = h.Sum(nil)
+	case "Ed":
+		message, err = io.ReadAll(io.LimitReader(content, maxLegacyMinisignSize+1))
+		if err != nil {
+			return fmt.Errorf("failed to read signed upload: %w", err)
+		}
+		if len(message) > maxLegacyMinisignSize {
+			return fmt.Errorf("%w: legacy minisign signatures are limited to %d bytes, sign with a prehashed signature (minisign -H) instead", ErrInvalidSignature, maxLegacyMinisignSize)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported minisign algorithm '%s'", ErrInvalidSignature, algorithm)
+	}
+
+	if !ed25519.Verify(key.PublicKey, message, sig) {
+		return fmt.Errorf("%w: signature does not match the uploaded content", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(key.PublicKey, append(append([]byte{}, sig...), trustedComment...), globalSig) {
+		return fmt.Errorf("%w: trusted comment signature does not match", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// verifySSHSignature checks an armored SSHSIG signature made with an
+// ssh-ed25519 key in the SSHSignatureNamespace namespace.
+func verifySSHSignature(content *os.File, signature string, keys []TrustedKey) error {
+	var armored strings.Builder
+	for _, line := range strings.Split(signature, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-----") {
+			continue
+		}
+		armored.WriteString(line)
+	}
+	blob, err := base64.StdEncoding.DecodeString(armored.String())
+	if err != nil || !bytes.HasPrefix(blob, []byte("SSHSIG")) {
+		return fmt.Errorf("%w: malformed SSH signature", ErrInvalidSignature)
+	}
+
+	r := sshReader{data: blob[6:]}
+	version := r.uint32()
+	publicKeyBlob := r.bytes()
+	namespace := r.bytes()
+	reserved := r.bytes()
+	hashAlgorithm := r.bytes()
+	signatureBlob := r.bytes()
+	if r.err != nil || version != 1 {
+		return fmt.Errorf("%w: malformed SSH signature", ErrInvalidSignature)
+	}
+	if string(namespace) != SSHSignatureNamespace {
+		return fmt.Errorf("%w: SSH signature namespace must be '%s'", ErrInvalidSignature, SSHSignatureNamespace)
+	}
+
+	publicKey, err := parseSSHEd25519PublicKey(publicKeyBlob)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	trusted := false
+	for _, key := range keys {
+		if key.KeyID == nil && key.PublicKey.Equal(publicKey) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("%w: signed by an untrusted key", ErrInvalidSignature)
+	}
+
+	sigReader := sshReader{data: signatureBlob}
+	sigFormat := sigReader.bytes()
+	sig := sigReader.bytes()
+	if sigReader.err != nil || string(sigFormat) != "ssh-ed25519" || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: unsupported SSH signature format", ErrInvalidSignature)
+	}
+
+	var h hash.Hash
+	switch string(hashAlgorithm) {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("%w: unsupported SSH signature hash '%s'", ErrInvalidSignature, hashAlgorithm)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind signed upload: %w", err)
+	}
+	if _, err := io.Copy(h, content); err != nil {
+		return fmt.Errorf("failed to hash signed upload: %w", err)
+	}
+
+	signedData := []byte("SSHSIG")
+	for _, field := range [][]byte{namespace, reserved, hashAlgorithm, h.Sum(nil)} {
+		signedData = binary.BigEndian.AppendUint32(signedData, uint32(len(field)))
+		signedData = append(signedData, field...)
+	}
+	if !ed25519.Verify(publicKey, signedData, sig) {
+		return fmt.Errorf("%w: signature does not match the uploaded content", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func parseSSHEd25519PublicKey(blob []byte) (ed25519.PublicKey, error) {
+	r := sshReader{data: blob}
+	keyType := r.bytes()
+	key := r.bytes()
+	if r.err != nil || string(keyType) != "ssh-ed25519" || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("only ssh-ed25519 keys are supported")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// sshReader decodes the length-prefixed fields of the SSH wire format.
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = errors.New("truncated SSH data")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *sshReader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < n {
+		r.err = errors.New("truncated SSH data")
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
@@ -0,0 +1,172 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+
+	"deploytar/service"
+)
+
+type minisignKey struct {
+	id      []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func newMinisignKey(t *testing.T) minisignKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 8)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	return minisignKey{id: id, private: private, public: public}
+}
+
+func (k minisignKey) publicKeyFile() string {
+	raw := append(append([]byte("Ed"), k.id...), k.public...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+func (k minisignKey) sign(t *testing.T, content []byte, prehashed bool) string {
+	t.Helper()
+	algorithm := "Ed"
+	message := content
+	if prehashed {
+		algorithm = "ED"
+		sum := blake2b.Sum512(content)
+		message = sum[:]
+	}
+	sig := ed25519.Sign(k.private, message)
+	trustedComment := "timestamp:1700000000\tfile:site.tar"
+	globalSig := ed25519.Sign(k.private, append(append([]byte{}, sig...), trustedComment...))
+	sigBlob := append(append([]byte(algorithm), k.id...), sig...)
+	return "untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(sigBlob) + "\n" +
+		"trusted comment: " + trustedComment + "\n" +
+		base64.StdEncoding.EncodeToString(globalSig) + "\n"
+}
+
+func sshString(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+func sshEd25519KeyBlob(public ed25519.PublicKey) []byte {
+	return append(sshString([]byte("ssh-ed25519")), sshString(public)...)
+}
+
+func sshSign(t *testing.T, private ed25519.PrivateKey, namespace string, content []byte) string {
+	t.Helper()
+	sum := sha512.Sum512(content)
+	signedData := []byte("SSHSIG")
+	for _, field := range [][]byte{[]byte(namespace), nil, []byte("sha512"), sum[:]} {
+		signedData = append(signedData, sshString(field)...)
+	}
+	sig := ed25519.Sign(private, signedData)
+
+	blob := []byte("SSHSIG")
+	blob = binary.BigEndian.AppendUint32(blob, 1)
+	blob = append(blob, sshString(sshEd25519KeyBlob(private.Public().(ed25519.PublicKey)))...)
+	blob = append(blob, sshString([]byte(namespace))...)
+	blob = append(blob, sshString(nil)...)
+	blob = append(blob, sshString([]byte("sha512"))...)
+	blob = append(blob, sshString(append(sshString([]byte("ssh-ed25519")), sshString(sig)...))...)
+	return "-----BEGIN SSH SIGNATURE-----\n" + base64.StdEncoding.EncodeToString(blob) + "\n-----END SSH SIGNATURE-----\n"
+}
+
+func TestParseTrustedKeys(t *testing.T) {
+	key := newMinisignKey(t)
+	sshPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshLine := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(sshEd25519KeyBlob(sshPublic)) + " ci@example"
+
+	keys, err := service.ParseTrustedKeys(key.publicKeyFile() + "\n# release pipeline\n" + sshLine)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, key.id, keys[0].KeyID)
+	assert.True(t, keys[1].PublicKey.Equal(sshPublic))
+
+	_, err = service.ParseTrustedKeys("not-a-key")
+	assert.Error(t, err)
+}
+
+func TestUploadFileWithOptions_Signature(t *testing.T) {
+	content := createTestTar(t, map[string]string{"index.html": "signed"}).Bytes()
+	key := newMinisignKey(t)
+	trusted, err := service.ParseTrustedKeys(key.publicKeyFile())
+	require.NoError(t, err)
+
+	_, sshPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshTrusted, err := service.ParseTrustedKeys("ssh-ed25519 " + base64.StdEncoding.EncodeToString(sshEd25519KeyBlob(sshPrivate.Public().(ed25519.PublicKey))))
+	require.NoError(t, err)
+
+	accepted := []struct {
+		name      string
+		signature string
+		keys      []service.TrustedKey
+	}{
+		{"prehashed minisign", key.sign(t, content, true), trusted},
+		{"legacy minisign", key.sign(t, content, false), trusted},
+		{"ssh signature", sshSign(t, sshPrivate, service.SSHSignatureNamespace, content), sshTrusted},
+	}
+	for _, tt := range accepted {
+		t.Run("accept "+tt.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			_, err := service.UploadFileWithOptions(bytes.NewReader(content), targetDir, "site.tar", "", service.UploadOptions{
+				Signature:   tt.signature,
+				TrustedKeys: tt.keys,
+			})
+			require.NoError(t, err)
+			extracted, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+			require.NoError(t, err)
+			assert.Equal(t, "signed", string(extracted))
+		})
+	}
+
+	tampered := append([]byte{}, content...)
+	copy(tampered[512:], "tampered")
+	otherKey := newMinisignKey(t)
+	forgedComment := strings.Replace(key.sign(t, content, true), "file:site.tar", "file:other.tar", 1)
+	large := createTestTar(t, map[string]string{"bundle.js": strings.Repeat("x", 1<<20)}).Bytes()
+
+	rejected := []struct {
+		name        string
+		content     []byte
+		signature   string
+		keys        []service.TrustedKey
+		expectedErr error
+	}{
+		{"missing signature", content, "", trusted, service.ErrSignatureRequired},
+		{"tampered content", tampered, key.sign(t, content, true), trusted, service.ErrInvalidSignature},
+		{"untrusted key", content, otherKey.sign(t, content, true), trusted, service.ErrInvalidSignature},
+		{"forged trusted comment", content, forgedComment, trusted, service.ErrInvalidSignature},
+		{"signature without configured keys", content, key.sign(t, content, true), nil, service.ErrInvalidSignature},
+		{"ssh signature in another namespace", content, sshSign(t, sshPrivate, "file", content), sshTrusted, service.ErrInvalidSignature},
+		{"large upload with a legacy minisign signature", large, key.sign(t, large, false), trusted, service.ErrInvalidSignature},
+	}
+	for _, tt := range rejected {
+		t.Run("reject "+tt.name, func(t *testing.T) {
+			targetDir := filepath.Join(t.TempDir(), "target")
+			_, err := service.UploadFileWithOptions(bytes.NewReader(tt.content), targetDir, "site.tar", "", service.UploadOptions{
+				Signature:   tt.signature,
+				TrustedKeys: tt.keys,
+			})
+			require.ErrorIs(t, err, tt.expectedErr)
+			_, statErr := os.Stat(targetDir)
+			assert.True(t, os.IsNotExist(statErr), "nothing should be extracted")
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stageFS is the file system an upload is staged in. Paths are absolute and
+// behave like their counterparts in the os package. Uploads are staged on
+// disk with diskFS; dry runs are staged in a memFS, which keeps the digests
+// of the staged files instead of their content.
+type stageFS interface {
+	MkdirAll(name string, perm os.FileMode) error
+	// Create creates or truncates the file name for writing.
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	Remove(name string) error
+	Lstat(name string) (fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Symlink(oldname, newname string) error
+	Link(oldname, newname string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	WalkDir(root string, fn fs.WalkDirFunc) error
+	Glob(pattern string) ([]string, error)
+}
+
+type osFS struct{}
+
+// diskFS stages uploads on disk.
+var diskFS stageFS = osFS{}
+
+func (osFS) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (osFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, perm)
+}
+func (osFS) Remove(name string) error                          { return os.Remove(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)            { return os.Lstat(name) }
+func (osFS) Readlink(name string) (string, error)              { return os.Readlink(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error)        { return os.ReadDir(name) }
+func (osFS) Symlink(oldname, newname string) error             { return os.Symlink(oldname, newname) }
+func (osFS) Link(oldname, newname string) error                { return os.Link(oldname, newname) }
+func (osFS) Chmod(name string, mode os.FileMode) error         { return os.Chmod(name, mode) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error { return os.Chtimes(name, atime, mtime) }
+func (osFS) WalkDir(root string, fn fs.WalkDirFunc) error      { return filepath.WalkDir(root, fn) }
+func (osFS) Glob(pattern string) ([]string, error)             { return filepath.Glob(pattern) }
+
+// memFS is an in-memory stageFS rooted at root. Nothing outside root exists.
+// Files keep their size and SHA-256 rather than their content.
+type memFS struct {
+	root string
+	node *memNode
+}
+
+type memNode struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	size     int64
+	sha256   string
+	target   string
+	children map[string]*memNode
+}
+
+func newMemFS(root string) *memFS {
+	return &memFS{root: root, node: &memNode{name: filepath.Base(root), mode: fs.ModeDir | 0755, modTime: time.Now(), children: make(map[string]*memNode)}}
+}
+
+// components returns the path components of name below the root.
+func (m *memFS) components(op, name string) ([]string, error) {
+	rel, err := filepath.Rel(m.root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if rel == "." {
+		return nil, nil
+	}
+	return strings.Split(rel, string(filepath.Separator)), nil
+}
+
+// lookup returns the parent directory of name and its entry, which is nil
+// when it does not exist. Symlinks are followed in the parent directories,
+// and in the entry itself when followLast is set.
+func (m *memFS) lookup(op, name string, followLast bool) (parent, node *memNode, err error) {
+	components, err := m.components(op, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(components) == 0 {
+		return nil, m.node, nil
+	}
+	var dirs []*memNode
+	current := m.node
+	hops := 0
+	for len(components) > 0 {
+		component := components[0]
+		components = components[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 0 {
+				current, dirs = dirs[len(dirs)-1], dirs[:len(dirs)-1]
+			}
+			continue
+		}
+		if !current.mode.IsDir() {
+			return nil, nil, &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		next := current.children[component]
+		if next == nil {
+			if len(components) > 0 {
+				return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			return current, nil, nil
+		}
+		if next.mode&fs.ModeSymlink != 0 && (len(components) > 0 || followLast) {
+			if hops++; hops > maxLinkHops {
+				return nil, nil, &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+			}
+			if filepath.IsAbs(next.target) {
+				return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			components = append(strings.Split(next.target, string(filepath.Separator)), components...)
+			continue
+		}
+		if len(components) == 0 {
+			return current, next, nil
+		}
+		dirs = append(dirs, current)
+		current = next
+	}
+	if len(dirs) == 0 {
+		return nil, current, nil
+	}
+	return dirs[len(dirs)-1], current, nil
+}
+
+func (m *memFS) existing(op, name string, followLast bool) (*memNode, error) {
+	_, node, err := m.lookup(op, name, followLast)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return node, nil
+}
+
+// add creates the entry name, which must not exist yet, in its existing
+// parent directory.
+func (m *memFS) add(op, name string, node *memNode) error {
+	parent, existing, err := m.lookup(op, name, false)
+	if err != nil {
+		return err
+	}
+	if existing != nil || parent == nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	node.name = filepath.Base(name)
+	parent.children[node.name] = node
+	return nil
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	components, err := m.components("mkdir", name)
+	if err != nil {
+		return err
+	}
+	dir := m.root
+	for _, component := range components {
+		dir = filepath.Join(dir, component)
+		node, err := m.existing("mkdir", dir, true)
+		if err == nil {
+			if !node.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := m.add("mkdir", dir, &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now(), children: make(map[string]*memNode)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	node, err := m.existing("open", name, true)
+	if os.IsNotExist(err) {
+		node = &memNode{mode: perm.Perm()}
+		err = m.add("open", name, node)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	node.size, node.modTime = 0, time.Now()
+	return &memFile{node: node, h: sha256.New()}, nil
+}
+
+// memFile hashes what is written to a memFS file.
+type memFile struct {
+	node *memNode
+	h    hash.Hash
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.node.size += int64(len(p))
+	return f.h.Write(p)
+}
+
+func (f *memFile) Close() error {
+	f.node.sha256 = hex.EncodeToString(f.h.Sum(nil))
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	parent, node, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if node == nil || parent == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(node.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(parent.children, node.name)
+	return nil
+}
+
+func (m *memFS) Lstat(name string) (fs.FileInfo, error) {
+	node, err := m.existing("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{node}, nil
+}
+
+func (m *memFS) Readlink(name string) (string, error) {
+	node, err := m.existing("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return node.target, nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := m.existing("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	entries := make([]fs.DirEntry, 0, len(node.children))
+	for _, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{child}))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *memFS) Symlink(oldname, newname string) error {
+	return m.add("symlink", newname, &memNode{mode: fs.ModeSymlink | 0777, modTime: time.Now(), size: int64(len(oldname)), target: oldname})
+}
+
+func (m *memFS) Link(oldname, newname string) error {
+	source, err := m.existing("link", oldname, false)
+	if err != nil {
+		return err
+	}
+	if source.mode.IsDir() {
+		return &fs.PathError{Op: "link", Path: oldname, Err: syscall.EPERM}
+	}
+	// The copy shares the digest of the source, which no longer changes once
+	// it has been written.
+	link := *source
+	return m.add("link", newname, &link)
+}
+
+func (m *memFS) Chmod(name string, mode os.FileMode) error {
+	node, err := m.existing("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode.Type() | mode.Perm() | mode&specialModeBits
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, _, mtime time.Time) error {
+	node, err := m.existing("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		node.modTime = mtime
+	}
+	return nil
+}
+
+func (m *memFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := m.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = m.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (m *memFS) walkDir(p string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(p, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := m.ReadDir(p)
+	if err != nil {
+		if err = fn(p, d, err); err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := m.walkDir(filepath.Join(p, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Glob matches pattern like filepath.Glob, one component at a time.
+func (m *memFS) Glob(pattern string) ([]string, error) {
+	components, err := m.components("glob", pattern)
+	if err != nil {
+		return nil, nil
+	}
+	matches := []string{m.root}
+	for _, component := range components {
+		if _, err := path.Match(component, ""); err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, dir := range matches {
+			entries, err := m.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if ok, _ := path.Match(component, entry.Name()); ok {
+					next = append(next, filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+// digests returns the size and SHA-256 of every file below dir, keyed by
+// slash separated relative path, like digestTree does for a directory on
+// disk.
+func (m *memFS) digests(dir string) (map[string]fileDigest, error) {
+	digests := make(map[string]fileDigest)
+	err := m.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		node, err := m.existing("lstat", p, false)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		digest := fileDigest{size: node.size, sha256: node.sha256}
+		if node.mode&fs.ModeSymlink != 0 {
+			sum := sha256.Sum256([]byte(node.target))
+			digest.sha256 = hex.EncodeToString(sum[:])
+		}
+		digests[filepath.ToSlash(rel)] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", dir, err)
+	}
+	return digests, nil
+}
+
+type memFileInfo struct {
+	node *memNode
+}
+
+func (i memFileInfo) Name() string       { return i.node.name }
+func (i memFileInfo) Size() int64        { return i.node.size }
+func (i memFileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memFileInfo) ModTime() time.Time { return i.node.modTime }
+func (i memFileInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrProtectedEntry = errors.New("sync would replace a protected entry")
+
+// syncRemovals returns the entries of targetDir, relative to it, that a sync
+// upload of stagingDir, staged in fsys, deletes: those missing from the staged
+// tree, except for the ones matching a protect pattern. Directories that end up
+// empty are returned in place of their content. It fails with
+// ErrProtectedEntry when the merge itself would delete a protected entry.
+func syncRemovals(fsys stageFS, stagingDir, targetDir string, protect []string) ([]string, error) {
+	if len(protect) > 0 {
+		if err := checkProtectedReplacements(fsys, stagingDir, targetDir, "", protect); err != nil {
+			return nil, err
+		}
+	}
+	removals, _, err := collectSyncRemovals(fsys, stagingDir, targetDir, "", "", protect)
+	return removals, err
+}
+
+// checkProtectedReplacements walks the rel subdirectory of stagingDir for
+// staged entries that replace an entry of targetDir of another type, which
+// mergeDirectory removes first: a file replacing a directory or a directory
+// replacing a file. Such a replacement fails when the removed entry matches a
+// protect pattern or holds an entry that does.
+func checkProtectedReplacements(fsys stageFS, stagingDir, targetDir, rel string, protect []string) error {
+	stagedDir := filepath.Join(stagingDir, filepath.FromSlash(rel))
+	entries, err := fsys.ReadDir(stagedDir)
+	if err != nil {
+		return fmt.Errorf("failed to read staging directory '%s': %w", stagedDir, err)
+	}
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+		existing := filepath.Join(targetDir, filepath.FromSlash(entryRel))
+		info, err := os.Lstat(existing)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to stat '%s': %w", existing, err)
+		}
+		if entry.IsDir() && info.IsDir() {
+			if err := checkProtectedReplacements(fsys, stagingDir, targetDir, entryRel, protect); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.IsDir() == info.IsDir() {
+			// Files are overwritten, which sync allows for protected ones.
+			continue
+		}
+		protected, err := findProtectedEntry(existing, entryRel, protect)
+		if err != nil {
+			return err
+		}
+		if protected != "" {
+			return fmt.Errorf("%w: replacing '%s' would delete protected '%s'", ErrProtectedEntry, entryRel, protected)
+		}
+	}
+	return nil
+}
+
+// findProtectedEntry returns the first entry at or below p, named rel relative
+// to the target, that matches a protect pattern, or "" when there is none.
+func findProtectedEntry(p, rel string, protect []string) (string, error) {
+	var protected string
+	err := filepath.WalkDir(p, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walkRel, err := filepath.Rel(p, walkPath)
+		if err != nil {
+			return err
+		}
+		if name := path.Join(rel, filepath.ToSlash(walkRel)); matchesAnyPattern(protect, name) {
+			protected = name
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", p, err)
+	}
+	return protected, nil
+}
+
+// collectSyncRemovals walks the rel subdirectory of targetDir. Protect
+// patterns are matched against the entry names joined to base. The returned
+// flag reports whether every entry of the directory is removed.
+func collectSyncRemovals(fsys stageFS, stagingDir, targetDir, base, rel string, protect []string) ([]string, bool, error) {
+	entries, err := os.ReadDir(filepath.Join(targetDir, filepath.FromSlash(rel)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, true, nil
+		}
+		return nil, false, fmt.Errorf("failed to read directory '%s': %w", filepath.Join(targetDir, rel), err)
+	}
+
+	var removals []string
+	removesAll := true
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+		// The staging directories of uploads to the PATH_PREFIX root are not
+		// part of the target.
+		if strings.HasPrefix(entry.Name(), rootStagingPrefix) {
+			removesAll = false
+			continue
+		}
+		if matchesAnyPattern(protect, path.Join(base, entryRel)) {
+			removesAll = false
+			continue
+		}
+
+		stagedInfo, err := fsys.Lstat(filepath.Join(stagingDir, filepath.FromSlash(entryRel)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, false, fmt.Errorf("failed to stat '%s': %w", filepath.Join(stagingDir, entryRel), err)
+		}
+		if err == nil {
+			// Staged entries replace existing ones, except that directories
+			// on both sides are merged.
+			removesAll = false
+			if stagedInfo.IsDir() && entry.IsDir() {
+				subRemovals, _, err := collectSyncRemovals(fsys, stagingDir, targetDir, base, entryRel, protect)
+				if err != nil {
+					return nil, false, err
+				}
+				removals = append(removals, subRemovals...)
+			}
+			continue
+		}
+
+		if entry.IsDir() {
+			subRemovals, subRemovesAll, err := collectSyncRemovals(fsys, stagingDir, targetDir, base, entryRel, protect)
+			if err != nil {
+				return nil, false, err
+			}
+			if subRemovesAll {
+				removals = append(removals, entryRel)
+			} else {
+				removesAll = false
+				removals = append(removals, subRemovals...)
+			}
+			continue
+		}
+		removals = append(removals, entryRel)
+	}
+	return removals, removesAll, nil
+}
+
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeEntries deletes the entries of targetDir returned by syncRemovals or
+// whiteoutRemovals.
+func removeEntries(targetDir string, removals []string) error {
+	for _, rel := range removals {
+		if err := os.RemoveAll(filepath.Join(targetDir, filepath.FromSlash(rel))); err != nil {
+			return fmt.Errorf("failed to remove '%s': %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// replacedBySync returns the quota accounting for a sync upload to targetDir:
+// the usage replaced by the merge plus the usage of the entries it deletes.
+func replacedBySync(targetDir string, protect []string) func(fsys stageFS, stagedDir, dir string) (diskUsage, error) {
+	return func(fsys stageFS, stagedDir, dir string) (diskUsage, error) {
+		usage, err := replacedByMerge(fsys, stagedDir, dir)
+		if err != nil {
+			return usage, err
+		}
+		base, err := filepath.Rel(targetDir, dir)
+		if err != nil {
+			return usage, fmt.Errorf("internal error resolving '%s': %w", dir, err)
+		}
+		if base == "." {
+			base = ""
+		}
+		removals, _, err := collectSyncRemovals(fsys, stagedDir, dir, filepath.ToSlash(base), "", protect)
+		if err != nil {
+			return usage, err
+		}
+		for _, rel := range removals {
+			removed, err := measureUsage(diskFS, filepath.Join(dir, filepath.FromSlash(rel)), "")
+			if err != nil {
+				return usage, err
+			}
+			usage.bytes += removed.bytes
+			usage.inodes += removed.inodes
+		}
+		return usage, nil
+	}
+}
@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_Sync(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "site")
+	existing := map[string]string{
+		"index.html":           "old home",
+		"stale.html":           "stale",
+		"old/deep/page.html":   "stale",
+		"uploads/avatar.png":   "user content",
+		"assets/app.js":        "old app",
+		"assets/stale.js":      "stale",
+		"assets/cache/data.db": "kept",
+	}
+	for name, content := range existing {
+		path := filepath.Join(targetDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	archive := createTestTar(t, map[string]string{
+		"index.html":    "new home",
+		"assets/app.js": "new app",
+		"about.html":    "about",
+	})
+	opts := service.UploadOptions{Sync: true, IsPutRequest: true, Protect: []string{"/uploads", "*.db"}}
+	_, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", "", opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"about.html",
+		"assets/app.js",
+		"assets/cache/data.db",
+		"index.html",
+		"uploads/avatar.png",
+	}, listFiles(t, targetDir))
+	content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "new home", string(content))
+	_, err = os.Stat(filepath.Join(targetDir, "old"))
+	assert.True(t, os.IsNotExist(err), "Directories left empty should be removed")
+
+	entries, err := os.ReadDir(filepath.Dir(targetDir))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "The staging directory should be cleaned up")
+}
+
+func TestUploadFileWithOptions_SyncProtectedReplacement(t *testing.T) {
+	targetDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(targetDir, "media", "uploads"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "media", "uploads", "avatar.png"), []byte("user content"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(targetDir, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "docs", "old.html"), []byte("stale"), 0644))
+	opts := service.UploadOptions{Sync: true, Protect: []string{"uploads"}}
+
+	_, err := service.UploadFileWithOptions(createTestTar(t, map[string]string{"media": "now a file"}), targetDir, "site.tar", "", opts)
+	require.ErrorIs(t, err, service.ErrProtectedEntry)
+	content, err := os.ReadFile(filepath.Join(targetDir, "media", "uploads", "avatar.png"))
+	require.NoError(t, err, "Protected entries should survive a file replacing their directory")
+	assert.Equal(t, "user content", string(content))
+
+	dryRun := opts
+	dryRun.DryRun = true
+	_, err = service.UploadFileWithOptions(createTestTar(t, map[string]string{"media": "now a file"}), targetDir, "site.tar", "", dryRun)
+	assert.ErrorIs(t, err, service.ErrProtectedEntry, "Dry runs should report the conflict")
+
+	_, err = service.UploadFileWithOptions(createTestTar(t, map[string]string{"docs": "now a file", "media/uploads/avatar.png": "overwritten"}), targetDir, "site.tar", "", opts)
+	require.NoError(t, err, "Unprotected directories and protected files may be replaced")
+	assert.Equal(t, []string{"docs", "media/uploads/avatar.png"}, listFiles(t, targetDir))
+}
+
+func TestUploadFileWithOptions_SyncQuota(t *testing.T) {
+	prefix := t.TempDir()
+	targetDir := filepath.Join(prefix, "site")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "stale.bin"), []byte(strings.Repeat("x", 600)), 0644))
+	quotas := []service.Quota{{Pattern: "*", MaxBytes: 1000}}
+
+	archive := createTestTar(t, map[string]string{"new.bin": strings.Repeat("y", 600)})
+	_, err := service.UploadFileWithOptions(archive, targetDir, "site.tar", prefix, service.UploadOptions{Sync: true, Quotas: quotas})
+	require.NoError(t, err, "Deleted files should not count against the quota")
+
+	archive = createTestTar(t, map[string]string{"more.bin": strings.Repeat("z", 600)})
+	_, err = service.UploadFileWithOptions(archive, targetDir, "site.tar", prefix, service.UploadOptions{Sync: true, Quotas: quotas, Protect: []string{"new.bin"}})
+	assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadSessionTTL is how long an unfinished upload session is kept after its
+// last write.
+const uploadSessionTTL = 24 * time.Hour
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadOffsetMismatch  = errors.New("upload offset mismatch")
+	ErrUploadIncomplete      = errors.New("upload session is incomplete")
+	ErrUploadTooLarge        = errors.New("upload exceeds the declared length")
+	ErrInvalidUploadSession  = errors.New("invalid upload session request")
+)
+
+// sessionLocks serializes writes to a session within the process.
+var sessionLocks sync.Map
+
+// UploadSession is a resumable upload whose content is assembled on disk
+// before being handed to UploadFileWithOptions.
+type UploadSession struct {
+	ID       string `json:"id"`
+	Path     string `json:"path"`
+	FileName string `json:"file_name"`
+	// Length is the declared total size, or -1 when it is not known up front.
+	Length  int64         `json:"length"`
+	Offset  int64         `json:"-"`
+	Options UploadOptions `json:"options"`
+	// LockTimeout is Options.LockTimeout, which UploadOptions does not
+	// serialize.
+	LockTimeout time.Duration `json:"lock_timeout,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// UploadSessionStore keeps upload sessions in a directory, one metadata file
+// and one data file per session.
+type UploadSessionStore struct {
+	dir string
+}
+
+func NewUploadSessionStore(dir string) *UploadSessionStore {
+	return &UploadSessionStore{dir: dir}
+}
+
+func (s *UploadSessionStore) metadataPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *UploadSessionStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+func lockSession(id string) func() {
+	mu, _ := sessionLocks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// Create starts a new session. The target path is validated immediately so
+// that clients do not upload gigabytes to a destination that will be refused.
+func (s *UploadSessionStore) Create(targetDirUserPath, fileName, pathPrefixEnv string, length int64, opts UploadOptions) (*UploadSession, error) {
+	if fileName == "" {
+		return nil, fmt.Errorf("%w: file name is required", ErrInvalidUploadSession)
+	}
+	if length < -1 {
+		return nil, fmt.Errorf("%w: length must not be negative", ErrInvalidUploadSession)
+	}
+	if maxBytes := opts.limits().MaxUploadBytes; maxBytes > 0 && length > maxBytes {
+		return nil, fmt.Errorf("%w: upload is %d bytes, the maximum is %d", ErrLimitExceeded, length, maxBytes)
+	}
+	if err := validateChecksums(opts.SHA256, opts.SHA512); err != nil {
+		return nil, err
+	}
+	if _, err := resolveUploadTargetDir(targetDirUserPath, pathPrefixEnv); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload session directory '%s': %w", s.dir, err)
+	}
+	s.expireSessions()
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate upload session ID: %w", err)
+	}
+	session := &UploadSession{
+		ID:          hex.EncodeToString(idBytes),
+		Path:        targetDirUserPath,
+		FileName:    fileName,
+		Length:      length,
+		Options:     opts,
+		LockTimeout: opts.LockTimeout,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	dataFile, err := os.OpenFile(s.dataPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload session data file: %w", err)
+	}
+	if err := dataFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create upload session data file: %w", err)
+	}
+	metadata, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upload session: %w", err)
+	}
+	if err := os.WriteFile(s.metadataPath(session.ID), metadata, 0600); err != nil {
+		if rmErr := os.Remove(s.dataPath(session.ID)); rmErr != nil {
+			_ = rmErr
+		}
+		return nil, fmt.Errorf("failed to write upload session metadata: %w", err)
+	}
+	return session, nil
+}
+
+// Get returns a session with its current offset.
+func (s *UploadSessionStore) Get(id string) (*UploadSession, error) {
+	if decoded, err := hex.DecodeString(id); err != nil || len(decoded) != 16 {
+		return nil, fmt.Errorf("%w: '%s'", ErrUploadSessionNotFound, id)
+	}
+	metadata, err := os.ReadFile(s.metadataPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: '%s'", ErrUploadSessionNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to read upload session '%s': %w", id, err)
+	}
+	var session UploadSession
+	if err := json.Unmarshal(metadata, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session '%s': %w", id, err)
+	}
+	info, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: '%s'", ErrUploadSessionNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to stat upload session '%s': %w", id, err)
+	}
+	session.Offset = info.Size()
+	return &session, nil
+}
+
+// Append writes r to the session at offset, which must match the number of
+// bytes already received. Bytes written before r fails are kept, so the
+// client can resume from the returned offset. maxBytes bounds the size of
+// the whole upload unless it is zero, which matters for sessions whose
+// length is not known up front.
+func (s *UploadSessionStore) Append(id string, offset int64, r io.Reader, maxBytes int64) (int64, error) {
+	unlock := lockSession(id)
+	defer unlock()
+
+	session, err := s.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != session.Offset {
+		return session.Offset, fmt.Errorf("%w: expected offset %d, got %d", ErrUploadOffsetMismatch, session.Offset, offset)
+	}
+
+	dataFile, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return session.Offset, fmt.Errorf("failed to open upload session '%s': %w", id, err)
+	}
+	defer func() {
+		if err := dataFile.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	// The copy stops at the declared length or at maxBytes, whichever comes
+	// first, and a byte beyond it fails the append.
+	limit, tooLarge := int64(-1), error(nil)
+	if session.Length >= 0 {
+		limit, tooLarge = session.Length, fmt.Errorf("%w: declared %d bytes", ErrUploadTooLarge, session.Length)
+	}
+	if maxBytes > 0 && (limit < 0 || maxBytes < limit) {
+		limit, tooLarge = maxBytes, fmt.Errorf("%w: upload is larger than %d bytes", ErrLimitExceeded, maxBytes)
+	}
+	source := r
+	if limit >= 0 {
+		source = io.LimitReader(r, max(limit-session.Offset, 0))
+	}
+	written, copyErr := io.Copy(dataFile, source)
+	newOffset := session.Offset + written
+	if syncErr := dataFile.Sync(); syncErr != nil && copyErr == nil {
+		copyErr = syncErr
+	}
+	if copyErr != nil {
+		return newOffset, fmt.Errorf("failed to write to upload session '%s': %w", id, copyErr)
+	}
+	if limit >= 0 && newOffset >= limit {
+		if n, _ := r.Read(make([]byte, 1)); n > 0 {
+			return newOffset, tooLarge
+		}
+	}
+	return newOffset, nil
+}
+
+// Finalize hands the assembled upload to idempotency, like a direct upload
+// with key, and removes the session once it has been committed. serverOpts
+// supplies the server-side settings that are not stored with the session.
+func (s *UploadSessionStore) Finalize(id, pathPrefixEnv string, serverOpts UploadOptions, idempotency *IdempotencyStore, key string) (*UploadResult, error) {
+	unlock := lockSession(id)
+	defer unlock()
+
+	session, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Length >= 0 && session.Offset != session.Length {
+		return nil, fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, session.Offset, session.Length)
+	}
+
+	dataFile, err := os.Open(s.dataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload session '%s': %w", id, err)
+	}
+	defer func() {
+		if err := dataFile.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	opts := session.Options
+	opts.LockTimeout = session.LockTimeout
+	opts.ModePolicy = serverOpts.ModePolicy
+	opts.TrustedKeys = serverOpts.TrustedKeys
+	opts.Limits = serverOpts.Limits
+	opts.Quotas = serverOpts.Quotas
+	opts.DefaultExclude = serverOpts.DefaultExclude
+	opts.Protect = serverOpts.Protect
+	opts.LockDir = serverOpts.LockDir
+	result, err := idempotency.UploadFile(key, dataFile, session.Path, session.FileName, pathPrefixEnv, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.remove(id)
+	return result, nil
+}
+
+// Delete discards a session and the data received so far.
+func (s *UploadSessionStore) Delete(id string) error {
+	unlock := lockSession(id)
+	defer unlock()
+
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+func (s *UploadSessionStore) remove(id string) {
+	for _, path := range []string{s.metadataPath(id), s.dataPath(id)} {
+		if err := os.Remove(path); err != nil {
+			_ = err
+		}
+	}
+	sessionLocks.Delete(id)
+}
+
+// expireSessions removes sessions that have not been written to within
+// uploadSessionTTL.
+func (s *UploadSessionStore) expireSessions() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".part")
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < uploadSessionTTL {
+			continue
+		}
+		unlock := lockSession(id)
+		s.remove(id)
+		unlock()
+	}
+}
@@ -0,0 +1,152 @@
+package service_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadSessionStore(t *testing.T) {
+	tarBytes := createTestTar(t, map[string]string{"index.html": "resumed"}).Bytes()
+	length := int64(len(tarBytes))
+	half := length / 2
+
+	t.Run("resume after interruption and finalize", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+
+		session, err := store.Create(targetDir, "site.tar", "", length, service.UploadOptions{IsPutRequest: true})
+		require.NoError(t, err)
+		assert.Len(t, session.ID, 32)
+
+		offset, err := store.Append(session.ID, 0, bytes.NewReader(tarBytes[:half]), 0)
+		require.NoError(t, err)
+		assert.Equal(t, half, offset)
+
+		_, err = store.Finalize(session.ID, "", service.UploadOptions{}, service.NewIdempotencyStore(t.TempDir()), "")
+		assert.ErrorIs(t, err, service.ErrUploadIncomplete)
+
+		_, err = store.Append(session.ID, 0, bytes.NewReader(tarBytes), 0)
+		assert.ErrorIs(t, err, service.ErrUploadOffsetMismatch)
+
+		reloaded, err := store.Get(session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, half, reloaded.Offset)
+
+		offset, err = store.Append(session.ID, reloaded.Offset, bytes.NewReader(tarBytes[half:]), 0)
+		require.NoError(t, err)
+		assert.Equal(t, length, offset)
+
+		result, err := store.Finalize(session.ID, "", service.UploadOptions{}, service.NewIdempotencyStore(t.TempDir()), "")
+		require.NoError(t, err)
+		assert.Equal(t, service.FormatTar, result.Format)
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "resumed", string(content))
+
+		_, err = store.Get(session.ID)
+		assert.ErrorIs(t, err, service.ErrUploadSessionNotFound, "Finalized sessions should be removed")
+	})
+
+	t.Run("skip content already deployed", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		idempotency := service.NewIdempotencyStore(t.TempDir())
+		targetDir := filepath.Join(t.TempDir(), "site")
+		opts := service.UploadOptions{IsPutRequest: true}
+		first, err := idempotency.UploadFile("", bytes.NewReader(tarBytes), targetDir, "site.tar", "", opts)
+		require.NoError(t, err)
+		info, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+
+		session, err := store.Create(targetDir, "site.tar", "", length, opts)
+		require.NoError(t, err)
+		_, err = store.Append(session.ID, 0, bytes.NewReader(tarBytes), 0)
+		require.NoError(t, err)
+		second, err := store.Finalize(session.ID, "", service.UploadOptions{}, idempotency, "")
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		after, err := os.Stat(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(info, after), "The target should not be touched")
+	})
+
+	t.Run("keep the lock timeout", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		session, err := store.Create(t.TempDir(), "site.tar", "", 4, service.UploadOptions{LockTimeout: time.Minute})
+		require.NoError(t, err)
+
+		stored, err := store.Get(session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, stored.LockTimeout)
+	})
+
+	t.Run("reject data beyond the declared length", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		session, err := store.Create(t.TempDir(), "site.tar", "", 4, service.UploadOptions{})
+		require.NoError(t, err)
+
+		offset, err := store.Append(session.ID, 0, bytes.NewReader([]byte("too long")), 0)
+		assert.ErrorIs(t, err, service.ErrUploadTooLarge)
+		assert.Equal(t, int64(4), offset)
+	})
+
+	t.Run("enforce the upload limit while appending", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		limits := &service.Limits{MaxUploadBytes: 8}
+		_, err := store.Create(t.TempDir(), "notes.txt", "", 9, service.UploadOptions{Limits: limits})
+		assert.ErrorIs(t, err, service.ErrLimitExceeded, "Declared lengths over the limit should be rejected")
+
+		session, err := store.Create(t.TempDir(), "notes.txt", "", -1, service.UploadOptions{Limits: limits})
+		require.NoError(t, err)
+		offset, err := store.Append(session.ID, 0, bytes.NewReader([]byte("hello ")), 8)
+		require.NoError(t, err)
+		offset, err = store.Append(session.ID, offset, bytes.NewReader([]byte("world")), 8)
+		assert.ErrorIs(t, err, service.ErrLimitExceeded)
+		assert.Equal(t, int64(8), offset, "Nothing beyond the limit should be written")
+	})
+
+	t.Run("unknown length", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		targetDir := t.TempDir()
+		session, err := store.Create(targetDir, "notes.txt", "", -1, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = store.Append(session.ID, 0, bytes.NewReader([]byte("hello ")), 0)
+		require.NoError(t, err)
+		_, err = store.Append(session.ID, 6, bytes.NewReader([]byte("world")), 0)
+		require.NoError(t, err)
+
+		_, err = store.Finalize(session.ID, "", service.UploadOptions{}, service.NewIdempotencyStore(t.TempDir()), "")
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(targetDir, "notes.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(content))
+	})
+
+	t.Run("validate target on create", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		_, err := store.Create("/etc/app", "site.tar", t.TempDir(), -1, service.UploadOptions{})
+		assert.Error(t, err)
+		_, err = store.Create(t.TempDir(), "site.tar", "", -1, service.UploadOptions{SHA256: "xyz"})
+		assert.ErrorIs(t, err, service.ErrInvalidChecksum)
+	})
+
+	t.Run("unknown and deleted sessions", func(t *testing.T) {
+		store := service.NewUploadSessionStore(t.TempDir())
+		_, err := store.Get("../../etc/passwd")
+		assert.ErrorIs(t, err, service.ErrUploadSessionNotFound)
+
+		session, err := store.Create(t.TempDir(), "site.tar", "", -1, service.UploadOptions{})
+		require.NoError(t, err)
+		require.NoError(t, store.Delete(session.ID))
+		_, err = store.Get(session.ID)
+		assert.ErrorIs(t, err, service.ErrUploadSessionNotFound)
+	})
+}
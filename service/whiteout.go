@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Whiteouts mark deletions in delta archives, following the OCI image layer
+// format: ".wh.<name>" removes <name> from the directory it is in, and the
+// opaque marker ".wh..wh..opq" clears the directory before the archive
+// content is applied. They apply to uploads merged into the target.
+const (
+	whiteoutPrefix     = ".wh."
+	whiteoutMetaPrefix = ".wh..wh."
+	whiteoutOpaque     = ".wh..wh..opq"
+)
+
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(filepath.ToSlash(name)), whiteoutPrefix)
+}
+
+// validateWhiteout checks a whiteout entry of archiveName and returns its
+// cleaned slash separated name. ok is false for whiteout metadata other than
+// the opaque marker, which is not supported.
+func validateWhiteout(archiveName, name string) (cleaned string, ok bool, err error) {
+	cleaned = path.Clean(filepath.ToSlash(name))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") || path.IsAbs(cleaned) {
+		return "", false, fmt.Errorf("tar archive '%s' contains potentially unsafe path entry '%s'", archiveName, name)
+	}
+	base := path.Base(cleaned)
+	if base == whiteoutOpaque {
+		return cleaned, true, nil
+	}
+	if strings.HasPrefix(base, whiteoutMetaPrefix) {
+		return "", false, nil
+	}
+	switch strings.TrimPrefix(base, whiteoutPrefix) {
+	case "", ".", "..":
+		return "", false, fmt.Errorf("tar archive '%s' contains invalid whiteout '%s'", archiveName, name)
+	}
+	return cleaned, true, nil
+}
+
+// whiteoutRemovals returns the entries of targetDir, relative to it, that the
+// whiteouts of an upload staged in stagingDir in fsys delete. Entries the
+// upload itself contains are kept, and every removal must resolve inside
+// targetDir.
+func whiteoutRemovals(fsys stageFS, stagingDir, targetDir string, whiteouts []string) ([]string, error) {
+	var removals []string
+	for _, whiteout := range whiteouts {
+		dir, base := path.Split(whiteout)
+		dir = strings.TrimSuffix(dir, "/")
+
+		resolvedDir, err := resolveInDir(diskFS, targetDir, targetDir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("path traversal attempt: whiteout '%s' %w", whiteout, err)
+		}
+		relDir, err := filepath.Rel(targetDir, resolvedDir)
+		if err != nil {
+			return nil, fmt.Errorf("internal error resolving whiteout '%s': %w", whiteout, err)
+		}
+		relDir = filepath.ToSlash(relDir)
+		if relDir == "." {
+			relDir = ""
+		}
+
+		if base == whiteoutOpaque {
+			opaqueRemovals, _, err := collectSyncRemovals(fsys, filepath.Join(stagingDir, filepath.FromSlash(dir)), resolvedDir, "", "", nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, removal := range opaqueRemovals {
+				removals = append(removals, path.Join(relDir, removal))
+			}
+			continue
+		}
+
+		name := strings.TrimPrefix(base, whiteoutPrefix)
+		if strings.HasPrefix(name, rootStagingPrefix) {
+			continue
+		}
+		if _, err := fsys.Lstat(filepath.Join(stagingDir, filepath.FromSlash(dir), name)); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(resolvedDir, name)); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to stat '%s': %w", filepath.Join(resolvedDir, name), err)
+		}
+		removals = append(removals, path.Join(relDir, name))
+	}
+	return removals, nil
+}
@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func TestUploadFileWithOptions_Whiteouts(t *testing.T) {
+	newTarget := func(t *testing.T) string {
+		targetDir := filepath.Join(t.TempDir(), "site")
+		for name, content := range map[string]string{
+			"index.html":          "home",
+			"old.html":            "old",
+			"legacy/page.html":    "legacy",
+			"assets/app.js":       "app",
+			"assets/vendor.js":    "vendor",
+			"assets/img/logo.png": "logo",
+		} {
+			path := filepath.Join(targetDir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+		return targetDir
+	}
+	delta := func(t *testing.T) *bytes.Buffer {
+		headers := []*tar.Header{
+			{Name: ".wh.old.html", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: ".wh.legacy", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "assets/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "assets/app.js", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "new.html", Typeflag: tar.TypeReg, Mode: 0644},
+		}
+		return createTestTarWithHeaders(t, headers, map[string]string{"assets/app.js": "new app", "new.html": "new"})
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		targetDir := newTarget(t)
+		_, err := service.UploadFileWithOptions(delta(t), targetDir, "delta.tar", "", service.UploadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"assets/app.js", "index.html", "new.html"}, listFiles(t, targetDir))
+		content, err := os.ReadFile(filepath.Join(targetDir, "assets", "app.js"))
+		require.NoError(t, err)
+		assert.Equal(t, "new app", string(content))
+	})
+
+	t.Run("put ignores whiteouts", func(t *testing.T) {
+		targetDir := newTarget(t)
+		_, err := service.UploadFileWithOptions(delta(t), targetDir, "delta.tar", "", service.UploadOptions{IsPutRequest: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"assets/app.js", "new.html"}, listFiles(t, targetDir))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		targetDir := newTarget(t)
+		result, err := service.UploadFileWithOptions(delta(t), targetDir, "delta.tar", "", service.UploadOptions{DryRun: true})
+		require.NoError(t, err)
+		var deleted []string
+		for _, entry := range result.Diff.Deleted {
+			deleted = append(deleted, entry.Path)
+		}
+		assert.Equal(t, []string{"assets/img/logo.png", "assets/vendor.js", "legacy/page.html", "old.html"}, deleted)
+		assert.Len(t, listFiles(t, targetDir), 6)
+	})
+
+	t.Run("whiteouts stay inside the target", func(t *testing.T) {
+		outsideDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(outsideDir, "secret.txt"), []byte("secret"), 0644))
+		targetDir := newTarget(t)
+		require.NoError(t, os.Symlink(outsideDir, filepath.Join(targetDir, "escape")))
+
+		for _, name := range []string{"../.wh.site", "escape/.wh.secret.txt", "escape/.wh..wh..opq", ".wh..."} {
+			headers := []*tar.Header{{Name: name, Typeflag: tar.TypeReg, Mode: 0644}}
+			archive := createTestTarWithHeaders(t, headers, nil)
+			_, err := service.UploadFileWithOptions(archive, targetDir, "delta.tar", "", service.UploadOptions{})
+			assert.Error(t, err, name)
+		}
+		_, err := os.Stat(filepath.Join(outsideDir, "secret.txt"))
+		assert.NoError(t, err)
+		_, err = os.Stat(filepath.Dir(targetDir))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// extractZipStream extracts a zip archive. The zip format keeps its directory
+// at the end of the file, so streams without random access are spooled to a
+// temporary file first, even for dry runs.
+func extractZipStream(fsys stageFS, inputStream io.Reader, baseExtractDir, archiveName string, policy ModePolicy, filter entryFilter, limiter *extractLimiter) ([]SkippedEntry, error) {
+	if readerAt, size, ok := randomAccess(inputStream); ok {
+		return extractZip(fsys, readerAt, size, baseExtractDir, archiveName, policy, filter, limiter)
+	}
+
+	spoolFile, err := os.CreateTemp("", "zip-upload-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for zip archive '%s': %w", archiveName, err)
+	}
+	defer func() {
+		if err := spoolFile.Close(); err != nil {
+			_ = err
+		}
+		if err := os.Remove(spoolFile.Name()); err != nil {
+			_ = err
+		}
+	}()
+
+	size, err := io.Copy(spoolFile, inputStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool zip archive '%s': %w", archiveName, err)
+	}
+	return extractZip(fsys, spoolFile, size, baseExtractDir, archiveName, policy, filter, limiter)
+}
+
+// randomAccess reports whether r supports reads at arbitrary offsets, as
+// uploaded multipart files and temporary files do. The read offset of r is
+// left unchanged.
+func randomAccess(r io.Reader) (io.ReaderAt, int64, bool) {
+	readerAt, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return nil, 0, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, false
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, false
+	}
+	return readerAt, size, true
+}
+
+func extractZip(fsys stageFS, r io.ReaderAt, size int64, baseExtractDir, archiveName string, policy ModePolicy, filter entryFilter, limiter *extractLimiter) ([]SkippedEntry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive '%s': %w", archiveName, err)
+	}
+
+	var skipped []SkippedEntry
+	var dirs []extractedDir
+	for _, zf := range zr.File {
+		name, selected := filter.apply(zf.Name)
+		if !selected {
+			continue
+		}
+		if reason, skip := filter.skipReason(name, zf.Mode().IsDir()); skip {
+			skipped = append(skipped, SkippedEntry{Name: name, Reason: reason})
+			continue
+		}
+		targetItemPath, err := resolveArchiveEntryPath(baseExtractDir, "zip", archiveName, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := limiter.addEntry(name); err != nil {
+			return nil, err
+		}
+
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := fsys.MkdirAll(targetItemPath, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+			}
+			dirs = append(dirs, extractedDir{path: targetItemPath, mode: mode, modTime: zf.Modified})
+		case mode.IsRegular():
+			if err := limiter.checkFileSize(zf.Name, int64(zf.UncompressedSize64)); err != nil {
+				return nil, err
+			}
+			if err := extractZipFile(fsys, zf, targetItemPath, archiveName, limiter); err != nil {
+				return nil, err
+			}
+			if err := policy.finishFile(fsys, targetItemPath, mode, zf.Modified); err != nil {
+				return nil, err
+			}
+		default:
+			skipped = append(skipped, SkippedEntry{Name: zf.Name, Reason: fmt.Sprintf("unsupported zip entry mode '%s'", mode.Type())})
+		}
+	}
+	if err := policy.finishDirs(fsys, dirs); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+func extractZipFile(fsys stageFS, zf *zip.File, targetItemPath, archiveName string, limiter *extractLimiter) error {
+	if err := fsys.MkdirAll(filepath.Dir(targetItemPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory for file '%s' from archive '%s': %w", targetItemPath, archiveName, err)
+	}
+
+	src, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open entry '%s' in archive '%s': %w", zf.Name, archiveName, err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	itemOutFile, errOpen := fsys.Create(targetItemPath, 0600)
+	if errOpen != nil {
+		return fmt.Errorf("failed to create file '%s' from archive '%s': %w", targetItemPath, archiveName, errOpen)
+	}
+	_, itemCopyErr := limiter.copyFile(itemOutFile, src, zf.Name)
+	closeErr := itemOutFile.Close()
+
+	if itemCopyErr != nil {
+		if err := fsys.Remove(targetItemPath); err != nil {
+			_ = err
+		}
+		return fmt.Errorf("failed to copy content to '%s' from archive '%s': %w", targetItemPath, archiveName, itemCopyErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close file '%s' from archive '%s': %w", targetItemPath, archiveName, closeErr)
+	}
+	return nil
+}
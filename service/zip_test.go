@@ -0,0 +1,76 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deploytar/service"
+)
+
+func createTestZip(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf
+}
+
+func TestUploadFile_Zip(t *testing.T) {
+	t.Run("extract from random access reader", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "zip_target")
+		archive := createTestZip(t, map[string]string{"index.html": "zip content", "assets/app.js": "js"})
+
+		finalPath, err := service.UploadFile(bytes.NewReader(archive.Bytes()), targetDir, "site.zip", "", false)
+		require.NoError(t, err)
+		assert.Equal(t, targetDir, finalPath)
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "assets", "app.js"))
+		require.NoError(t, err)
+		assert.Equal(t, "js", string(content))
+	})
+
+	t.Run("extract from plain stream via spool file", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "zip_stream_target")
+		archive := createTestZip(t, map[string]string{"index.html": "streamed"})
+
+		_, err := service.UploadFile(io.MultiReader(archive), targetDir, "site.ZIP", "", true)
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(filepath.Join(targetDir, "index.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "streamed", string(content))
+	})
+
+	t.Run("reject traversal entry", func(t *testing.T) {
+		baseDir := t.TempDir()
+		targetDir := filepath.Join(baseDir, "zip_evil_target")
+		archive := createTestZip(t, map[string]string{"../evil.txt": "evil"})
+
+		_, err := service.UploadFile(bytes.NewReader(archive.Bytes()), targetDir, "evil.zip", "", false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "contains potentially unsafe path entry")
+
+		_, statErr := os.Stat(filepath.Join(baseDir, "evil.txt"))
+		assert.True(t, os.IsNotExist(statErr))
+	})
+
+	t.Run("reject invalid zip", func(t *testing.T) {
+		targetDir := filepath.Join(t.TempDir(), "zip_invalid_target")
+		_, err := service.UploadFile(bytes.NewReader([]byte("not a zip")), targetDir, "broken.zip", "", false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to open zip archive")
+	})
+}